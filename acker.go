@@ -39,7 +39,9 @@ func (a *itemAcker) Ack() {
 	}
 	if err := a.q.success.call(a.item); err != nil {
 		a.q.log.Errorf("topic=%s manual ack success error: %v", a.q.topic, err)
+		return
 	}
+	a.q.notifyAcked(a.item)
 }
 
 func (a *itemAcker) Nack(err error) {
@@ -49,6 +51,7 @@ func (a *itemAcker) Nack(err error) {
 	if err != nil {
 		a.q.log.Debugf("topic=%s manual nack: %v", a.q.topic, err)
 	}
+	a.q.notifyFailed(a.item, err)
 	if ferr := a.q.failed.call(a.item); ferr != nil {
 		a.q.log.Errorf("topic=%s manual ack failed error: %v", a.q.topic, ferr)
 	}
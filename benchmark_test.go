@@ -48,24 +48,29 @@ func BenchmarkMemq_Push(b *testing.B) {
 	}
 }
 
-// BenchmarkMemq_Push_Parallel 多线程 Push 吞吐（测锁争用）
+// BenchmarkMemq_Push_Parallel 多线程 Push 吞吐（测锁争用），对比不同时间轮分片数
 func BenchmarkMemq_Push_Parallel(b *testing.B) {
-	tp := NewMemoryTopicQueue(context.Background(), "bench-push-p", WithLogger(NopLogger()))
-	if err := tp.Start(noopHandler); err != nil {
-		b.Fatal(err)
-	}
-	defer tp.Close()
-	b.ResetTimer()
-	b.ReportAllocs()
-	var counter int64
-	b.RunParallel(func(pb *testing.PB) {
-		for pb.Next() {
-			id := atomic.AddInt64(&counter, 1)
-			if err := tp.Push(&Item{DelaySecond: 3600, Value: []byte(strconv.FormatInt(id, 10))}); err != nil {
+	for _, shards := range []int{1, 4, 16} {
+		shards := shards
+		b.Run(fmt.Sprintf("shards-%d", shards), func(b *testing.B) {
+			tp := NewMemoryTopicQueue(context.Background(), "bench-push-p", WithLogger(NopLogger()), WithMemoryShards(shards))
+			if err := tp.Start(noopHandler); err != nil {
 				b.Fatal(err)
 			}
-		}
-	})
+			defer tp.Close()
+			b.ResetTimer()
+			b.ReportAllocs()
+			var counter int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id := atomic.AddInt64(&counter, 1)
+					if err := tp.Push(&Item{DelaySecond: 3600, Value: []byte(strconv.FormatInt(id, 10))}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
 }
 
 // BenchmarkMemq_PushBatch 批量推送 vs 单条推送，每条 unique value
@@ -100,16 +105,26 @@ func BenchmarkMemq_PushBatch(b *testing.B) {
 
 // BenchmarkMemq_HandlerThroughput 把 b.N 个 item 全部放到当前槽位然后触发 ticker，
 // 测量 handler 调度开销。由于时间轮粒度 1s，避免 b.N 次 push 都受 ticker 抢锁干扰，
-// 这里直接通过 insertLocked 旁路插入。
+// 这里直接通过 insertLocked 旁路插入。pool=n 为 WorkerPool 模式，与同并发的 conc=n 对比。
 func BenchmarkMemq_HandlerThroughput(b *testing.B) {
-	for _, conc := range []int{1, 16, 256} {
-		conc := conc
-		b.Run(fmt.Sprintf("conc=%d", conc), func(b *testing.B) {
+	modes := []struct {
+		name string
+		opt  Option
+	}{
+		{"conc=1", WithMaxConcurrency(1)},
+		{"conc=16", WithMaxConcurrency(16)},
+		{"conc=256", WithMaxConcurrency(256)},
+		{"pool=16", WithWorkerPool(16)},
+		{"pool=256", WithWorkerPool(256)},
+	}
+	for _, m := range modes {
+		m := m
+		b.Run(m.name, func(b *testing.B) {
 			var done int64
 			var wg sync.WaitGroup
 			tp := NewMemoryTopicQueue(context.Background(), "bench-handler",
 				WithLogger(NopLogger()),
-				WithMaxConcurrency(conc),
+				m.opt,
 				WithDisableValueIndex(true),
 			)
 			defer tp.Close()
@@ -124,11 +139,11 @@ func BenchmarkMemq_HandlerThroughput(b *testing.B) {
 
 			// 一次性把 b.N 个 item 直接插入当前槽位（bypass push）
 			wg.Add(b.N)
-			mq.mx.Lock()
+			mq.shards[0].mx.Lock()
 			for i := 0; i < b.N; i++ {
-				mq.insertLocked(&Item{Topic: "bench-handler"}, 0)
+				mq.shards[0].insertLocked(&Item{Topic: "bench-handler"}, 0)
 			}
-			mq.mx.Unlock()
+			mq.shards[0].mx.Unlock()
 
 			b.ResetTimer()
 			b.ReportAllocs()
@@ -234,11 +249,11 @@ func BenchmarkMemq_TickerSweep(b *testing.B) {
 				mq := tp.(*memQueue)
 				_ = tp.Start(func(item *Item) error { return nil })
 				// 把 n 个 item 全部放到当前槽位
-				mq.mx.Lock()
+				mq.shards[0].mx.Lock()
 				for j := 0; j < n; j++ {
-					mq.insertLocked(&Item{Topic: "bench-sweep", Value: []byte(strconv.Itoa(j))}, 0)
+					mq.shards[0].insertLocked(&Item{Topic: "bench-sweep", Value: []byte(strconv.Itoa(j))}, 0)
 				}
-				mq.mx.Unlock()
+				mq.shards[0].mx.Unlock()
 
 				b.StartTimer()
 				_ = mq.ticker()
@@ -250,6 +265,41 @@ func BenchmarkMemq_TickerSweep(b *testing.B) {
 	}
 }
 
+// BenchmarkMemq_TickLongDelay 时间轮中有 N 个在 [1 小时, 1 小时+horizon) 内均匀到期的 item 时，
+// 单次 tick 的平均开销（含到期派发与分层下沉）。单层时间轮每个 tick 需遍历槽位中所有远期节点并递减 cycleCount。
+func BenchmarkMemq_TickLongDelay(b *testing.B) {
+	for _, horizon := range []int{24 * wheelSize, 30 * 24 * wheelSize} {
+		for _, n := range []int{100000, 1000000} {
+			horizon, n := horizon, n
+			b.Run(fmt.Sprintf("horizon=%dh/pending=%d", horizon/wheelSize, n), func(b *testing.B) {
+				tp := NewMemoryTopicQueue(context.Background(), "bench-long",
+					WithLogger(NopLogger()), WithDisableValueIndex(true), WithMaxConcurrency(0))
+				mq := tp.(*memQueue)
+				if err := tp.Start(noopHandler); err != nil {
+					b.Fatal(err)
+				}
+				defer tp.Close()
+				fill := func() {
+					mq.shards[0].mx.Lock()
+					for j := 0; j < n; j++ {
+						mq.shards[0].insertLocked(&Item{Topic: "bench-long"}, int64(wheelSize+j%horizon))
+					}
+					mq.shards[0].mx.Unlock()
+				}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if i%(wheelSize+horizon) == 0 {
+						b.StopTimer()
+						fill()
+						b.StartTimer()
+					}
+					_ = mq.ticker()
+				}
+			})
+		}
+	}
+}
+
 // ===== 优先级排序 =====
 
 // BenchmarkMemq_PushWithPriority 包含 priority 排序的 Push
@@ -289,11 +339,11 @@ func BenchmarkMemq_ManualAck(b *testing.B) {
 	}
 
 	wg.Add(b.N)
-	mq.mx.Lock()
+	mq.shards[0].mx.Lock()
 	for i := 0; i < b.N; i++ {
-		mq.insertLocked(&Item{Topic: "bench-manual"}, 0)
+		mq.shards[0].insertLocked(&Item{Topic: "bench-manual"}, 0)
 	}
-	mq.mx.Unlock()
+	mq.shards[0].mx.Unlock()
 
 	b.ResetTimer()
 	b.ReportAllocs()
@@ -0,0 +1,210 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// breakerState 熔断器状态
+type breakerState int32
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// defaultBreakerOpenTimeout BreakerOpenTimeout<=0 时的默认打开时长
+const defaultBreakerOpenTimeout = 5 * time.Second
+
+// circuitBreaker Redis 脚本执行熔断器。
+//
+//   - closed：放行所有调用，连续失败达到 threshold 次后转为 open
+//   - open：直接拒绝调用，openTimeout 后转为 half-open
+//   - half-open：至多放行 probes 个并发探测调用，连续成功 probes 次后转为 closed，任一失败重新 open
+//
+// 每次状态迁移递增 gen；done 只统计与当前 gen 相同的调用，迁移前放行、迁移后才完成的调用被忽略，
+// 不会被当作探测调用，也不会让过期的成功关闭熔断器。
+// 同一 Queue 下的所有 Redis topic 共享一个熔断器，状态迁移由触发迁移的 topic 负责上报。
+type circuitBreaker struct {
+	mu          sync.Mutex
+	state       breakerState
+	gen         uint64
+	failures    int
+	successes   int
+	probing     int
+	openedAt    time.Time
+	threshold   int
+	openTimeout time.Duration
+	probes      int
+	now         func() time.Time
+}
+
+// newCircuitBreaker 按 Options 构造熔断器；未启用时返回 nil
+func newCircuitBreaker(opts *Options) *circuitBreaker {
+	threshold := opts.GetBreakerFailureThreshold()
+	if threshold <= 0 {
+		return nil
+	}
+	b := &circuitBreaker{
+		threshold:   threshold,
+		openTimeout: opts.GetBreakerOpenTimeout(),
+		probes:      opts.GetBreakerHalfOpenProbes(),
+		now:         time.Now,
+	}
+	if b.openTimeout <= 0 {
+		b.openTimeout = defaultBreakerOpenTimeout
+	}
+	if b.probes <= 0 {
+		b.probes = 1
+	}
+	return b
+}
+
+// allow 判断是否放行一次调用，放行时返回调用所属的 gen，完成后交给 done；
+// changed 为 true 时表示本次调用使状态迁移到 to
+func (b *circuitBreaker) allow() (gen uint64, ok bool, to breakerState, changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return b.gen, false, b.state, false
+		}
+		b.state, b.successes, b.probing = breakerHalfOpen, 0, 1
+		b.gen++
+		return b.gen, true, b.state, true
+	case breakerHalfOpen:
+		if b.probing >= b.probes {
+			return b.gen, false, b.state, false
+		}
+		b.probing++
+		return b.gen, true, b.state, false
+	default:
+		return b.gen, true, b.state, false
+	}
+}
+
+// done 记录一次已放行调用的结果，gen 为 allow 返回值；changed 为 true 时表示状态迁移到 to
+func (b *circuitBreaker) done(gen uint64, failed bool) (to breakerState, changed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		// 状态迁移前放行的调用，结果不影响当前状态
+		return b.state, false
+	}
+	switch b.state {
+	case breakerHalfOpen:
+		b.probing--
+		if failed {
+			b.trip()
+			return b.state, true
+		}
+		b.successes++
+		if b.successes >= b.probes {
+			b.state, b.failures = breakerClosed, 0
+			b.gen++
+			return b.state, true
+		}
+	case breakerClosed:
+		if !failed {
+			b.failures = 0
+			return b.state, false
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.trip()
+			return b.state, true
+		}
+	}
+	return b.state, false
+}
+
+func (b *circuitBreaker) trip() {
+	b.state, b.openedAt, b.failures, b.successes, b.probing = breakerOpen, b.now(), 0, 0, 0
+	b.gen++
+}
+
+// retryAfter 返回熔断打开状态剩余的时长；非 open 状态返回 0
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != breakerOpen {
+		return 0
+	}
+	if d := b.openTimeout - b.now().Sub(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// backendFailureMarkers 以字符串形式透传的连接/超时错误特征（部分 RedisScript 实现不保留错误类型）
+var backendFailureMarkers = []string{
+	"connection refused",
+	"connection reset",
+	"broken pipe",
+	"timeout",
+	"use of closed network connection",
+	"no such host",
+	"EOF",
+}
+
+// isBackendFailure 判断 Redis 调用错误是否计入熔断：只计入连接与超时错误。
+// 调用方主动取消不计入；Lua 运行时错误、WRONGTYPE 等脚本错误是确定性的，与 Redis 是否可用无关，
+// 且熔断器被所有 topic 共享，也不计入。
+func isBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	msg := err.Error()
+	for _, m := range backendFailureMarkers {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// breakerChanged 上报熔断器状态迁移
+func (q *redisQueue) breakerChanged(to breakerState) {
+	switch to {
+	case breakerOpen:
+		q.monitorCount(MetricBreakerOpen)
+		q.log.Warnf("topic=%s redis circuit breaker open, failing fast for %v", q.topic, q.breaker.openTimeout)
+	case breakerHalfOpen:
+		q.monitorCount(MetricBreakerHalfOpen)
+		q.log.Infof("topic=%s redis circuit breaker half-open, probing", q.topic)
+	case breakerClosed:
+		q.monitorCount(MetricBreakerClose)
+		q.log.Infof("topic=%s redis circuit breaker closed", q.topic)
+	}
+}
+
+// breakerRetryAfter 作为 ticker 的退避扩展：熔断打开期间至少等到进入半开再重试
+func (q *redisQueue) breakerRetryAfter(err error) time.Duration {
+	if !errors.Is(err, ErrBackendUnavailable) {
+		return 0
+	}
+	return q.breaker.retryAfter()
+}
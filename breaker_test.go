@@ -0,0 +1,200 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestCircuitBreaker_StateMachine closed → open → half-open → closed / 重新 open
+func TestCircuitBreaker_StateMachine(t *testing.T) {
+	b := newCircuitBreaker(newConfig(
+		WithBreakerFailureThreshold(3),
+		WithBreakerOpenTimeout(time.Second),
+		WithBreakerHalfOpenProbes(2),
+	))
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	// 成功会重置连续失败计数
+	for _, failed := range []bool{true, true, false, true, true} {
+		gen, ok, _, _ := b.allow()
+		if !ok {
+			t.Fatal("closed breaker should allow")
+		}
+		if _, changed := b.done(gen, failed); changed {
+			t.Fatal("should stay closed")
+		}
+	}
+	gen, _, _, _ := b.allow()
+	if to, changed := b.done(gen, true); !changed || to != breakerOpen {
+		t.Fatalf("want open after 3 consecutive failures, got %v changed=%v", to, changed)
+	}
+	if _, ok, _, _ := b.allow(); ok {
+		t.Fatal("open breaker should reject")
+	}
+	if d := b.retryAfter(); d != time.Second {
+		t.Fatalf("want retryAfter 1s got %v", d)
+	}
+
+	now = now.Add(time.Second)
+	gen, ok, to, changed := b.allow()
+	if !ok || !changed || to != breakerHalfOpen {
+		t.Fatalf("want half-open probe, got ok=%v to=%v changed=%v", ok, to, changed)
+	}
+	if _, ok, _, _ = b.allow(); !ok {
+		t.Fatal("second probe should be allowed")
+	}
+	if _, ok, _, _ = b.allow(); ok {
+		t.Fatal("probes exceeded should be rejected")
+	}
+	if _, changed = b.done(gen, false); changed {
+		t.Fatal("one successful probe is not enough to close")
+	}
+	if to, changed = b.done(gen, false); !changed || to != breakerClosed {
+		t.Fatalf("want closed after 2 successful probes, got %v", to)
+	}
+
+	// 半开探测失败重新打开
+	for i := 0; i < 3; i++ {
+		gen, _, _, _ = b.allow()
+		b.done(gen, true)
+	}
+	now = now.Add(2 * time.Second)
+	gen, _, _, _ = b.allow()
+	if to, changed = b.done(gen, true); !changed || to != breakerOpen {
+		t.Fatalf("failed probe should reopen, got %v", to)
+	}
+}
+
+// TestCircuitBreaker_Disabled 未配置阈值时不创建熔断器
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	if b := newCircuitBreaker(newConfig()); b != nil {
+		t.Fatal("breaker should be disabled by default")
+	}
+	rq := NewRedisTopicQueue(context.Background(), "brk-off", WithRedisScriptBuilder(&fakeScriptBuilder{})).(*redisQueue)
+	if rq.breaker != nil || rq.tickerRetryAfter != nil {
+		t.Fatal("breaker should be nil by default")
+	}
+}
+
+// TestCircuitBreaker_FailFast 熔断打开后 runScript 不再访问 Redis，直接返回 ErrBackendUnavailable，并上报状态迁移
+func TestCircuitBreaker_FailFast(t *testing.T) {
+	var mu sync.Mutex
+	counts := make(map[string]int64)
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "brk",
+		WithRedisScriptBuilder(b),
+		WithBreakerFailureThreshold(2),
+		WithBreakerOpenTimeout(time.Hour),
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			mu.Lock()
+			counts[metric] += value
+			mu.Unlock()
+		}),
+	).(*redisQueue)
+	redisDown(b)
+	for i := 0; i < 2; i++ {
+		if err := rq.Push(&Item{Value: []byte("v")}); err == nil || errors.Is(err, ErrBackendUnavailable) {
+			t.Fatalf("push %d: want redis error got %v", i, err)
+		}
+	}
+	calls := b.scripts[idxAdd].evalShaCalls
+	if err := rq.Push(&Item{Value: []byte("v")}); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("want ErrBackendUnavailable got %v", err)
+	}
+	if _, _, err := rq.Get([]byte("v")); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("breaker should cover every script, got %v", err)
+	}
+	if b.scripts[idxAdd].evalShaCalls != calls {
+		t.Fatal("open breaker should not reach redis")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if counts[MetricBreakerOpen] != 1 {
+		t.Fatalf("want 1 open event got %v", counts)
+	}
+	if d := rq.breakerRetryAfter(ErrBackendUnavailable); d <= 0 || d > time.Hour {
+		t.Fatalf("ticker should wait for half-open, got %v", d)
+	}
+	if d := rq.breakerRetryAfter(errors.New("other")); d != 0 {
+		t.Fatalf("other errors should not extend backoff, got %v", d)
+	}
+}
+
+// TestCircuitBreaker_SharedAcrossTopics 通过 New 创建的 topic 共享同一熔断器
+func TestCircuitBreaker_SharedAcrossTopics(t *testing.T) {
+	q := New(WithRedisScriptBuilder(&fakeScriptBuilder{}), WithBreakerFailureThreshold(1)).(*queue)
+	a := q.newTopicQueue("brk-a").(*redisQueue)
+	c := q.newTopicQueue("brk-b").(*redisQueue)
+	if a.breaker == nil || a.breaker != c.breaker || a.breaker != q.breaker {
+		t.Fatal("topics should share the queue breaker")
+	}
+}
+
+// TestCircuitBreaker_CanceledNotCounted 调用方取消的 context 与脚本错误不计入失败，只计入连接与超时错误
+func TestCircuitBreaker_CanceledNotCounted(t *testing.T) {
+	if isBackendFailure(context.Canceled) || isBackendFailure(nil) {
+		t.Fatal("canceled/nil should not count as failure")
+	}
+	if !isBackendFailure(errors.New("io timeout")) {
+		t.Fatal("io error should count as failure")
+	}
+	for _, err := range []error{
+		context.DeadlineExceeded,
+		io.EOF,
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("refused")},
+		errors.New("dial tcp 127.0.0.1:6379: connect: connection refused"),
+	} {
+		if !isBackendFailure(err) {
+			t.Fatalf("%v should count as failure", err)
+		}
+	}
+	for _, err := range []error{
+		errors.New("ERR Error running script (call to f_abc): @user_script:3: user_script:3: attempt to compare nil with number"),
+		errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"),
+	} {
+		if isBackendFailure(err) {
+			t.Fatalf("script error %q should not count as failure", err)
+		}
+	}
+}
+
+// TestCircuitBreaker_StaleGeneration 状态迁移前放行的调用在迁移后完成时被忽略：
+// 不会被当作探测调用使 probing 变为负数，过期的成功也不会关闭熔断器
+func TestCircuitBreaker_StaleGeneration(t *testing.T) {
+	b := newCircuitBreaker(newConfig(
+		WithBreakerFailureThreshold(1),
+		WithBreakerOpenTimeout(time.Second),
+		WithBreakerHalfOpenProbes(1),
+	))
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+
+	slow, _, _, _ := b.allow()
+	failing, _, _, _ := b.allow()
+	if to, changed := b.done(failing, true); !changed || to != breakerOpen {
+		t.Fatalf("want open got %v", to)
+	}
+	now = now.Add(time.Second)
+	probe, ok, to, _ := b.allow()
+	if !ok || to != breakerHalfOpen {
+		t.Fatalf("want half-open probe got ok=%v to=%v", ok, to)
+	}
+	// 关闭状态放行的慢调用在半开期间成功返回
+	if to, changed := b.done(slow, false); changed || to != breakerHalfOpen {
+		t.Fatalf("stale success should be ignored, got %v changed=%v", to, changed)
+	}
+	if _, ok, _, _ = b.allow(); ok {
+		t.Fatal("stale result must not free a probe slot")
+	}
+	if to, changed := b.done(probe, false); !changed || to != breakerClosed {
+		t.Fatalf("probe success should close, got %v", to)
+	}
+}
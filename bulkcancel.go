@@ -0,0 +1,513 @@
+package delayq
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// cancelBatchLua 从 delay/doing/failed/owner/seq 五处删除一批 value，返回被删除的 value 数
+var cancelBatchLua = releaseOwnerLua + `
+local delay_set, doing_set, failed_hash, owner_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local owned = owned_sets(owner_hash, 6)
+local n = 0
+for i = 1, #ARGV do
+	local v = ARGV[i]
+	local removed = redis.call('ZREM', delay_set, v) + redis.call('ZREM', doing_set, v)
+	if removed > 0 then
+		n = n + 1
+	end
+	redis.call('HDEL', failed_hash, v)
+	release_owner(owner_hash, owned, v)
+	redis.call('HDEL', seq_hash, 'v:' .. v, 'e:' .. v)
+end
+return {n}
+`
+
+// cancelPrefixLua 以 ZSCAN 扫描 KEYS[1] 一页，删除以前缀开头的 value（MATCH 之后再逐字节比对）。
+// ARGV: cursor, match pattern, prefix, count；返回 {next_cursor, removed}
+var cancelPrefixLua = releaseOwnerLua + `
+local scan_set, delay_set, doing_set, failed_hash, owner_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6]
+local owned = owned_sets(owner_hash, 7)
+local prefix = ARGV[3]
+local res = redis.call('ZSCAN', scan_set, ARGV[1], 'MATCH', ARGV[2], 'COUNT', tonumber(ARGV[4]))
+local members = res[2]
+local n = 0
+for i = 1, #members, 2 do
+	local v = members[i]
+	if string.sub(v, 1, #prefix) == prefix then
+		local removed = redis.call('ZREM', delay_set, v) + redis.call('ZREM', doing_set, v)
+		if removed > 0 then
+			n = n + 1
+		end
+		redis.call('HDEL', failed_hash, v)
+		release_owner(owner_hash, owned, v)
+		redis.call('HDEL', seq_hash, 'v:' .. v, 'e:' .. v)
+	end
+end
+return {res[1], n}
+`
+
+// purgeLua 删除分片的 delay/doing/failed/owner/seq 五个 key 以及 KEYS[6..] 声明的各消费者持有集，
+// 返回删除前 delay 与 doing 集中的 item 数
+var purgeLua = `
+local delay_set, doing_set, failed_hash, owner_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local n = redis.call('ZCARD', delay_set) + redis.call('ZCARD', doing_set)
+for i = 1, #KEYS do
+	redis.call('DEL', KEYS[i])
+end
+return {n}
+`
+
+// cancelBatchSize 批量取消时每次脚本调用处理的 value 数，同时作为 ZSCAN 的 COUNT
+const cancelBatchSize = 256
+
+// bulkCanceler 支持批量取消与清空的 TopicQueue 实现
+type bulkCanceler interface {
+	cancelBatch(values [][]byte) (int64, error)
+	cancelByPrefix(prefix []byte) (int64, error)
+	purge() (int64, error)
+}
+
+// CancelBatch 取消 topic 中匹配任一 value 的 item，返回取消的 item 数。
+// 后端不支持批量取消时退化为逐个 Cancel，此时返回取消成功的 value 数。
+func (q *queue) CancelBatch(topic string, values [][]byte) (int64, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return 0, ErrTopicQueueHasClosed
+	}
+	if bc, ok := val.(bulkCanceler); ok {
+		return bc.cancelBatch(values)
+	}
+	var n int64
+	for _, v := range values {
+		canceled, err := val.(TopicQueue).Cancel(v)
+		if err != nil {
+			return n, err
+		}
+		if canceled {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CancelByPrefix 取消 topic 中 value 以 prefix 开头的 item（含 doing 中的），返回取消的 item 数。
+// 内存队列扫描 value 索引（DisableValueIndex=true 时返回 ErrValueIndexDisabled）；
+// Redis 队列对各分片的 delay/doing 集做 ZSCAN，扫描期间新入队的 item 可能不被取消。
+func (q *queue) CancelByPrefix(topic string, prefix []byte) (int64, error) {
+	bc, err := q.bulkCanceler(topic)
+	if err != nil {
+		return 0, err
+	}
+	return bc.cancelByPrefix(prefix)
+}
+
+// Purge 清空 topic 中等待执行、执行中（doing）与失败计数，返回清除的 item 数。
+// Redis 队列每个分片在一个脚本内原子清空，本地缓冲一并丢弃；dead 集不受影响。
+func (q *queue) Purge(topic string) (int64, error) {
+	bc, err := q.bulkCanceler(topic)
+	if err != nil {
+		return 0, err
+	}
+	return bc.purge()
+}
+
+// bulkCanceler 返回已启动 topic 的批量取消实现
+func (q *queue) bulkCanceler(topic string) (bulkCanceler, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return nil, ErrTopicQueueHasClosed
+	}
+	bc, ok := val.(bulkCanceler)
+	if !ok {
+		return nil, ErrBulkCancelUnsupported
+	}
+	return bc, nil
+}
+
+// cancelBatch 标记所有匹配任一 value 的节点为 canceled
+func (q *memQueue) cancelBatch(values [][]byte) (int64, error) {
+	items, err := q.cancelValues(values)
+	return int64(len(items)), err
+}
+
+// cancelValues 标记匹配 values 的节点为 canceled 并返回被取消的 item；按分片分组，
+// 启用 journal 时每个分片一次性记录
+func (q *memQueue) cancelValues(values [][]byte) ([]*Item, error) {
+	if q.shards[0].byValue == nil {
+		return nil, ErrValueIndexDisabled
+	}
+	groups := make([][]string, len(q.shards))
+	for _, v := range values {
+		idx := 0
+		if len(q.shards) > 1 {
+			idx = shardIndex(v, len(q.shards))
+		}
+		groups[idx] = append(groups[idx], string(v))
+	}
+	var canceled []*Item
+	for idx, keys := range groups {
+		if len(keys) > 0 {
+			canceled = q.cancelKeys(q.shards[idx], keys, canceled)
+		}
+	}
+	return canceled, nil
+}
+
+// cancelByPrefix 扫描 value 索引，标记 value 以 prefix 开头的节点为 canceled
+func (q *memQueue) cancelByPrefix(prefix []byte) (int64, error) {
+	items, err := q.cancelPrefixed(prefix)
+	return int64(len(items)), err
+}
+
+// cancelPrefixed 逐个分片标记 value 以 prefix 开头的节点为 canceled 并返回被取消的 item
+func (q *memQueue) cancelPrefixed(prefix []byte) ([]*Item, error) {
+	if q.shards[0].byValue == nil {
+		return nil, ErrValueIndexDisabled
+	}
+	p := string(prefix)
+	var canceled []*Item
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		var keys []string
+		for key := range sh.byValue {
+			if strings.HasPrefix(key, p) {
+				keys = append(keys, key)
+			}
+		}
+		for key := range sh.retries {
+			if _, ok := sh.byValue[key]; !ok && strings.HasPrefix(key, p) {
+				keys = append(keys, key)
+			}
+		}
+		sh.mx.Unlock()
+		if len(keys) > 0 {
+			canceled = q.cancelKeys(sh, keys, canceled)
+		}
+	}
+	return canceled, nil
+}
+
+// cancelKeys 持有 sh.mx 标记 keys 对应的节点并停止亚秒重试，把被取消的 item 追加到 out；
+// 启用 journal 时在释放锁前记录本分片取消的 item
+func (q *memQueue) cancelKeys(sh *memShard, keys []string, out []*Item) []*Item {
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	start := len(out)
+	for _, key := range keys {
+		out = q.cancelKeyLocked(sh, key, out)
+	}
+	if q.journal != nil && len(out) > start {
+		q.journal.canceled(out[start:])
+	}
+	return out
+}
+
+// cancelKeyLocked 在持有 sh.mx 时标记 byValue[key] 中未取消的节点、停止 retries[key] 中的亚秒重试，
+// 并把对应 item 追加到 out
+func (q *memQueue) cancelKeyLocked(sh *memShard, key string, out []*Item) []*Item {
+	for _, n := range sh.byValue[key] {
+		if !n.canceled {
+			n.canceled = true
+			sh.count--
+			sh.canceledNodes++
+			out = append(out, n.item)
+		}
+	}
+	// stopRetryLocked 会修改 retries[key]，先复制
+	for _, r := range append([]*subSecondRetry(nil), sh.retries[key]...) {
+		if q.stopRetryLocked(sh, r) {
+			out = append(out, r.item)
+		}
+	}
+	return out
+}
+
+// purge 清空时间轮，返回清除的未取消 item 数
+func (q *memQueue) purge() (int64, error) {
+	return int64(len(q.purgeItems())), nil
+}
+
+// purgeItems 逐个分片清空时间轮与 value 索引并停止等待中的亚秒重试，返回其中未取消的 item；
+// 启用 journal 时记录为取消。
+func (q *memQueue) purgeItems() []*Item {
+	var live []*Item
+	for _, sh := range q.shards {
+		live = append(live, q.purgeShard(sh)...)
+	}
+	return live
+}
+
+// purgeShard 清空单个分片，返回其中未取消的 item
+func (q *memQueue) purgeShard(sh *memShard) []*Item {
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	var live []*Item
+	for _, list := range sh.retries {
+		for _, r := range append([]*subSecondRetry(nil), list...) {
+			if q.stopRetryLocked(sh, r) {
+				live = append(live, r.item)
+			}
+		}
+	}
+	sh.wheel.each(func(p *wheelNode) {
+		if !p.canceled {
+			live = append(live, p.item)
+		}
+	})
+	if q.journal != nil && len(live) > 0 {
+		q.journal.canceled(live)
+	}
+	sh.resetLocked()
+	return live
+}
+
+// cancelBatch 按分片分组，每组每次至多 cancelBatchSize 个 value 调用一次 cancelBatchScript；
+// 本地缓冲中匹配的 item 一并丢弃
+func (q *redisQueue) cancelBatch(values [][]byte) (int64, error) {
+	n, err := q.dropSpooled(func(it *Item) bool {
+		for _, v := range values {
+			if bytes.Equal(it.GetValue(), v) {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return n, err
+	}
+	groups := make([][]interface{}, len(q.shards))
+	for _, v := range values {
+		idx := shardIndex(v, len(q.shards))
+		groups[idx] = append(groups[idx], v)
+	}
+	for i, g := range groups {
+		sh := q.shards[i]
+		for start := 0; start < len(g); start += cancelBatchSize {
+			end := start + cancelBatchSize
+			if end > len(g) {
+				end = len(g)
+			}
+			res, err := q.runScript(q.opCtx(), q.cancelBatchScript,
+				q.withOwnedSetKeys(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey), g[start:end]...)
+			if err != nil {
+				return n, err
+			}
+			if len(res) > 0 {
+				n += parseInt64(res[0])
+			}
+		}
+	}
+	return n, nil
+}
+
+// cancelByPrefix 对各分片的 delay 与 doing 集分别 ZSCAN，删除以 prefix 开头的 value；
+// 本地缓冲中匹配的 item 一并丢弃
+func (q *redisQueue) cancelByPrefix(prefix []byte) (int64, error) {
+	n, err := q.dropSpooled(func(it *Item) bool { return bytes.HasPrefix(it.GetValue(), prefix) })
+	if err != nil {
+		return n, err
+	}
+	pattern := globEscape(string(prefix)) + "*"
+	for _, sh := range q.shards {
+		for _, set := range []string{sh.delaySetKey, sh.doingSetKey} {
+			keys := q.withOwnedSetKeys(sh, set, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey)
+			cursor := "0"
+			for {
+				res, err := q.runScript(q.opCtx(), q.cancelPrefixScript, keys, cursor, pattern, prefix, cancelBatchSize)
+				if err != nil {
+					return n, err
+				}
+				if len(res) < 2 {
+					break
+				}
+				n += parseInt64(res[1])
+				if cursor = fmt.Sprint(res[0]); cursor == "0" {
+					break
+				}
+			}
+		}
+	}
+	return n, nil
+}
+
+// purge 丢弃本地缓冲并逐个分片清空 delay/doing/failed/owner/seq；dead 集保留
+func (q *redisQueue) purge() (int64, error) {
+	n, err := q.dropSpooled(func(*Item) bool { return true })
+	if err != nil {
+		return n, err
+	}
+	for _, sh := range q.shards {
+		res, err := q.runScript(q.opCtx(), q.purgeScript,
+			q.withOwnedSetKeys(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey))
+		if err != nil {
+			return n, err
+		}
+		if len(res) > 0 {
+			n += parseInt64(res[0])
+		}
+	}
+	return n, nil
+}
+
+// dropSpooled 从本地缓冲中移除满足 match 的 item，返回移除数量；未启用缓冲时返回 0
+func (q *redisQueue) dropSpooled(match func(*Item) bool) (int64, error) {
+	if q.spool == nil {
+		return 0, nil
+	}
+	n, err := q.spool.remove(match)
+	return int64(n), err
+}
+
+// globEscape 转义 Redis glob 模式中的特殊字符
+func globEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// cancelBatch 同时取消两层中匹配的 item；已拉入内存且尚未派发的 item 两层各算一次，结果中去重
+func (q *tieredQueue) cancelBatch(values [][]byte) (int64, error) {
+	items, err := q.memQueue.cancelValues(values)
+	if err != nil {
+		return 0, err
+	}
+	dup := q.forgetPromoted(items, func(v []byte) bool {
+		for _, want := range values {
+			if bytes.Equal(v, want) {
+				return true
+			}
+		}
+		return false
+	})
+	n, err := q.redis.cancelBatch(values)
+	return int64(len(items)) + n - dup, err
+}
+
+// cancelByPrefix 同时按前缀取消两层中的 item，计数规则同 cancelBatch
+func (q *tieredQueue) cancelByPrefix(prefix []byte) (int64, error) {
+	items, err := q.memQueue.cancelPrefixed(prefix)
+	if err != nil {
+		return 0, err
+	}
+	dup := q.forgetPromoted(items, func(v []byte) bool { return bytes.HasPrefix(v, prefix) })
+	n, err := q.redis.cancelByPrefix(prefix)
+	return int64(len(items)) + n - dup, err
+}
+
+// purge 清空两层，计数规则同 cancelBatch
+func (q *tieredQueue) purge() (int64, error) {
+	items := q.memQueue.purgeItems()
+	dup := q.forgetPromoted(items, func([]byte) bool { return true })
+	n, err := q.redis.purge()
+	return int64(len(items)) + n - dup, err
+}
+
+// forgetPromoted 把 value 满足 match 的 item 移出 promoted，
+// 返回 canceled 中仍属于 promoted 的数量（这些 item 同时位于 Redis doing 集）
+func (q *tieredQueue) forgetPromoted(canceled []*Item, match func([]byte) bool) int64 {
+	q.promotedMu.Lock()
+	defer q.promotedMu.Unlock()
+	var dup int64
+	for _, it := range canceled {
+		if _, ok := q.promoted[it]; ok {
+			dup++
+		}
+	}
+	for it := range q.promoted {
+		if match(it.GetValue()) {
+			delete(q.promoted, it)
+		}
+	}
+	return dup
+}
+
+// cancelBatch 每次至多 cancelBatchSize 个 value，按 payload IN (...) 删除
+func (q *sqlQueue) cancelBatch(values [][]byte) (int64, error) {
+	var n int64
+	for start := 0; start < len(values); start += cancelBatchSize {
+		end := start + cancelBatchSize
+		if end > len(values) {
+			end = len(values)
+		}
+		args := make([]interface{}, 0, end-start+1)
+		args = append(args, q.topic)
+		for _, v := range values[start:end] {
+			args = append(args, v)
+		}
+		res, err := q.exec(q.opCtx(), q.db, "DELETE FROM "+q.table+" WHERE topic = ? AND payload IN ("+
+			strings.TrimSuffix(strings.Repeat("?, ", end-start), ", ")+")", args...)
+		if err != nil {
+			return n, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+// cancelByPrefix 读取 topic 下所有行的 id 与 payload，在进程内按前缀过滤后按 id 分批删除。
+// payload 为二进制，不使用 LIKE 以避免各方言的转义与排序规则差异。
+func (q *sqlQueue) cancelByPrefix(prefix []byte) (int64, error) {
+	ctx := q.opCtx()
+	rows, err := q.db.QueryContext(ctx, q.dialect.rebind(
+		"SELECT id, payload FROM "+q.table+" WHERE topic = ?"), q.topic)
+	if err != nil {
+		return 0, err
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id int64
+		var payload []byte
+		if err = rows.Scan(&id, &payload); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		if bytes.HasPrefix(payload, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	var n int64
+	for start := 0; start < len(ids); start += cancelBatchSize {
+		end := start + cancelBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		res, err := q.exec(ctx, q.db, "DELETE FROM "+q.table+" WHERE id IN ("+
+			strings.TrimSuffix(strings.Repeat("?, ", end-start), ", ")+")", ids[start:end]...)
+		if err != nil {
+			return n, err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return n, err
+		}
+		n += affected
+	}
+	return n, nil
+}
+
+// purge 在一条语句中删除 topic 下的所有行
+func (q *sqlQueue) purge() (int64, error) {
+	res, err := q.exec(q.opCtx(), q.db, "DELETE FROM "+q.table+" WHERE topic = ?", q.topic)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
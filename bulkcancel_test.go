@@ -0,0 +1,241 @@
+package delayq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	idxCancelBatch  = 15
+	idxCancelPrefix = 16
+	idxPurge        = 17
+)
+
+// TestBulkCancel_Memory 内存队列按 value 批量取消、按前缀取消与清空，返回未取消过的 item 数
+func TestBulkCancel_Memory(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	if err := q.Start("bulk", func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	var items []*Item
+	for _, v := range []string{"order:1", "order:2", "order:2", "user:1", "user:2", "other"} {
+		items = append(items, &Item{Topic: "bulk", Value: []byte(v), DelaySecond: 60})
+	}
+	if err := q.PushBatch(items); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := q.CancelBatch("bulk", [][]byte{[]byte("order:2"), []byte("missing")})
+	if err != nil || n != 2 {
+		t.Fatalf("CancelBatch: want 2 got %d err=%v", n, err)
+	}
+	if n, _ = q.CancelBatch("bulk", [][]byte{[]byte("order:2")}); n != 0 {
+		t.Fatalf("already canceled items should not be counted again, got %d", n)
+	}
+	if n, err = q.CancelByPrefix("bulk", []byte("order:")); err != nil || n != 1 {
+		t.Fatalf("CancelByPrefix: want 1 got %d err=%v", n, err)
+	}
+	if _, ok, _ := q.Get("bulk", []byte("user:1")); !ok {
+		t.Fatal("items outside the prefix should be kept")
+	}
+	if n, err = q.Purge("bulk"); err != nil || n != 3 {
+		t.Fatalf("Purge: want 3 got %d err=%v", n, err)
+	}
+	if st := q.Status(); st.QueueLength["bulk"] != 0 {
+		t.Fatalf("queue should be empty after purge, got %d", st.QueueLength["bulk"])
+	}
+	if _, err = q.Purge("missing"); !errors.Is(err, ErrTopicQueueHasClosed) {
+		t.Fatalf("want ErrTopicQueueHasClosed got %v", err)
+	}
+}
+
+// TestBulkCancel_MemoryIndexDisabled 关闭 value 索引时批量与前缀取消返回 ErrValueIndexDisabled，Purge 仍可用
+func TestBulkCancel_MemoryIndexDisabled(t *testing.T) {
+	q := newMemoryTopicQueue(context.Background(), "noidx", newConfig(WithLogger(NopLogger()), WithDisableValueIndex(true))).(*memQueue)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push(&Item{Value: []byte("a"), DelaySecond: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.cancelBatch([][]byte{[]byte("a")}); !errors.Is(err, ErrValueIndexDisabled) {
+		t.Fatalf("want ErrValueIndexDisabled got %v", err)
+	}
+	if _, err := q.cancelByPrefix([]byte("a")); !errors.Is(err, ErrValueIndexDisabled) {
+		t.Fatalf("want ErrValueIndexDisabled got %v", err)
+	}
+	if n, err := q.purge(); err != nil || n != 1 || q.Length() != 0 {
+		t.Fatalf("purge: n=%d err=%v length=%d", n, err, q.Length())
+	}
+}
+
+// TestBulkCancel_RedisBatchGroupsByShard 批量取消按分片分组并分块调用脚本，本地缓冲中的 item 一并移除
+func TestBulkCancel_RedisBatchGroupsByShard(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "rbulk", WithRedisScriptBuilder(b), WithRedisShards(2), WithSpoolSize(10)).(*redisQueue)
+	redisDown(b)
+	if err := rq.Push(&Item{Value: []byte("spooled"), DelaySecond: 10}); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	perShard := map[string]int{}
+	b.scripts[idxCancelBatch].evalShaFn = func(_ context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(args) > cancelBatchSize {
+			t.Errorf("chunk too large: %d", len(args))
+		}
+		for _, a := range args {
+			if got := rq.shardOf(a.([]byte)).delaySetKey; got != keys[0] {
+				t.Errorf("value %s routed to %s, want %s", a, keys[0], got)
+			}
+		}
+		perShard[keys[0]] += len(args)
+		return []interface{}{int64(len(args))}, nil
+	}
+	values := [][]byte{[]byte("spooled")}
+	for i := 0; i < 600; i++ {
+		values = append(values, []byte(fmt.Sprintf("v%d", i)))
+	}
+	n, err := rq.cancelBatch(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(values))+1 {
+		t.Fatalf("want %d (600 + spooled twice: once from spool, once from redis) got %d", len(values)+1, n)
+	}
+	if rq.spool.len() != 0 {
+		t.Fatal("spooled item should be dropped")
+	}
+	if perShard[rq.shards[0].delaySetKey]+perShard[rq.shards[1].delaySetKey] != len(values) {
+		t.Fatalf("unexpected per-shard values %v", perShard)
+	}
+}
+
+// TestBulkCancel_RedisPrefixScan 前缀取消对每个分片的 delay 与 doing 集循环 ZSCAN 直到游标归零，模式中的 glob 字符被转义
+func TestBulkCancel_RedisPrefixScan(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "rprefix", WithRedisScriptBuilder(b), WithRedisShards(2)).(*redisQueue)
+	var scanned []string
+	b.scripts[idxCancelPrefix].evalShaFn = func(_ context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		scanned = append(scanned, keys[0]+"@"+args[0].(string))
+		if args[1] != `a\*b\?*` || string(args[2].([]byte)) != "a*b?" {
+			t.Errorf("unexpected pattern/prefix %v %s", args[1], args[2])
+		}
+		if args[0] == "0" {
+			return []interface{}{"17", int64(2)}, nil
+		}
+		return []interface{}{"0", int64(1)}, nil
+	}
+	n, err := rq.cancelByPrefix([]byte("a*b?"))
+	if err != nil || n != 12 {
+		t.Fatalf("want 12 got %d err=%v", n, err)
+	}
+	want := []string{
+		rq.shards[0].delaySetKey + "@0", rq.shards[0].delaySetKey + "@17",
+		rq.shards[0].doingSetKey + "@0", rq.shards[0].doingSetKey + "@17",
+		rq.shards[1].delaySetKey + "@0", rq.shards[1].delaySetKey + "@17",
+		rq.shards[1].doingSetKey + "@0", rq.shards[1].doingSetKey + "@17",
+	}
+	if strings.Join(scanned, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected scan order %v", scanned)
+	}
+}
+
+// TestBulkCancel_RedisPurge 清空按分片累计 delay 与 doing 中的 item 数，错误时返回已清除部分
+func TestBulkCancel_RedisPurge(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "rpurge", WithRedisScriptBuilder(b), WithRedisShards(3)).(*redisQueue)
+	var calls int
+	b.scripts[idxPurge].evalShaFn = func(_ context.Context, keys []string, _ ...interface{}) ([]interface{}, error) {
+		calls++
+		if len(keys) != 5 || keys[2] != rq.shards[calls-1].failedHashKey || keys[4] != rq.shards[calls-1].seqHashKey {
+			t.Errorf("unexpected keys %v", keys)
+		}
+		if calls == 3 {
+			return nil, errors.New("boom")
+		}
+		return []interface{}{int64(5)}, nil
+	}
+	if n, err := rq.purge(); err == nil || n != 10 {
+		t.Fatalf("want partial count 10 with error, got %d err=%v", n, err)
+	}
+}
+
+// TestBulkCancel_SQL SQL 后端批量取消使用 IN 列表，前缀取消在进程内过滤后按 id 删除，清空按 topic 删除
+func TestBulkCancel_SQL(t *testing.T) {
+	f, db := newFakeSQL()
+	q := newSQLTopicQueue(context.Background(), db, SQLDialectPostgres, "sql-bulk", newConfig())
+	f.handle = func(query string, args []driver.Value) ([]string, [][]driver.Value, int64, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT id, payload"):
+			return []string{"id", "payload"}, [][]driver.Value{
+				{int64(1), []byte("job:1")}, {int64(2), []byte("other")}, {int64(3), []byte("job:2")},
+			}, 0, nil
+		case strings.HasPrefix(query, "DELETE"):
+			return nil, nil, int64(len(args) - 1), nil
+		}
+		return nil, nil, 0, nil
+	}
+	if n, err := q.cancelBatch([][]byte{[]byte("a"), []byte("b")}); err != nil || n != 2 {
+		t.Fatalf("cancelBatch: n=%d err=%v", n, err)
+	}
+	if c := f.callsMatching("payload IN ($2, $3)"); len(c) != 1 || c[0].args[0] != "sql-bulk" {
+		t.Fatalf("expected rebound IN list, calls=%v", f.callsMatching("DELETE"))
+	}
+	if _, err := q.cancelByPrefix([]byte("job:")); err != nil {
+		t.Fatal(err)
+	}
+	c := f.callsMatching("WHERE id IN")
+	if len(c) != 1 || len(c[0].args) != 2 || c[0].args[0] != int64(1) || c[0].args[1] != int64(3) {
+		t.Fatalf("prefix should delete ids 1 and 3, calls=%v", c)
+	}
+	if _, err := q.purge(); err != nil {
+		t.Fatal(err)
+	}
+	if c = f.callsMatching("DELETE"); c[len(c)-1].query != "DELETE FROM delayq_items WHERE topic = $1" {
+		t.Fatalf("purge should delete by topic, calls=%v", f.callsMatching("DELETE"))
+	}
+}
+
+// TestBulkCancel_FallbackAndUnsupported 外部 TopicQueue 不支持批量取消时 CancelBatch 逐个 Cancel，其余返回 ErrBulkCancelUnsupported
+func TestBulkCancel_FallbackAndUnsupported(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	tq := &cancelOnlyTopicQueue{TopicQueue: NewMemoryTopicQueue(context.Background(), "ext")}
+	if err := q.StartTopicQueue(tq, func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"x", "y"} {
+		if err := q.Push(&Item{Topic: "ext", Value: []byte(v), DelaySecond: 30}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := q.CancelBatch("ext", [][]byte{[]byte("x"), []byte("y"), []byte("z")}); err != nil || n != 2 || tq.cancels != 3 {
+		t.Fatalf("fallback: n=%d err=%v cancels=%d", n, err, tq.cancels)
+	}
+	if _, err := q.CancelByPrefix("ext", []byte("x")); !errors.Is(err, ErrBulkCancelUnsupported) {
+		t.Fatalf("want ErrBulkCancelUnsupported got %v", err)
+	}
+	if _, err := q.Purge("ext"); !errors.Is(err, ErrBulkCancelUnsupported) {
+		t.Fatalf("want ErrBulkCancelUnsupported got %v", err)
+	}
+}
+
+// cancelOnlyTopicQueue 只暴露 TopicQueue 接口的包装，用于模拟外部实现
+type cancelOnlyTopicQueue struct {
+	TopicQueue
+	cancels int
+}
+
+func (q *cancelOnlyTopicQueue) Cancel(value []byte) (bool, error) {
+	q.cancels++
+	return q.TopicQueue.Cancel(value)
+}
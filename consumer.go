@@ -0,0 +1,296 @@
+package delayq
+
+import (
+	"sync"
+	"time"
+)
+
+// leaseLua 登记/续约消费者租约，score 为租约到期时间戳；expire_at=0 表示立即释放
+var leaseLua = `
+local consumer_set = KEYS[1]
+local consumer, expire_at = ARGV[1], ARGV[2]
+redis.call('ZADD', consumer_set, expire_at, consumer)
+return {true}
+`
+
+// releaseOwnerLua 定义需要清除归属的脚本共用的函数，以它为前缀拼接：
+//   - owned_sets(owner_hash, first)：把 KEYS[first..] 中由调用方声明的持有集 key 按消费者名建立索引，
+//     消费者名为 key 去掉 owner_hash..':' 前缀的部分（与 redisShard.ownedSetKey 一致）
+//   - release_owner(owner_hash, owned, value)：清除 value 的归属记录，原消费者的持有集已声明时从中移除；
+//     未声明时（poll/ack 只声明本实例的持有集，取消等路径使用的消费者列表缓存可能滞后）持有集中留下过期成员，
+//     由 ownedCount 与 leaseReclaim 按归属记录剔除
+//
+// 脚本只访问 KEYS 中声明的 key，满足 Redis Cluster 的脚本规则与按 KEYS 路由的代理。
+var releaseOwnerLua = `
+local function owned_sets(owner_hash, first)
+	local owned = {}
+	for i = first, #KEYS do
+		owned[string.sub(KEYS[i], #owner_hash + 2)] = KEYS[i]
+	end
+	return owned
+end
+local function release_owner(owner_hash, owned, value)
+	local c = redis.call('HGET', owner_hash, value)
+	if c then
+		redis.call('HDEL', owner_hash, value)
+		if owned[c] then
+			redis.call('SREM', owned[c], value)
+		end
+	end
+end
+`
+
+// leaseReclaimLua 把租约已过期消费者持有的 doing 集 item 立即搬回 delay 集（score=now），
+// 并清除其归属记录、持有集与租约登记。KEYS[5..] 为调用方声明的待检查消费者持有集，
+// 脚本内再次确认租约已过期（期间续约的消费者跳过）；只读取过期消费者的持有集，开销与其持有的 item 数成正比。
+// 返回被搬回的 value 列表。
+var leaseReclaimLua = `
+local doing_set, delay_set, owner_hash, consumer_set = KEYS[1], KEYS[2], KEYS[3], KEYS[4]
+local now = ARGV[1]
+local out = {}
+for i = 5, #KEYS do
+	local owned = KEYS[i]
+	local c = string.sub(owned, #owner_hash + 2)
+	local expire_at = redis.call('ZSCORE', consumer_set, c)
+	if expire_at and tonumber(expire_at) < tonumber(now) then
+		redis.call('ZREM', consumer_set, c)
+		for _, v in ipairs(redis.call('SMEMBERS', owned)) do
+			if redis.call('HGET', owner_hash, v) == c then
+				redis.call('HDEL', owner_hash, v)
+				if redis.call('ZSCORE', doing_set, v) then
+					redis.call('ZREM', doing_set, v)
+					redis.call('ZADD', delay_set, now, v)
+					table.insert(out, v)
+				end
+			end
+		end
+		redis.call('DEL', owned)
+	end
+end
+return out
+`
+
+// consumersLua 返回已登记的消费者及其租约到期时间 [consumer, expire_at, consumer, expire_at, ...]
+var consumersLua = `
+return redis.call('ZRANGE', KEYS[1], 0, -1, 'WITHSCORES')
+`
+
+// ownedCountLua 按 KEYS[2..] 的顺序返回各持有集中仍归属该消费者的 item 数，
+// 并剔除归属已被其他实例清除的过期成员
+var ownedCountLua = `
+local owner_hash = KEYS[1]
+local out = {}
+for i = 2, #KEYS do
+	local c = string.sub(KEYS[i], #owner_hash + 2)
+	local n = 0
+	for _, v in ipairs(redis.call('SMEMBERS', KEYS[i])) do
+		if redis.call('HGET', owner_hash, v) == c then
+			n = n + 1
+		else
+			redis.call('SREM', KEYS[i], v)
+		end
+	end
+	table.insert(out, n)
+end
+return out
+`
+
+// defaultConsumerLeaseTTL ConsumerLeaseTTL<=0 时的默认租约有效期
+const defaultConsumerLeaseTTL = 30 * time.Second
+
+// consumerLeaseTTL 返回消费者租约有效期；<=0 时回退到默认值
+func (q *redisQueue) consumerLeaseTTL() time.Duration {
+	if d := q.opts.GetConsumerLeaseTTL(); d > 0 {
+		return d
+	}
+	return defaultConsumerLeaseTTL
+}
+
+// leaseRenewInterval 返回租约续约间隔：TTL/3，不少于 1s
+func (q *redisQueue) leaseRenewInterval() time.Duration {
+	d := q.consumerLeaseTTL() / 3
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// renewLease 在每个分片登记/续约本实例的消费者租约，由 ticker 周期调用
+func (q *redisQueue) renewLease() error {
+	ttl := int64(q.consumerLeaseTTL() / time.Second)
+	if ttl <= 0 {
+		ttl = 1
+	}
+	expireAt := unix() + ttl
+	var firstErr error
+	for _, sh := range q.shards {
+		if _, err := q.runScript(q.opCtx(), q.leaseScript, []string{sh.consumerSetKey}, q.consumerID, expireAt); err != nil {
+			q.monitorCount(MetricConsumerLeaseError)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// releaseLease 把本实例在每个分片的租约置为已过期，其他实例的 reclaim 会立即接手本实例持有的 item
+func (q *redisQueue) releaseLease() {
+	for _, sh := range q.shards {
+		if _, err := q.runScript(q.opCtx(), q.leaseScript, []string{sh.consumerSetKey}, q.consumerID, int64(0)); err != nil {
+			q.log.Warnf("topic=%s consumer=%s release lease error: %v", q.topic, q.consumerID, err)
+		}
+	}
+}
+
+// consumerCache 各分片已登记消费者列表的本地缓存，按续约间隔刷新
+type consumerCache struct {
+	mu      sync.Mutex
+	entries map[*redisShard]consumerCacheEntry
+}
+
+type consumerCacheEntry struct {
+	names []string
+	at    time.Time
+}
+
+// get 返回分片缓存的消费者列表，以及缓存是否在 maxAge 内刷新过
+func (c *consumerCache) get(sh *redisShard, maxAge time.Duration) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[sh]
+	return e.names, ok && time.Since(e.at) < maxAge
+}
+
+// store 更新分片的消费者列表与刷新时间
+func (c *consumerCache) store(sh *redisShard, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[*redisShard]consumerCacheEntry)
+	}
+	c.entries[sh] = consumerCacheEntry{names: names, at: time.Now()}
+}
+
+// shardConsumers 读取分片登记的消费者及其租约到期时间（秒），并刷新本地缓存
+func (q *redisQueue) shardConsumers(sh *redisShard) ([]string, []int64, error) {
+	res, err := q.runScript(q.opCtx(), q.consumersScript, []string{sh.consumerSetKey})
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	var expires []int64
+	for i := 0; i+1 < len(res); i += 2 {
+		c, ok := res[i].(string)
+		if !ok {
+			continue
+		}
+		names = append(names, c)
+		expires = append(expires, int64(parseFloat64(res[i+1])))
+	}
+	q.consumers.store(sh, names)
+	return names, expires, nil
+}
+
+// ownedSetKeys 返回分片中本实例与各已登记消费者的持有集 key，由需要清除或登记归属的脚本追加到 KEYS 末尾。
+// 消费者列表按续约间隔缓存，过期时重新读取，读取失败时沿用旧列表
+func (q *redisQueue) ownedSetKeys(sh *redisShard) []string {
+	names, fresh := q.consumers.get(sh, q.leaseRenewInterval())
+	if !fresh {
+		if latest, _, err := q.shardConsumers(sh); err == nil {
+			names = latest
+		} else {
+			q.consumers.store(sh, names)
+		}
+	}
+	keys := make([]string, 0, len(names)+1)
+	if q.consumerID != "" {
+		keys = append(keys, sh.ownedSetKey(q.consumerID))
+	}
+	for _, c := range names {
+		if c != q.consumerID {
+			keys = append(keys, sh.ownedSetKey(c))
+		}
+	}
+	return keys
+}
+
+// withOwnedSetKeys 在 keys 末尾追加分片各消费者的持有集 key，用于归属者未知的取消、清空与 visibility reclaim
+func (q *redisQueue) withOwnedSetKeys(sh *redisShard, keys ...string) []string {
+	return append(keys, q.ownedSetKeys(sh)...)
+}
+
+// withOwnSetKey 在 keys 末尾追加本实例的持有集 key（未启用 ConsumerID 时不追加）。
+// 用于 poll 与 ack：item 由本实例认领，归属者已知，热路径不读取消费者列表
+func (q *redisQueue) withOwnSetKey(sh *redisShard, keys ...string) []string {
+	if q.consumerID == "" {
+		return keys
+	}
+	return append(keys, sh.ownedSetKey(q.consumerID))
+}
+
+// reclaimExpiredConsumers 立即回收租约已过期消费者持有的 item：读取登记的消费者，
+// 只把租约已过期者的持有集声明给 leaseReclaim 脚本；没有过期消费者时不执行脚本
+func (q *redisQueue) reclaimExpiredConsumers(sh *redisShard, now int64) error {
+	names, expires, err := q.shardConsumers(sh)
+	if err != nil {
+		q.monitorCount(MetricReclaimError)
+		return err
+	}
+	keys := []string{sh.doingSetKey, sh.delaySetKey, sh.ownerHashKey, sh.consumerSetKey}
+	for i, c := range names {
+		if expires[i] < now {
+			keys = append(keys, sh.ownedSetKey(c))
+		}
+	}
+	if len(keys) == 4 {
+		return nil
+	}
+	res, err := q.runScript(q.opCtx(), q.leaseReclaimScript, keys, now)
+	if err != nil {
+		q.monitorCount(MetricReclaimError)
+		return err
+	}
+	if len(res) > 0 {
+		q.log.Infof("topic=%s reclaimed %d items from expired consumers", q.topic, len(res))
+		q.monitorCount(MetricConsumerReclaim, len(res))
+		q.notifyReclaimed(q.reclaimedValues(res, 1))
+	}
+	return nil
+}
+
+// consumerInFlight 返回每个已登记消费者当前持有的 item 数（所有分片之和）；
+// 未启用 ConsumerID 时返回 nil
+func (q *redisQueue) consumerInFlight() map[string]int64 {
+	if q.consumerID == "" {
+		return nil
+	}
+	out := make(map[string]int64)
+	for _, sh := range q.shards {
+		names, _, err := q.shardConsumers(sh)
+		if err != nil {
+			q.log.Errorf("topic=%s consumers status error: %v", q.topic, err)
+			return nil
+		}
+		if len(names) == 0 {
+			continue
+		}
+		keys := []string{sh.ownerHashKey}
+		for _, c := range names {
+			keys = append(keys, sh.ownedSetKey(c))
+		}
+		res, err := q.runScript(q.opCtx(), q.ownedCountScript, keys)
+		if err != nil {
+			q.log.Errorf("topic=%s consumers status error: %v", q.topic, err)
+			return nil
+		}
+		for i, c := range names {
+			var n int64
+			if i < len(res) {
+				n = parseInt64(res[i])
+			}
+			out[c] += n
+		}
+	}
+	return out
+}
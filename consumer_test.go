@@ -0,0 +1,223 @@
+package delayq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 消费者租约相关脚本在 newRedisTopicQueue 中的注册顺序索引
+const (
+	idxLease        = 9
+	idxLeaseReclaim = 10
+	idxConsumers    = 11
+	idxOwnedCount   = 22
+)
+
+// TestConsumerLease_Interval 默认 TTL=30s，续约间隔 TTL/3 且不少于 1s
+func TestConsumerLease_Interval(t *testing.T) {
+	cases := []struct {
+		ttl       time.Duration
+		wantTTL   time.Duration
+		wantRenew time.Duration
+	}{
+		{0, 30 * time.Second, 10 * time.Second},
+		{-1, 30 * time.Second, 10 * time.Second},
+		{9 * time.Second, 9 * time.Second, 3 * time.Second},
+		{2 * time.Second, 2 * time.Second, time.Second},
+	}
+	for _, c := range cases {
+		tp := NewRedisTopicQueue(context.Background(), "lease-iv",
+			WithRedisScriptBuilder(&fakeScriptBuilder{}),
+			WithConsumerID("c1"),
+			WithConsumerLeaseTTL(c.ttl),
+		)
+		rq := tp.(*redisQueue)
+		if got := rq.consumerLeaseTTL(); got != c.wantTTL {
+			t.Errorf("ttl=%v want ttl=%v got=%v", c.ttl, c.wantTTL, got)
+		}
+		if got := rq.leaseRenewInterval(); got != c.wantRenew {
+			t.Errorf("ttl=%v want renew=%v got=%v", c.ttl, c.wantRenew, got)
+		}
+	}
+}
+
+// TestConsumerLease_PollClaimsOwnership poll 把本实例 ID 传给 pollScript 登记归属，并在 KEYS 末尾声明本实例的持有集
+func TestConsumerLease_PollClaimsOwnership(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "lease-claim",
+		WithRedisScriptBuilder(b),
+		WithConsumerID("pod-a"),
+	)
+	rq := tp.(*redisQueue)
+	var keys []string
+	var consumer interface{}
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, k []string, args ...interface{}) ([]interface{}, error) {
+		keys, consumer = k, args[3]
+		return []interface{}{}, nil
+	}
+	if err := rq.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 7 || keys[3] != "__dq:owner:{lease-claim}" || keys[6] != "__dq:owner:{lease-claim}:pod-a" {
+		t.Fatalf("unexpected poll keys: %v", keys)
+	}
+	if consumer != "pod-a" {
+		t.Fatalf("want consumer pod-a got %v", consumer)
+	}
+}
+
+// TestConsumerLease_DisabledByDefault 未配置 ConsumerID 时不登记归属、不启动租约续约
+func TestConsumerLease_DisabledByDefault(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "lease-off", WithRedisScriptBuilder(b))
+	rq := tp.(*redisQueue)
+	stubAllScriptsOK(b)
+	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	if n := len(rq.tickers()); n != 2 {
+		t.Fatalf("want 2 tickers got %d", n)
+	}
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	if c := b.scripts[idxLeaseReclaim].evalShaCalls; c != 0 {
+		t.Fatalf("lease reclaim should not run, calls=%d", c)
+	}
+	if cs := rq.consumerInFlight(); cs != nil {
+		t.Fatalf("want nil consumers got %v", cs)
+	}
+}
+
+// TestConsumerLease_ReclaimExpired reclaim 读取登记的消费者，只声明租约已过期者的持有集，立即回收其持有的 item 并计数
+func TestConsumerLease_ReclaimExpired(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	var reclaimed int64
+	tp := NewRedisTopicQueue(context.Background(), "lease-reclaim",
+		WithRedisScriptBuilder(b),
+		WithConsumerID("pod-a"),
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			if metric == MetricConsumerReclaim {
+				atomic.AddInt64(&reclaimed, value)
+			}
+		}),
+	)
+	rq := tp.(*redisQueue)
+	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	now := unix()
+	b.scripts[idxConsumers].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"pod-b", fmt.Sprint(now - 10), "pod-a", fmt.Sprint(now + 30)}, nil
+	}
+	var gotNow int64
+	b.scripts[idxLeaseReclaim].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		if len(keys) != 5 || keys[3] != "__dq:consumers:{lease-reclaim}" || keys[4] != "__dq:owner:{lease-reclaim}:pod-b" {
+			t.Errorf("unexpected keys: %v", keys)
+		}
+		atomic.StoreInt64(&gotNow, args[0].(int64))
+		return []interface{}{"x", "y", "z"}, nil
+	}
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	if v := atomic.LoadInt64(&reclaimed); v != 3 {
+		t.Fatalf("want 3 reclaimed got %d", v)
+	}
+	if n := atomic.LoadInt64(&gotNow); n < now-2 || n > now+2 {
+		t.Fatalf("lease reclaim should use now, got %d (now=%d)", n, now)
+	}
+
+	// 没有过期消费者时不执行 leaseReclaim
+	b.scripts[idxConsumers].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"pod-a", fmt.Sprint(now + 30)}, nil
+	}
+	calls := b.scripts[idxLeaseReclaim].evalShaCalls
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	if c := b.scripts[idxLeaseReclaim].evalShaCalls; c != calls {
+		t.Fatalf("lease reclaim should be skipped without expired consumers, calls=%d", c-calls)
+	}
+}
+
+// TestConsumerLease_RenewAndRelease 续约 score=now+TTL，Close 时 score 置 0 立即释放
+func TestConsumerLease_RenewAndRelease(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "lease-renew",
+		WithRedisScriptBuilder(b),
+		WithConsumerID("pod-a"),
+		WithConsumerLeaseTTL(12*time.Second),
+	)
+	rq := tp.(*redisQueue)
+	stubAllScriptsOK(b)
+	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	b.scripts[idxLeaseReclaim].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	var mu sync.Mutex
+	var expires []int64
+	b.scripts[idxLease].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		if args[0] != "pod-a" {
+			t.Errorf("unexpected consumer %v", args[0])
+		}
+		mu.Lock()
+		expires = append(expires, args[1].(int64))
+		mu.Unlock()
+		return []interface{}{true}, nil
+	}
+	if n := len(rq.tickers()); n != 3 {
+		t.Fatalf("want 3 tickers got %d", n)
+	}
+	now := unix()
+	if err := rq.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 2000, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(expires) >= 1
+	})
+	if err := rq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if d := expires[0] - now; d < 11 || d > 13 {
+		t.Fatalf("renew should set now+12, got diff=%d", d)
+	}
+	if last := expires[len(expires)-1]; last != 0 {
+		t.Fatalf("close should release lease with 0, got %d", last)
+	}
+}
+
+// TestConsumerLease_InFlightStatus Status 汇总每个消费者持有的 item 数，持有集 key 通过 KEYS 声明
+func TestConsumerLease_InFlightStatus(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "lease-status",
+		WithRedisScriptBuilder(b),
+		WithConsumerID("pod-a"),
+	)
+	rq := tp.(*redisQueue)
+	b.scripts[idxConsumers].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"pod-a", "100", "pod-b", "200"}, nil
+	}
+	b.scripts[idxOwnedCount].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		if got := fmt.Sprint(keys); got != "[__dq:owner:{lease-status} __dq:owner:{lease-status}:pod-a __dq:owner:{lease-status}:pod-b]" {
+			t.Errorf("unexpected ownedCount keys %s", got)
+		}
+		return []interface{}{int64(3), int64(0)}, nil
+	}
+	cs := rq.consumerInFlight()
+	if len(cs) != 2 || cs["pod-a"] != 3 || cs["pod-b"] != 0 {
+		t.Fatalf("unexpected consumers: %v", cs)
+	}
+}
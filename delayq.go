@@ -15,6 +15,7 @@ package delayq
 import (
 	"context"
 	"errors"
+	"io"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -36,6 +37,20 @@ var (
 	ErrRateLimited = errors.New("push rate limited")
 	// ErrDraining Drain 期间拒绝新 push
 	ErrDraining = errors.New("queue is draining")
+	// ErrSpoolFull Redis 不可用且本地缓冲已满，Push 被拒绝
+	ErrSpoolFull = errors.New("push spool is full")
+	// ErrBackendUnavailable Redis 熔断打开，调用被直接拒绝
+	ErrBackendUnavailable = errors.New("backend unavailable: circuit breaker open")
+	// ErrExportUnsupported topic 队列的后端不支持 Export/Import
+	ErrExportUnsupported = errors.New("topic queue does not support export/import")
+	// ErrPeekUnsupported topic 队列的后端不支持 Peek
+	ErrPeekUnsupported = errors.New("topic queue does not support peek")
+	// ErrBulkCancelUnsupported topic 队列的后端不支持 CancelByPrefix/Purge
+	ErrBulkCancelUnsupported = errors.New("topic queue does not support bulk cancel")
+	// ErrHistoryUnsupported 未配置 HistorySize 或 topic 队列的后端不支持 History
+	ErrHistoryUnsupported = errors.New("topic queue does not support item history or history is disabled")
+	// ErrForecastUnsupported topic 队列的后端不支持 Forecast
+	ErrForecastUnsupported = errors.New("topic queue does not support forecast")
 )
 
 // Status 延迟队列汇总状态
@@ -44,6 +59,23 @@ type Status struct {
 	QueueLength map[string]int64
 	// InFlight 每个 topic 当前正在执行 handler 的 goroutine 数
 	InFlight map[string]int64
+	// Consumers 每个 topic 下各消费者实例（ConsumerID）当前持有的 doing 集 item 数；
+	// 仅 Redis 后端且配置了 WithConsumerID 的 topic 有值
+	Consumers map[string]map[string]int64
+	// Spooled 每个 topic 本地缓冲中等待补写到 Redis 的 item 数；仅配置了 WithSpoolSize 的 Redis topic 有值
+	Spooled map[string]int64
+	// MaxLateness 每个 topic 最近 1~2 分钟内派发的最大延迟（实际派发时间 - 计划执行时间）
+	MaxLateness map[string]time.Duration
+	// Doing 每个 topic 已派发、等待 ack 的 item 数（doing 集）；仅 Redis / SQL / 分层队列有值
+	Doing map[string]int64
+	// Dead 每个 topic 死信集中的 item 数；仅 Redis / 分层队列有值
+	Dead map[string]int64
+	// Overdue 每个 topic 已到计划执行时间但仍在等待派发的 item 数（QueueLength 的子集）
+	Overdue map[string]int64
+	// OldestOverdue 每个 topic 最早的已到期未派发 item 超过计划执行时间的时长；没有到期 item 时为 0
+	OldestOverdue map[string]time.Duration
+	// NextDue 每个 topic 下一个未到期 item 的计划执行时间；没有未到期 item 的 topic 不出现
+	NextDue map[string]time.Time
 }
 
 // Queue 多 topic 延迟队列外观接口。通过 New 创建。
@@ -60,6 +92,23 @@ type Queue interface {
 	Get(topic string, value []byte) (remaining time.Duration, exists bool, err error)
 	// Cancel 取消指定 topic 中所有匹配 value 的 item
 	Cancel(topic string, value []byte) (canceled bool, err error)
+	// CancelBatch 取消指定 topic 中匹配任一 value 的 item，返回取消数量
+	CancelBatch(topic string, values [][]byte) (int64, error)
+	// CancelByPrefix 取消指定 topic 中 value 以 prefix 开头的 item，返回取消数量
+	CancelByPrefix(topic string, prefix []byte) (int64, error)
+	// Purge 清空指定 topic 中等待执行、执行中与失败计数，返回清除数量
+	Purge(topic string) (int64, error)
+	// Export 把 topic 中等待执行的 item 以 JSON Lines 写入 w（含绝对执行时间与已失败次数），返回导出条数
+	Export(topic string, w io.Writer) (int, error)
+	// Import 读取 Export 产生的流并按原执行时间重新入队到 topic，返回入队条数
+	Import(topic string, r io.Reader, mode ImportMode) (int, error)
+	// Peek 浏览 topic 中指定状态的 item 及其计划时间、失败次数与优先级（只读，分页）
+	Peek(topic string, opts PeekOptions) (PeekResult, error)
+	// History 返回 topic 中 value 对应 item 的生命周期历史（需配置 WithHistorySize）
+	History(topic string, value []byte) ([]HistoryEvent, error)
+	// Forecast 返回 topic 在升序 buckets 划分的各区间 (now+buckets[i-1], now+buckets[i]] 内将要到期的 item 数，
+	// 结果与 buckets 一一对应
+	Forecast(topic string, buckets []time.Duration) ([]int64, error)
 	// Start 启动指定主题的延迟队列；handler 返回 error 触发重试
 	Start(topic string, f func(*Item) error) error
 	// StartManualAck 启动指定主题的延迟队列（手动 ack 模式）；handler 必须显式 Ack/Nack
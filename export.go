@@ -0,0 +1,345 @@
+package delayq
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// exportLua 按排名分页读取 delay 集，同时返回失败计数。
+// score 优先取 seq hash 中记录的计划执行 score，被 reclaim 放回的 item 导出原执行时间。
+// 返回 [value, score, failed, value, score, failed, ...]
+var exportLua = `
+local delay_set, failed_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3]
+local offset, count = tonumber(ARGV[1]), tonumber(ARGV[2])
+local items = redis.call('ZRANGE', delay_set, offset, offset + count - 1, 'WITHSCORES')
+local out = {}
+for i = 1, #items, 2 do
+	table.insert(out, items[i])
+	table.insert(out, redis.call('HGET', seq_hash, 'e:' .. items[i]) or items[i+1])
+	table.insert(out, tonumber(redis.call('HGET', failed_hash, items[i]) or 0))
+end
+return out
+`
+
+// importLua 把若干 (value, score, failed) 写入 delay 集并恢复失败计数，按参数顺序分配入队序号，
+// score 同时记为计划执行时间。
+// ARGV: value1, score1, failed1, value2, score2, failed2, ...
+var importLua = `
+local delay_set, failed_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3]
+local n = #ARGV / 3
+local base = redis.call('HINCRBY', seq_hash, 'n', n) - n
+for i = 1, #ARGV, 3 do
+	local v, s, f = ARGV[i], ARGV[i+1], tonumber(ARGV[i+2])
+	redis.call('ZADD', delay_set, s, v)
+	redis.call('HSET', seq_hash, 'v:' .. v, base + (i + 2) / 3, 'e:' .. v, s)
+	if f > 0 then
+		redis.call('HSET', failed_hash, v, f)
+	else
+		redis.call('HDEL', failed_hash, v)
+	end
+end
+return {true}
+`
+
+// exportPageSize Redis 导出时每次读取的 item 数；同时作为 Import 每批入队的条数
+const exportPageSize = 256
+
+// ExportRecord Export/Import 流中的一条记录，流格式为 JSON Lines（每行一条记录）
+type ExportRecord struct {
+	// Topic 导出时所在的 topic；Import 时忽略，以目标 topic 为准
+	Topic string `json:"topic"`
+	// Value item 内容（JSON 中为 base64）
+	Value []byte `json:"value"`
+	// Priority item 优先级
+	Priority int32 `json:"priority,omitempty"`
+	// ExecuteAt 绝对执行时间（unix 毫秒）
+	ExecuteAt int64 `json:"execute_at"`
+	// Attempts 已失败次数
+	Attempts int64 `json:"attempts,omitempty"`
+}
+
+// ImportMode Import 遇到队列中已存在相同 value 的 item 时的处理方式
+type ImportMode int
+
+const (
+	// ImportAppend 不检查直接入队（Redis 中相同 value 会覆盖原执行时间，内存中会产生重复 item）
+	ImportAppend ImportMode = iota
+	// ImportSkipExisting 队列中已存在相同 value 时跳过该记录
+	ImportSkipExisting
+	// ImportReplace 先取消队列中相同 value 的 item 再入队
+	ImportReplace
+)
+
+// snapshotter 支持 Export/Import 的 TopicQueue 实现
+type snapshotter interface {
+	// exportRecords 依次把等待执行的 item 交给 emit
+	exportRecords(emit func(*ExportRecord) error) error
+	// importRecords 按记录中的绝对执行时间与失败次数入队，不检查限流与 drain
+	importRecords(recs []*ExportRecord) error
+}
+
+// Export 把 topic 中等待执行的 item 以 JSON Lines 写入 w，记录绝对执行时间与已失败次数，返回导出条数。
+// 正在执行（doing）的 item 不导出。topic 未启动或后端不支持时返回错误。
+func (q *queue) Export(topic string, w io.Writer) (int, error) {
+	sn, err := q.snapshotter(topic)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	err = sn.exportRecords(func(rec *ExportRecord) error {
+		n++
+		return enc.Encode(rec)
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// Import 读取 Export 产生的流，按原绝对执行时间（已过期的立即到期）与失败次数重新入队，返回入队条数。
+// 记录中的 topic 被忽略，全部导入到 topic；mode 决定已存在相同 value 时的处理方式。
+func (q *queue) Import(topic string, r io.Reader, mode ImportMode) (int, error) {
+	sn, err := q.snapshotter(topic)
+	if err != nil {
+		return 0, err
+	}
+	tq := sn.(TopicQueue)
+	dec := json.NewDecoder(r)
+	imported := 0
+	batch := make([]*ExportRecord, 0, exportPageSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := sn.importRecords(batch); err != nil {
+			return err
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		rec := &ExportRecord{}
+		if err = dec.Decode(rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return imported, err
+		}
+		switch mode {
+		case ImportSkipExisting:
+			_, exists, gerr := tq.Get(rec.Value)
+			if gerr != nil {
+				return imported, gerr
+			}
+			if exists {
+				continue
+			}
+		case ImportReplace:
+			if _, cerr := tq.Cancel(rec.Value); cerr != nil {
+				return imported, cerr
+			}
+		}
+		batch = append(batch, rec)
+		if len(batch) == exportPageSize {
+			if err = flush(); err != nil {
+				return imported, err
+			}
+		}
+	}
+	return imported, flush()
+}
+
+// snapshotter 返回已启动 topic 的 Export/Import 实现
+func (q *queue) snapshotter(topic string) (snapshotter, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return nil, ErrTopicQueueHasClosed
+	}
+	sn, ok := val.(snapshotter)
+	if !ok {
+		return nil, ErrExportUnsupported
+	}
+	return sn, nil
+}
+
+// recordItem 由导入记录构造 item；已失败次数以负 DelaySecond 编码，与重试 item 一致
+func recordItem(topic string, rec *ExportRecord) *Item {
+	item := &Item{Topic: topic, Value: rec.Value, Priority: rec.Priority}
+	if rec.Attempts > 0 {
+		item.DelaySecond = -rec.Attempts
+	}
+	return item
+}
+
+// recordDelaySecond 返回距离 execAt（unix 毫秒）的剩余秒数，向上取整，已过期为 0
+func recordDelaySecond(execAt int64) int64 {
+	remain := execAt - nowFunc().UnixMilli()
+	if remain <= 0 {
+		return 0
+	}
+	return (remain + 999) / 1000
+}
+
+// exportRecords 逐个分片在持锁下遍历时间轮收集未取消的节点，释放锁后再逐条输出。
+// ExecuteAt 为节点的原计划执行时间。亚秒重试中的 item 不在时间轮上，不导出。
+func (q *memQueue) exportRecords(emit func(*ExportRecord) error) error {
+	var recs []*ExportRecord
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		sh.wheel.each(func(p *wheelNode) {
+			if p.canceled {
+				return
+			}
+			rec := &ExportRecord{
+				Topic:     q.topic,
+				Value:     p.item.GetValue(),
+				Priority:  p.item.GetPriority(),
+				ExecuteAt: p.execAt,
+			}
+			if d := p.item.GetDelaySecond(); d < 0 {
+				rec.Attempts = -d
+			}
+			recs = append(recs, rec)
+		})
+		sh.mx.Unlock()
+	}
+	for _, rec := range recs {
+		if err := emit(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importRecords 把记录插入时间轮
+func (q *memQueue) importRecords(recs []*ExportRecord) error {
+	if q.isClosed() {
+		return ErrTopicQueueHasClosed
+	}
+	return q.insertRecords(recs)
+}
+
+// insertRecords 按记录中的绝对执行时间插入时间轮，节点保留原执行时间；启用 journal 时先记录
+func (q *memQueue) insertRecords(recs []*ExportRecord) error {
+	items := make([]*Item, len(recs))
+	delays := make([]int64, len(recs))
+	execAts := make([]int64, len(recs))
+	for i, rec := range recs {
+		items[i] = recordItem(q.topic, rec)
+		delays[i] = recordDelaySecond(rec.ExecuteAt)
+		execAts[i] = rec.ExecuteAt
+	}
+	if q.journal != nil {
+		ds := make([]time.Duration, len(delays))
+		for i, d := range delays {
+			ds[i] = time.Duration(d) * time.Second
+		}
+		if err := q.journalPush(items, ds); err != nil {
+			return err
+		}
+	}
+	q.insertAt(items, delays, execAts)
+	return nil
+}
+
+// exportRecords 导出本地缓冲与各分片 delay 集中的 item；分页按排名读取，
+// 导出期间有 item 入队或到期时可能遗漏或重复个别 item。
+func (q *redisQueue) exportRecords(emit func(*ExportRecord) error) error {
+	if q.spool != nil {
+		for _, it := range q.spool.peek(q.spool.len()) {
+			rec := &ExportRecord{
+				Topic:     q.topic,
+				Value:     it.GetValue(),
+				Priority:  it.GetPriority(),
+				ExecuteAt: it.GetDelaySecond() * 1000,
+			}
+			if err := emit(rec); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sh := range q.shards {
+		for offset := 0; ; offset += exportPageSize {
+			res, err := q.runScript(q.opCtx(), q.exportScript,
+				[]string{sh.delaySetKey, sh.failedHashKey, sh.seqHashKey}, offset, exportPageSize)
+			if err != nil {
+				return err
+			}
+			for i := 0; i+2 < len(res); i += 3 {
+				val, ok := res[i].(string)
+				if !ok {
+					continue
+				}
+				score := parseFloat64(res[i+1])
+				execTs := scoreToExecTs(score)
+				rec := &ExportRecord{
+					Topic:     q.topic,
+					Value:     []byte(val),
+					Priority:  priorityFromScore(score, execTs),
+					ExecuteAt: execTs * 1000,
+					Attempts:  parseInt64(res[i+2]),
+				}
+				if err = emit(rec); err != nil {
+					return err
+				}
+			}
+			if len(res) < exportPageSize*3 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// importRecords 按分片分组，每个分片一次 importScript 写入 delay 集与失败计数
+func (q *redisQueue) importRecords(recs []*ExportRecord) error {
+	args := make([][]interface{}, len(q.shards))
+	for _, rec := range recs {
+		idx := shardIndex(rec.Value, len(q.shards))
+		execTs := (rec.ExecuteAt + 999) / 1000
+		args[idx] = append(args[idx], rec.Value, itemScore(execTs, rec.Priority), rec.Attempts)
+	}
+	for i, a := range args {
+		if len(a) == 0 {
+			continue
+		}
+		if _, err := q.runScript(q.opCtx(), q.importScript,
+			[]string{q.shards[i].delaySetKey, q.shards[i].failedHashKey, q.shards[i].seqHashKey}, a...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportRecords 依次导出内存层（含已拉入内存的 item）与 Redis 层
+func (q *tieredQueue) exportRecords(emit func(*ExportRecord) error) error {
+	if err := q.memQueue.exportRecords(emit); err != nil {
+		return err
+	}
+	return q.redis.exportRecords(emit)
+}
+
+// importRecords 按剩余延迟与阈值把记录分别导入内存层与 Redis 层
+func (q *tieredQueue) importRecords(recs []*ExportRecord) error {
+	var mem, remote []*ExportRecord
+	for _, rec := range recs {
+		if q.inMemory(recordDelaySecond(rec.ExecuteAt)) {
+			mem = append(mem, rec)
+		} else {
+			remote = append(remote, rec)
+		}
+	}
+	if len(mem) > 0 {
+		if err := q.memQueue.importRecords(mem); err != nil {
+			return err
+		}
+	}
+	if len(remote) > 0 {
+		return q.redis.importRecords(remote)
+	}
+	return nil
+}
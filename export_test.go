@@ -0,0 +1,202 @@
+package delayq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	idxExport = 12
+	idxImport = 13
+)
+
+// TestExport_MemoryRoundTrip 内存队列导出后导入另一个队列，执行时间、优先级与失败次数保持不变
+func TestExport_MemoryRoundTrip(t *testing.T) {
+	src := New(WithLogger(NopLogger()))
+	defer src.Close()
+	if err := src.Start("exp", func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.PushBatch([]*Item{
+		{Topic: "exp", Value: []byte("a"), DelaySecond: 100, Priority: 3},
+		{Topic: "exp", Value: []byte("b"), DelaySecond: 7200},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tq, _ := src.(*queue).topicQueues.Load("exp")
+	execAt := nowFunc().Add(30 * time.Second).UnixMilli()
+	if err := tq.(*memQueue).importRecords([]*ExportRecord{{Value: []byte("r"), ExecuteAt: execAt, Attempts: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := src.Export("exp", &buf)
+	if err != nil || n != 3 {
+		t.Fatalf("export: n=%d err=%v", n, err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("want 3 json lines got %q", buf.String())
+	}
+	var first ExportRecord
+	if err = json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Topic != "exp" {
+		t.Fatalf("unexpected record %s: %v", lines[0], err)
+	}
+
+	dst := New(WithLogger(NopLogger()))
+	defer dst.Close()
+	if err = dst.Start("imp", func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = dst.Import("imp", &buf, ImportAppend); err != nil || n != 3 {
+		t.Fatalf("import: n=%d err=%v", n, err)
+	}
+	for value, want := range map[string]time.Duration{"a": 100 * time.Second, "b": 7200 * time.Second, "r": 30 * time.Second} {
+		remain, ok, err := dst.Get("imp", []byte(value))
+		if err != nil || !ok || remain < want-2*time.Second || remain > want {
+			t.Fatalf("%s: remain=%v ok=%v err=%v", value, remain, ok, err)
+		}
+	}
+	var again bytes.Buffer
+	if _, err = dst.Export("imp", &again); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]ExportRecord{}
+	dec := json.NewDecoder(&again)
+	for dec.More() {
+		var rec ExportRecord
+		if err = dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		got[string(rec.Value)] = rec
+	}
+	if got["a"].Priority != 3 || got["r"].Attempts != 2 || got["a"].Topic != "imp" {
+		t.Fatalf("priority/attempts not preserved: %+v", got)
+	}
+}
+
+// TestImport_MemoryKeepsExecuteAt 导入的节点保留记录中的原执行时间：再次导出得到原 ExecuteAt；
+// 已过期的记录立即到期，派发延迟从原时间起算
+func TestImport_MemoryKeepsExecuteAt(t *testing.T) {
+	tp := NewMemoryTopicQueue(context.Background(), "keep-exec", WithLogger(NopLogger())).(*memQueue)
+	if err := tp.Start(noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	future := nowFunc().Add(30*time.Second + 456*time.Millisecond).UnixMilli()
+	past := nowFunc().Add(-90 * time.Second).UnixMilli()
+	if err := tp.importRecords([]*ExportRecord{{Value: []byte("future"), ExecuteAt: future}}); err != nil {
+		t.Fatal(err)
+	}
+	var recs []*ExportRecord
+	if err := tp.exportRecords(func(rec *ExportRecord) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].ExecuteAt != future {
+		t.Fatalf("want original execute_at %d got %+v", future, recs)
+	}
+	if err := tp.importRecords([]*ExportRecord{{Value: []byte("late"), ExecuteAt: past}}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 3000, func() bool { return tp.maxLateness() >= 90*time.Second })
+}
+
+// TestImport_Modes SkipExisting 跳过已存在的 value；Replace 先取消再入队
+func TestImport_Modes(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	if err := q.Start("mode", func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Topic: "mode", Value: []byte("dup"), DelaySecond: 500}); err != nil {
+		t.Fatal(err)
+	}
+	stream := func() *bytes.Buffer {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		execAt := nowFunc().Add(10 * time.Second).UnixMilli()
+		_ = enc.Encode(&ExportRecord{Value: []byte("dup"), ExecuteAt: execAt})
+		_ = enc.Encode(&ExportRecord{Value: []byte("new"), ExecuteAt: execAt})
+		return &buf
+	}
+	if n, err := q.Import("mode", stream(), ImportSkipExisting); err != nil || n != 1 {
+		t.Fatalf("skip existing: n=%d err=%v", n, err)
+	}
+	if remain, _, _ := q.Get("mode", []byte("dup")); remain < 400*time.Second {
+		t.Fatalf("existing item should be kept, remain=%v", remain)
+	}
+	if n, err := q.Import("mode", stream(), ImportReplace); err != nil || n != 2 {
+		t.Fatalf("replace: n=%d err=%v", n, err)
+	}
+	if remain, _, _ := q.Get("mode", []byte("dup")); remain > 10*time.Second {
+		t.Fatalf("existing item should be replaced, remain=%v", remain)
+	}
+}
+
+// TestExport_Redis 分页读取 delay 集并还原执行时间、优先级与失败次数；导入时写入 score 与失败计数
+func TestExport_Redis(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "rexp", WithRedisScriptBuilder(b)).(*redisQueue)
+	now := unix()
+	var offsets []interface{}
+	b.scripts[idxExport].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		offsets = append(offsets, args[0])
+		if args[0].(int) > 0 {
+			return []interface{}{"last", itemScore(now+5, 0), int64(0)}, nil
+		}
+		page := make([]interface{}, 0, exportPageSize*3)
+		for i := 0; i < exportPageSize; i++ {
+			page = append(page, "v", itemScore(now+60, 4), int64(3))
+		}
+		return page, nil
+	}
+	var recs []*ExportRecord
+	if err := rq.exportRecords(func(rec *ExportRecord) error { recs = append(recs, rec); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 2 || offsets[1] != exportPageSize || len(recs) != exportPageSize+1 {
+		t.Fatalf("want 2 pages, offsets=%v records=%d", offsets, len(recs))
+	}
+	if r := recs[0]; r.ExecuteAt != (now+60)*1000 || r.Priority != 4 || r.Attempts != 3 || r.Topic != "rexp" {
+		t.Fatalf("unexpected record %+v", r)
+	}
+
+	var mu sync.Mutex
+	var imported []interface{}
+	b.scripts[idxImport].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		imported = append(imported, args...)
+		return []interface{}{true}, nil
+	}
+	if err := rq.importRecords([]*ExportRecord{{Value: []byte("x"), ExecuteAt: (now + 60) * 1000, Priority: 2, Attempts: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 3 || imported[1].(float64) != itemScore(now+60, 2) || imported[2] != int64(1) {
+		t.Fatalf("unexpected import args %v", imported)
+	}
+}
+
+// TestExport_Errors 未启动的 topic 与不支持的后端返回错误
+func TestExport_Errors(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	if _, err := q.Export("missing", &bytes.Buffer{}); !errors.Is(err, ErrTopicQueueHasClosed) {
+		t.Fatalf("want ErrTopicQueueHasClosed got %v", err)
+	}
+	_, db := newFakeSQL()
+	if err := q.StartTopicQueue(NewSQLTopicQueue(db, SQLDialectSQLite, "sql-exp"), func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Import("sql-exp", strings.NewReader(""), ImportAppend); !errors.Is(err, ErrExportUnsupported) {
+		t.Fatalf("want ErrExportUnsupported got %v", err)
+	}
+}
@@ -122,12 +122,12 @@ func TestQueue_PushBatch_AutoTopic(t *testing.T) {
 // 在同一槽位中按降序排列。直接调用 insertLocked 避免 ticker 干扰。
 func TestMemq_Priority_DispatchOrder(t *testing.T) {
 	tp := NewMemoryTopicQueue(context.Background(), "prio")
-	mq := tp.(*memQueue)
+	sh := tp.(*memQueue).shards[0]
 	defer tp.Close()
 
-	mq.mx.Lock()
+	sh.mx.Lock()
 	for _, p := range []int32{1, 5, 3, 10, 2} {
-		mq.insertLocked(&Item{
+		sh.insertLocked(&Item{
 			Topic:    "prio",
 			Value:    []byte(fmt.Sprintf("p%d", p)),
 			Priority: p,
@@ -136,12 +136,10 @@ func TestMemq_Priority_DispatchOrder(t *testing.T) {
 
 	// 检查所有节点的 priority 在链表中按降序排列
 	var prio []int32
-	for i := 0; i < wheelSize; i++ {
-		for n := mq.wheels[i].nodes; n != nil; n = n.next {
-			prio = append(prio, n.priority)
-		}
+	for n := sh.wheel.levels[0][sh.wheel.slot(0, sh.wheel.tick+1)]; n != nil; n = n.next {
+		prio = append(prio, n.priority)
 	}
-	mq.mx.Unlock()
+	sh.mx.Unlock()
 	if len(prio) != 5 {
 		t.Fatalf("expected 5 nodes got %d: %v", len(prio), prio)
 	}
@@ -0,0 +1,152 @@
+package delayq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fifoExpected 按 (priority 降序, 入队顺序) 排列的期望派发顺序
+func fifoExpected(values []string, priorities []int32) []string {
+	var out []string
+	for _, p := range []int32{9, 0} {
+		for i, v := range values {
+			if priorities[i] == p {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// fifoInput 同一秒入队的 item：value 字典序与入队顺序相反，两种 priority 交错
+func fifoInput(n int) ([]string, []int32) {
+	values := make([]string, n)
+	priorities := make([]int32, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("v%02d", n-i)
+		if i%3 == 0 {
+			priorities[i] = 9
+		}
+	}
+	return values, priorities
+}
+
+// TestFIFO_MemoryDispatchOrder 同一秒同 priority 的 item 按 Push 顺序派发（MaxConcurrency=1 时 handler 调用顺序即派发顺序）
+func TestFIFO_MemoryDispatchOrder(t *testing.T) {
+	values, priorities := fifoInput(30)
+	var mu sync.Mutex
+	var got []string
+	var wg sync.WaitGroup
+	wg.Add(len(values))
+	tp := NewMemoryTopicQueue(context.Background(), "fifo", WithLogger(NopLogger()), WithMaxConcurrency(1))
+	if err := tp.Start(func(item *Item) error {
+		mu.Lock()
+		got = append(got, string(item.GetValue()))
+		mu.Unlock()
+		wg.Done()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	items := make([]*Item, len(values))
+	for i, v := range values {
+		items[i] = &Item{Value: []byte(v), Priority: priorities[i], DelaySecond: 1}
+	}
+	// 单分片 PushBatch 一次持锁插入，保证落在同一秒
+	if err := tp.PushBatch(items); err != nil {
+		t.Fatal(err)
+	}
+	waitGroupTimeout(t, &wg, 5*time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if want := fifoExpected(values, priorities); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("dispatch order\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestFIFO_MemoryShardsMerge 多分片合并到期 item 时按全局入队序号保持同 priority 先进先出
+func TestFIFO_MemoryShardsMerge(t *testing.T) {
+	values, priorities := fifoInput(64)
+	q := newMemoryTopicQueue(context.Background(), "fifo-shards", newConfig(WithMemoryShards(4))).(*memQueue)
+	for i, v := range values {
+		q.insertOne(&Item{Value: []byte(v), Priority: priorities[i]}, 0)
+	}
+	var got []string
+	for _, it := range q.advanceShards() {
+		got = append(got, string(it.GetValue()))
+	}
+	if want := fifoExpected(values, priorities); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("merged order\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestFIFO_MemoryCascade 远期 item 从高层下沉后仍排在之后入队、同一秒到期的 item 之前
+func TestFIFO_MemoryCascade(t *testing.T) {
+	q := newMemoryTopicQueue(context.Background(), "fifo-cascade", newConfig()).(*memQueue)
+	const expire = wheelSize + 100
+	for i := 0; i < 5; i++ {
+		q.insertOne(&Item{Value: []byte(fmt.Sprintf("z%d", i))}, expire)
+	}
+	var got []string
+	for tick := int64(0); tick <= expire; tick++ {
+		if tick == 200 {
+			// 剩余延迟不足一小时，直接进入第 0 层与随后下沉的节点同槽
+			for i := 0; i < 5; i++ {
+				q.insertOne(&Item{Value: []byte(fmt.Sprintf("a%d", i))}, expire-tick)
+			}
+			q.insertOne(&Item{Value: []byte("high"), Priority: 1}, expire-tick)
+		}
+		for _, it := range q.advanceShards() {
+			got = append(got, string(it.GetValue()))
+		}
+	}
+	want := "high,z0,z1,z2,z3,z4,a0,a1,a2,a3,a4"
+	if strings.Join(got, ",") != want {
+		t.Fatalf("cascade order\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestFIFO_RedisSeqKeys 入队与 poll 脚本都携带分片的 seq 集，入队参数保持 Push 顺序
+func TestFIFO_RedisSeqKeys(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "fifo-redis", WithRedisScriptBuilder(b)).(*redisQueue)
+	sh := rq.shards[0]
+	var addKeys, pollKeys []string
+	var pushed []string
+	b.scripts[idxAdd].evalShaFn = func(_ context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		addKeys = keys
+		for i := 0; i < len(args); i += 2 {
+			pushed = append(pushed, string(args[i].([]byte)))
+		}
+		return []interface{}{true}, nil
+	}
+	b.scripts[idxPoll].evalShaFn = func(_ context.Context, keys []string, _ ...interface{}) ([]interface{}, error) {
+		pollKeys = keys
+		return nil, nil
+	}
+	values, _ := fifoInput(10)
+	items := make([]*Item, len(values))
+	for i, v := range values {
+		items[i] = &Item{Value: []byte(v), DelaySecond: 5}
+	}
+	if err := rq.PushBatch(items); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if sh.seqHashKey != "__dq:seq:{fifo-redis}" {
+		t.Fatalf("unexpected seq key %s", sh.seqHashKey)
+	}
+	if len(addKeys) != 2 || addKeys[1] != sh.seqHashKey || pollKeys[len(pollKeys)-1] != sh.seqHashKey {
+		t.Fatalf("seq key missing: add=%v poll=%v", addKeys, pollKeys)
+	}
+	if strings.Join(pushed, ",") != strings.Join(values, ",") {
+		t.Fatalf("add args should keep push order, got %v", pushed)
+	}
+}
@@ -0,0 +1,355 @@
+package delayq
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// WAL 记录类型
+const (
+	walOpPush   byte = 1
+	walOpDone   byte = 2
+	walOpCancel byte = 3
+)
+
+// defaultFileSnapshotInterval FileSnapshotInterval<=0 时的默认压缩间隔
+const defaultFileSnapshotInterval = time.Minute
+
+// fileEntry 尚未完成的 item 及其绝对执行时间（unix 毫秒）
+type fileEntry struct {
+	item   *Item
+	execAt int64
+}
+
+// fileQueue 单机持久化延迟队列：调度沿用内存时间轮，入队、完成、取消追加写入 WAL，
+// 周期性把未完成的 item 压缩为快照并清空 WAL，构造时重放快照 + WAL 恢复时间轮。
+//
+// 记录格式：op(1B) | uvarint(id) | push 记录追加 varint(execAt 毫秒) | uvarint(len) | Item protobuf。
+// 进程在写入中途崩溃留下的不完整尾部记录在重放时被丢弃。
+//
+// 语义为 at-least-once：handler 执行期间进程退出的 item 会在重启后重新派发。
+type fileQueue struct {
+	*memQueue
+
+	walPath      string
+	snapshotPath string
+
+	// mu 保护 wal、nextID、ids、live、walRecords；可在持有 memShard.mx 时获取，反之不可
+	mu         sync.Mutex
+	wal        *os.File
+	nextID     uint64
+	ids        map[*Item][]uint64
+	live       map[uint64]fileEntry
+	walRecords int
+}
+
+// NewFileTopicQueue 构造一个以本地文件持久化的延迟队列，数据文件为 dir 下的 <topic>.wal 与 <topic>.snapshot。
+// 构造时重放已有数据：停机期间已到期的 item 在 Start 后立即派发。
+// 提供与内存队列相同的 TopicQueue 语义（含 Get/Cancel 与重试），适用于无需 Redis 的单节点服务；
+// 同一目录同一 topic 只能被一个实例打开。
+func NewFileTopicQueue(ctx context.Context, topic string, dir string, opts ...Option) (TopicQueue, error) {
+	return newFileTopicQueue(ctx, topic, dir, newConfig(opts...))
+}
+
+func newFileTopicQueue(ctx context.Context, topic string, dir string, opts *Options) (*fileQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	name := url.PathEscape(topic)
+	q := &fileQueue{
+		memQueue:     newMemoryTopicQueue(ctx, topic, opts).(*memQueue),
+		walPath:      filepath.Join(dir, name+".wal"),
+		snapshotPath: filepath.Join(dir, name+".snapshot"),
+		nextID:       1,
+		ids:          make(map[*Item][]uint64),
+		live:         make(map[uint64]fileEntry),
+	}
+	if err := q.replay(); err != nil {
+		return nil, fmt.Errorf("delayq: replay %s: %w", q.walPath, err)
+	}
+	q.journal = q
+	return q, nil
+}
+
+// replay 依次重放快照与 WAL，把未完成的 item 按原入队顺序放回时间轮，随后立即压缩
+func (q *fileQueue) replay() error {
+	for _, path := range []string{q.snapshotPath, q.walPath} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err = q.applyRecords(data); err != nil {
+			return err
+		}
+	}
+	ids := make([]uint64, 0, len(q.live))
+	for id := range q.live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	nowMs := nowFunc().UnixMilli()
+	items := make([]*Item, len(ids))
+	delays := make([]int64, len(ids))
+	execAts := make([]int64, len(ids))
+	for i, id := range ids {
+		e := q.live[id]
+		if remain := e.execAt - nowMs; remain > 0 {
+			delays[i] = (remain + 999) / 1000
+		}
+		execAts[i] = e.execAt
+		items[i] = e.item
+		q.ids[e.item] = append(q.ids[e.item], id)
+	}
+	q.insertAt(items, delays, execAts)
+	if len(ids) > 0 {
+		q.log.Infof("topic=%s replayed %d items from %s", q.topic, len(ids), filepath.Dir(q.walPath))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.compactLocked()
+}
+
+// applyRecords 解析一段记录并作用到 live；遇到不完整的尾部记录时停止
+func (q *fileQueue) applyRecords(data []byte) error {
+	for len(data) > 0 {
+		op := data[0]
+		id, n := binary.Uvarint(data[1:])
+		if n <= 0 {
+			return nil
+		}
+		data = data[1+n:]
+		if id >= q.nextID {
+			q.nextID = id + 1
+		}
+		switch op {
+		case walOpPush:
+			execAt, n1 := binary.Varint(data)
+			if n1 <= 0 {
+				return nil
+			}
+			size, n2 := binary.Uvarint(data[n1:])
+			if n2 <= 0 || uint64(len(data[n1+n2:])) < size {
+				return nil
+			}
+			body := data[n1+n2 : n1+n2+int(size)]
+			data = data[n1+n2+int(size):]
+			item := &Item{}
+			if err := proto.Unmarshal(body, item); err != nil {
+				return err
+			}
+			q.live[id] = fileEntry{item: item, execAt: execAt}
+		case walOpDone, walOpCancel:
+			delete(q.live, id)
+		default:
+			return fmt.Errorf("unknown wal op %d", op)
+		}
+	}
+	return nil
+}
+
+func appendPushRecord(buf []byte, id uint64, e fileEntry) ([]byte, error) {
+	body, err := proto.Marshal(e.item)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, walOpPush)
+	buf = binary.AppendUvarint(buf, id)
+	buf = binary.AppendVarint(buf, e.execAt)
+	buf = binary.AppendUvarint(buf, uint64(len(body)))
+	return append(buf, body...), nil
+}
+
+// writeLocked 把记录追加写入 WAL，按需打开文件与 fsync
+func (q *fileQueue) writeLocked(buf []byte, records int) error {
+	if q.wal == nil {
+		f, err := os.OpenFile(q.walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		q.wal = f
+	}
+	if _, err := q.wal.Write(buf); err != nil {
+		return err
+	}
+	if q.opts.GetFileSyncWrites() {
+		if err := q.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	q.walRecords += records
+	return nil
+}
+
+// pushed 实现 journal：先写 WAL，成功后再登记，失败时 memQueue 放弃入队
+func (q *fileQueue) pushed(items []*Item, execAts []time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var buf []byte
+	var err error
+	for i, it := range items {
+		if buf, err = appendPushRecord(buf, q.nextID+uint64(i), fileEntry{item: it, execAt: execAts[i].UnixMilli()}); err != nil {
+			return err
+		}
+	}
+	if err = q.writeLocked(buf, len(items)); err != nil {
+		return err
+	}
+	for i, it := range items {
+		id := q.nextID
+		q.nextID++
+		q.live[id] = fileEntry{item: it, execAt: execAts[i].UnixMilli()}
+		q.ids[it] = append(q.ids[it], id)
+	}
+	return nil
+}
+
+// done 实现 journal
+func (q *fileQueue) done(item *Item) {
+	q.remove(walOpDone, []*Item{item})
+}
+
+// canceled 实现 journal
+func (q *fileQueue) canceled(items []*Item) {
+	q.remove(walOpCancel, items)
+}
+
+// remove 为每个 item 追加一条完成/取消记录并移出 live；写入失败只记日志，重启后该 item 会被再次派发
+func (q *fileQueue) remove(op byte, items []*Item) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var buf []byte
+	records := 0
+	for _, it := range items {
+		ids := q.ids[it]
+		if len(ids) == 0 {
+			continue
+		}
+		id := ids[0]
+		if len(ids) == 1 {
+			delete(q.ids, it)
+		} else {
+			q.ids[it] = ids[1:]
+		}
+		delete(q.live, id)
+		buf = append(buf, op)
+		buf = binary.AppendUvarint(buf, id)
+		records++
+	}
+	if records == 0 {
+		return
+	}
+	if err := q.writeLocked(buf, records); err != nil {
+		q.log.Errorf("topic=%s write wal error: %v", q.topic, err)
+	}
+}
+
+// compact 由 ticker 周期调用，WAL 有新记录时压缩为快照
+func (q *fileQueue) compact() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.walRecords == 0 {
+		return nil
+	}
+	return q.compactLocked()
+}
+
+// compactLocked 把 live 按 id 顺序写入新快照（临时文件 + rename），然后清空 WAL。
+// 快照替换后、清空 WAL 前崩溃时，重放会再次应用 WAL 中的记录，结果不变。
+func (q *fileQueue) compactLocked() error {
+	ids := make([]uint64, 0, len(q.live))
+	for id := range q.live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var buf []byte
+	var err error
+	for _, id := range ids {
+		if buf, err = appendPushRecord(buf, id, q.live[id]); err != nil {
+			return err
+		}
+	}
+	tmp := q.snapshotPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, q.snapshotPath); err != nil {
+		return err
+	}
+	if q.wal != nil {
+		err = q.wal.Truncate(0)
+	} else if err = os.Truncate(q.walPath, 0); errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	q.walRecords = 0
+	return nil
+}
+
+// snapshotInterval 返回 WAL 压缩间隔；<=0 时回退到默认值
+func (q *fileQueue) snapshotInterval() time.Duration {
+	if d := q.opts.GetFileSnapshotInterval(); d > 0 {
+		return d
+	}
+	return defaultFileSnapshotInterval
+}
+
+func (q *fileQueue) tickers() []ticker {
+	return append(q.wheelTickers(), ticker{d: q.snapshotInterval(), f: q.compact})
+}
+
+func (q *fileQueue) Start(f func(item *Item) error) error {
+	return q.start(f, q.tickers()...)
+}
+
+// StartManualAck 启动手动 ack 模式
+func (q *fileQueue) StartManualAck(f func(item *Item, ack Acker)) error {
+	q.manualHandler = f
+	return q.start(func(*Item) error { return nil }, q.tickers()...)
+}
+
+// Close 关闭队列并等待在途 handler 返回，随后压缩一次并关闭 WAL 文件。
+// 关闭后再次 Start 会重新打开 WAL。
+func (q *fileQueue) Close() error {
+	err := q.close()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if cerr := q.compactLocked(); cerr != nil {
+		q.log.Errorf("topic=%s compact on close error: %v", q.topic, cerr)
+		if err == nil {
+			err = cerr
+		}
+	}
+	if q.wal != nil {
+		if cerr := q.wal.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		q.wal = nil
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openFileQueue(t *testing.T, dir string, opts ...Option) *fileQueue {
+	t.Helper()
+	opts = append([]Option{WithLogger(NopLogger())}, opts...)
+	q, err := newFileTopicQueue(context.Background(), "file-topic", dir, newConfig(opts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// TestFileQueue_ReplayAfterRestart 未到期 item 在重启后恢复，剩余延迟按绝对时间计算
+func TestFileQueue_ReplayAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("a"), DelaySecond: 100, Priority: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{{Value: []byte("b"), DelaySecond: 200}, {Value: []byte("c"), DelaySecond: 300}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Cancel([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q2 := openFileQueue(t, dir)
+	if n := q2.Length(); n != 2 {
+		t.Fatalf("want 2 items replayed got %d", n)
+	}
+	remain, ok, err := q2.Get([]byte("a"))
+	if err != nil || !ok || remain < 98*time.Second || remain > 100*time.Second {
+		t.Fatalf("unexpected a: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	if _, ok, _ = q2.Get([]byte("c")); ok {
+		t.Fatal("canceled item should not be replayed")
+	}
+	if e := q2.live[1]; e.item.GetPriority() != 2 {
+		t.Fatalf("priority should survive replay, got %v", e.item)
+	}
+}
+
+// TestFileQueue_AckedNotReplayed 处理成功的 item 不会在重启后再次派发
+func TestFileQueue_AckedNotReplayed(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir)
+	var handled int32
+	if err := q.Start(func(*Item) error { atomic.AddInt32(&handled, 1); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("now")}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 3000, func() bool { return atomic.LoadInt32(&handled) == 1 })
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := openFileQueue(t, dir).Length(); n != 0 {
+		t.Fatalf("acked item replayed, length=%d", n)
+	}
+}
+
+// TestFileQueue_RetryStateReplayed 重试中的 item 连同已失败次数一起恢复
+func TestFileQueue_RetryStateReplayed(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir, WithRetryTimes(5), WithRetryInterval(time.Minute))
+	var calls int32
+	if err := q.Start(func(*Item) error { atomic.AddInt32(&calls, 1); return errors.New("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("r")}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 3000, func() bool { return q.Length() == 1 && atomic.LoadInt32(&calls) == 1 })
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q2 := openFileQueue(t, dir)
+	if len(q2.live) != 1 {
+		t.Fatalf("want 1 live item got %d", len(q2.live))
+	}
+	for _, e := range q2.live {
+		if e.item.GetDelaySecond() != -1 {
+			t.Fatalf("failed count should be kept, got DelaySecond=%d", e.item.GetDelaySecond())
+		}
+	}
+	if remain, ok, _ := q2.Get([]byte("r")); !ok || remain < 58*time.Second {
+		t.Fatalf("retry delay should survive restart, remain=%v ok=%v", remain, ok)
+	}
+}
+
+// TestFileQueue_DowntimeCounted 停机期间已到期的 item 重启后立即可派发
+func TestFileQueue_DowntimeCounted(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("d"), DelaySecond: 30}); err != nil {
+		t.Fatal(err)
+	}
+	_ = q.Close()
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	later := time.Now().Add(time.Minute)
+	nowFunc = func() time.Time { return later }
+
+	q2 := openFileQueue(t, dir)
+	if remain, ok, _ := q2.Get([]byte("d")); !ok || remain != 0 {
+		t.Fatalf("overdue item should be due immediately, remain=%v ok=%v", remain, ok)
+	}
+}
+
+// TestFileQueue_CompactAndTornTail 压缩后 WAL 清空；不完整的尾部记录在重放时被丢弃
+func TestFileQueue_CompactAndTornTail(t *testing.T) {
+	dir := t.TempDir()
+	q := openFileQueue(t, dir)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("keep"), DelaySecond: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(q.walPath); err != nil || fi.Size() != 0 {
+		t.Fatalf("wal should be empty after compact: %v", err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 追加一条被截断的 push 记录，模拟写入中途崩溃
+	rec, err := appendPushRecord(nil, 99, fileEntry{item: &Item{Value: []byte("torn")}, execAt: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(q.walPath, rec[:len(rec)-2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q2 := openFileQueue(t, dir)
+	if _, ok, _ := q2.Get([]byte("keep")); !ok {
+		t.Fatal("snapshot item should be replayed")
+	}
+	if _, ok, _ := q2.Get([]byte("torn")); ok {
+		t.Fatal("torn record should be dropped")
+	}
+	if fi, err := os.Stat(q2.walPath); err != nil || fi.Size() != 0 {
+		t.Fatalf("replay should compact the wal: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package delayq
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// forecastLua 统计 delay 集中计划执行时间落在各区间 (ARGV[i-1], ARGV[i]] 的成员数。
+// KEYS: delay 集；ARGV[1]: 当前时间（秒）；之后每个参数为一个区间的截止时间（秒）
+var forecastLua = `
+local delay_set = KEYS[1]
+local counts = {}
+for i = 2, #ARGV do
+	counts[#counts + 1] = redis.call('ZCOUNT', delay_set, '(' .. ARGV[i-1], ARGV[i])
+end
+return counts
+`
+
+// forecaster 支持 Forecast 的 TopicQueue 实现
+type forecaster interface {
+	forecast(buckets []time.Duration) ([]int64, error)
+}
+
+// Forecast 按升序的 buckets 返回 topic 中各区间内将要到期的 item 数：结果第 i 项为计划执行时间落在
+// (now+buckets[i-1], now+buckets[i]] 的 item 数，第 0 项从 now 起算。各区间互不重叠，
+// 不含已到期未派发的 item（见 Status.Overdue）；未按升序排列时不大于前一项的区间计为 0。
+// 用于容量规划，例如 Forecast("orders", []time.Duration{time.Minute, time.Hour, 24 * time.Hour})
+// 分别返回 1 分钟内、1 分钟~1 小时、1 小时~1 天将要到期的 item 数。
+func (q *queue) Forecast(topic string, buckets []time.Duration) ([]int64, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return nil, ErrTopicQueueHasClosed
+	}
+	f, ok := val.(forecaster)
+	if !ok {
+		return nil, ErrForecastUnsupported
+	}
+	return f.forecast(buckets)
+}
+
+// forecastAll 对所有 topic 执行 Forecast，供 Collector 导出；失败的 topic 跳过
+func (q *queue) forecastAll(buckets []time.Duration) map[string][]int64 {
+	out := make(map[string][]int64)
+	q.topicQueues.Range(func(key, value any) bool {
+		if f, ok := value.(forecaster); ok {
+			if counts, err := f.forecast(buckets); err == nil {
+				out[key.(string)] = counts
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// forecast 逐个分片按时间顺序遍历时间轮槽位
+func (q *memQueue) forecast(buckets []time.Duration) ([]int64, error) {
+	counts := make([]int64, len(buckets))
+	if len(buckets) == 0 {
+		return counts, nil
+	}
+	nowMs := nowFunc().UnixMilli()
+	limits := make([]int64, len(buckets))
+	var maxLimit int64
+	for i, h := range buckets {
+		limits[i] = nowMs + h.Milliseconds()
+		if limits[i] > maxLimit {
+			maxLimit = limits[i]
+		}
+	}
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		sh.forecastLocked(nowMs, limits, maxLimit-nowMs, counts)
+		sh.mx.Unlock()
+	}
+	return counts, nil
+}
+
+// forecastLocked 把本分片中计划执行时间落在 (limits[i-1], limits[i]]（第 0 项从 nowMs 起）的未取消节点累加到 counts[i]。
+// 各层从当前 tick 所在槽位起按时间顺序遍历，槽位起点超过最大窗口后停止，
+// 因此开销与窗口内的节点数及槽位数成正比，远期节点不会被遍历
+func (sh *memShard) forecastLocked(nowMs int64, limits []int64, maxSpanMs int64, counts []int64) {
+	w := &sh.wheel
+	for l := 0; l < wheelLevels; l++ {
+		span := wheelSpans[l]
+		base := w.tick / span
+		for k := int64(0); k < wheelSize; k++ {
+			// 槽位起点距当前 tick 的秒数；多留 1 秒容纳 tick 与 execAt 之间的取整误差
+			if ((base+k)*span-w.tick-1)*1000 > maxSpanMs {
+				break
+			}
+			for p := w.levels[l][(base+k)%wheelSize]; p != nil; p = p.next {
+				if p.canceled || p.execAt <= nowMs {
+					continue
+				}
+				lo := nowMs
+				for i, limit := range limits {
+					if p.execAt > lo && p.execAt <= limit {
+						counts[i]++
+					}
+					lo = limit
+				}
+			}
+		}
+	}
+}
+
+// forecast 对每个分片执行 forecastScript 并汇总
+func (q *redisQueue) forecast(buckets []time.Duration) ([]int64, error) {
+	counts := make([]int64, len(buckets))
+	if len(buckets) == 0 {
+		return counts, nil
+	}
+	now := nowFunc()
+	args := make([]interface{}, 0, 1+len(buckets))
+	args = append(args, scoreArg(now))
+	for _, h := range buckets {
+		args = append(args, scoreArg(now.Add(h)))
+	}
+	for _, sh := range q.shards {
+		res, err := q.runScript(q.opCtx(), q.forecastScript, []string{sh.delaySetKey}, args...)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(res) && i < len(counts); i++ {
+			counts[i] += parseInt64(res[i])
+		}
+	}
+	return counts, nil
+}
+
+// scoreArg 把时间格式化为 delay 集 score 参数（秒，毫秒精度）
+func scoreArg(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', -1, 64)
+}
+
+// forecast 内存层与 Redis 层相加
+func (q *tieredQueue) forecast(buckets []time.Duration) ([]int64, error) {
+	counts, err := q.memQueue.forecast(buckets)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := q.redis.forecast(buckets)
+	if err != nil {
+		return nil, err
+	}
+	for i := range counts {
+		counts[i] += rc[i]
+	}
+	return counts, nil
+}
+
+// forecast 一条聚合查询统计所有区间
+func (q *sqlQueue) forecast(buckets []time.Duration) ([]int64, error) {
+	counts := make([]int64, len(buckets))
+	if len(buckets) == 0 {
+		return counts, nil
+	}
+	now := unix()
+	cols := make([]string, len(buckets))
+	args := make([]interface{}, 0, 2*len(buckets)+3)
+	lo := now
+	for i, h := range buckets {
+		hi := now + int64(h/time.Second)
+		cols[i] = "COALESCE(SUM(CASE WHEN execute_at > ? AND execute_at <= ? THEN 1 ELSE 0 END), 0)"
+		args = append(args, lo, hi)
+		lo = hi
+	}
+	args = append(args, q.topic, sqlStateDelayed, now)
+	dest := make([]interface{}, len(counts))
+	for i := range counts {
+		dest[i] = &counts[i]
+	}
+	if err := q.db.QueryRowContext(q.opCtx(), q.dialect.rebind(
+		"SELECT "+strings.Join(cols, ", ")+" FROM "+q.table+" WHERE topic = ? AND state = ? AND execute_at > ?"),
+		args...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
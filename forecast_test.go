@@ -0,0 +1,134 @@
+package delayq
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const idxForecast = 21
+
+var forecastBuckets = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+
+// TestForecast_Memory 按互不重叠的区间统计时间轮中将要到期的节点：跨层节点计入所在区间，已取消与已到期节点不计入
+func TestForecast_Memory(t *testing.T) {
+	q := New(WithLogger(NopLogger()), WithMemoryShards(2)).(*queue)
+	defer q.Close()
+	tq := q.newTopicQueue("fc")
+	q.topicQueues.Store(tq.Topic(), tq)
+	mq := tq.(*memQueue)
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	base := time.UnixMilli(time.Now().UnixMilli())
+	nowFunc = func() time.Time { return base }
+	for i, d := range []int64{0, 30, 59, 600, 2 * wheelSize, 3 * 86400} {
+		mq.insertOne(&Item{Value: []byte(fmt.Sprintf("v%d", i))}, d)
+	}
+	mq.insertOne(&Item{Value: []byte("canceled")}, 30)
+	if _, err := mq.Cancel([]byte("canceled")); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := q.Forecast("fc", forecastBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(counts) != "[2 1 1]" {
+		t.Fatalf("want [2 1 1] got %v", counts)
+	}
+	if _, err := q.Forecast("missing", forecastBuckets); !errors.Is(err, ErrTopicQueueHasClosed) {
+		t.Fatalf("want ErrTopicQueueHasClosed got %v", err)
+	}
+}
+
+// TestForecast_RedisAndCollector 每个分片一次 ZCOUNT 脚本并汇总；配置 ForecastBuckets 时 Collector 导出 forecast Gauge
+func TestForecast_RedisAndCollector(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	q := New(WithLogger(NopLogger()), WithRedisScriptBuilder(b), WithRedisShards(2),
+		WithName("fcq"), WithForecastBuckets(forecastBuckets...)).(*queue)
+	defer q.Close()
+	tq := q.newTopicQueue("fc-redis")
+	q.topicQueues.Store(tq.Topic(), tq)
+	stubAllScriptsOK(b)
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	nowFunc = func() time.Time { return time.Unix(1000, 0) }
+	b.scripts[idxForecast].evalShaFn = func(_ context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		if got := strings.Join(toStrings(args), ","); got != "1000,1060,4600,87400" || !strings.HasPrefix(keys[0], "__dq:do:{fc-redis") {
+			t.Errorf("unexpected forecast call keys=%v args=%s", keys, got)
+		}
+		return []interface{}{int64(1), int64(2), int64(3)}, nil
+	}
+	counts, err := q.Forecast("fc-redis", forecastBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(counts) != "[2 4 6]" {
+		t.Fatalf("want [2 4 6] got %v", counts)
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(q.Collector())
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		if mf.GetName() != "fcq_status_forecast" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			got[labelValue(m, "horizon_seconds")] = m.GetGauge().GetValue()
+		}
+	}
+	if got["60"] != 2 || got["3600"] != 4 || got["86400"] != 6 {
+		t.Fatalf("unexpected forecast gauges %v", got)
+	}
+}
+
+func toStrings(vs []interface{}) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = fmt.Sprint(v)
+	}
+	return out
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue()
+		}
+	}
+	return ""
+}
+
+// TestForecast_SQL 一条聚合查询统计所有区间，每个区间以前一个上界为下界
+func TestForecast_SQL(t *testing.T) {
+	f, db := newFakeSQL()
+	var args []driver.Value
+	f.handle = func(query string, a []driver.Value) ([]string, [][]driver.Value, int64, error) {
+		args = a
+		return []string{"a", "b", "c"}, [][]driver.Value{{int64(1), int64(5), int64(9)}}, 0, nil
+	}
+	q := NewSQLTopicQueue(db, SQLDialectSQLite, "fc-sql").(*sqlQueue)
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	nowFunc = func() time.Time { return time.Unix(100, 0) }
+	counts, err := q.forecast(forecastBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(counts) != "[1 5 9]" || fmt.Sprint(args) != "[100 160 160 3700 3700 86500 fc-sql 0 100]" {
+		t.Fatalf("counts=%v args=%v", counts, args)
+	}
+}
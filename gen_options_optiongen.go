@@ -27,7 +27,7 @@ type Options struct {
 	Logger Logger
 	// annotation@MaxConcurrency(comment="[all] 单 topic 业务处理最大并发 goroutine 数，<=0 表示不限制")
 	MaxConcurrency int
-	// annotation@VisibilityTimeout(comment="[redis] item 被 poll 拉走后多久未 ack 视为失败被 reclaim")
+	// annotation@VisibilityTimeout(comment="[redis][sql] item 被 poll 拉走后多久未 ack 视为失败被 reclaim")
 	VisibilityTimeout time.Duration
 	// annotation@RetryInterval(comment="[all] 基础重试间隔；下次重试 = now + RetryInterval * RetryBackoff^(failedCount-1)，上限 MaxRetryInterval")
 	RetryInterval time.Duration
@@ -43,12 +43,68 @@ type Options struct {
 	PushRatePerSec float64
 	// annotation@PushBurst(comment="[all] Push 限流 burst 容量（token 数），<=0 时取 PushRatePerSec 同值")
 	PushBurst int
-	// annotation@HeartbeatInterval(comment="[redis] handler 执行期间自动延期 doing 集 score 的心跳间隔；<0 禁用；0 = VisibilityTimeout/3（不少于 1s）")
+	// annotation@HeartbeatInterval(comment="[redis][sql] handler 执行期间自动延期 doing 集 score 的心跳间隔；<0 禁用；0 = VisibilityTimeout/3（不少于 1s）")
 	HeartbeatInterval time.Duration
-	// annotation@PollInterval(comment="[redis] poll 轮询间隔；<=0 时使用默认值 1s")
+	// annotation@PollInterval(comment="[redis][sql] poll 轮询间隔；<=0 时使用默认值 1s")
 	PollInterval time.Duration
-	// annotation@ReclaimInterval(comment="[redis] reclaim 轮询间隔；<=0 时使用默认值 1s")
+	// annotation@ReclaimInterval(comment="[redis][sql] reclaim 轮询间隔；<=0 时使用默认值 1s")
 	ReclaimInterval time.Duration
+	// annotation@DeadLetterRetention(comment="[redis] 死信在 dead 集中的保留时长；<=0 表示不写入 dead 集")
+	DeadLetterRetention time.Duration
+	// annotation@RedisShards(comment="[redis] 单 topic 的 Redis 分片数；<=1 表示不分片")
+	RedisShards int
+	// annotation@ConsumerID(comment="[redis] 消费者实例 ID；非空时启用租约登记与归属跟踪")
+	ConsumerID string
+	// annotation@ConsumerLeaseTTL(comment="[redis] 消费者租约有效期；<=0 时使用默认值 30s")
+	ConsumerLeaseTTL time.Duration
+	// annotation@SpoolSize(comment="[redis] Redis 不可用时本地缓冲 Push 的最大条数；<=0 表示不启用")
+	SpoolSize int
+	// annotation@SpoolPath(comment="[redis] 本地缓冲落盘文件路径；空表示仅内存缓冲")
+	SpoolPath string
+	// annotation@BreakerFailureThreshold(comment="[redis] 熔断打开所需的连续失败次数；<=0 表示不启用熔断")
+	BreakerFailureThreshold int
+	// annotation@BreakerOpenTimeout(comment="[redis] 熔断打开到半开的等待时长；<=0 时使用默认值 5s")
+	BreakerOpenTimeout time.Duration
+	// annotation@BreakerHalfOpenProbes(comment="[redis] 半开状态探测请求数；<=0 时使用默认值 1")
+	BreakerHalfOpenProbes int
+	// annotation@FileSnapshotInterval(comment="[file] WAL 压缩为快照的间隔；<=0 时使用默认值 1min")
+	FileSnapshotInterval time.Duration
+	// annotation@FileSyncWrites(comment="[file] 每次写 WAL 后 fsync")
+	FileSyncWrites bool
+	// annotation@SQLTableName(comment="[sql] SQL 后端表名")
+	SQLTableName string
+	// annotation@TieredThreshold(comment="[tiered] 分层队列路由阈值；New 中 >0 启用，<=0 时 NewTieredTopicQueue 取默认值 1min")
+	TieredThreshold time.Duration
+	// annotation@TieredPromoteAhead(comment="[tiered] 提前把 Redis item 拉入内存的时长；<=0 时使用默认值 5s")
+	TieredPromoteAhead time.Duration
+	// annotation@MemorySnapshotPath(comment="[memory] Close 时保存、Start 时恢复时间轮的快照文件路径，支持 {topic} 占位；空表示不持久化")
+	MemorySnapshotPath string
+	// annotation@MemoryCompactInterval(comment="[memory] 后台摘除已取消节点的间隔，<=0 表示不压缩")
+	MemoryCompactInterval time.Duration
+	// annotation@MemoryShards(comment="[memory] 时间轮分片数，<=1 表示不分片")
+	MemoryShards int
+	// annotation@WorkerPool(comment="[all] 固定 worker 池大小；>0 时常驻 worker 执行 handler，替代每 item 一个 goroutine；<=0 表示禁用")
+	WorkerPool int
+	// annotation@HandlerMiddleware(comment="[all] handler middleware，Start / StartManualAck 均生效；第一个位于最外层")
+	HandlerMiddleware []HandlerMiddleware
+	// annotation@PushInterceptor(comment="[all] 入队拦截器，Push / PushBatch 的每个 item 入队前按顺序调用，返回 error 拒绝入队")
+	PushInterceptor []PushInterceptor
+	// annotation@OnPushed(comment="[all] item 成功入队后回调")
+	OnPushed func(item *Item)
+	// annotation@OnDispatched(comment="[all] item 派发给 handler 前回调")
+	OnDispatched func(item *Item)
+	// annotation@OnAcked(comment="[all] item 处理成功并完成 ack 后回调")
+	OnAcked func(item *Item)
+	// annotation@OnRetryScheduled(comment="[all] 失败 item 重新入队后回调，delay 为重试延迟")
+	OnRetryScheduled func(item *Item, delay time.Duration)
+	// annotation@OnReclaimed(comment="[redis] reclaim 把 doing 集 item 搬回 delay 集后回调")
+	OnReclaimed func(topic string, values [][]byte)
+	// annotation@HistorySize(comment="[redis][memory] 每个 item 保留的生命周期历史条数；<=0 表示不记录")
+	HistorySize int
+	// annotation@HistoryRetention(comment="[redis][memory] item 完成后历史的保留时长")
+	HistoryRetention time.Duration
+	// annotation@ForecastBuckets(comment="[all] Collector 导出 forecast Gauge 的升序区间上界；为空时不导出")
+	ForecastBuckets []time.Duration
 }
 
 // newConfig new Options
@@ -143,7 +199,7 @@ func WithMaxConcurrency(v int) Option {
 	}
 }
 
-// WithVisibilityTimeout [redis] item 被 poll 拉走后多久未 ack 视为失败被 reclaim
+// WithVisibilityTimeout [redis][sql] item 被 poll 拉走后多久未 ack 视为失败被 reclaim
 func WithVisibilityTimeout(v time.Duration) Option {
 	return func(cc *Options) {
 		cc.VisibilityTimeout = v
@@ -199,7 +255,7 @@ func WithPushBurst(v int) Option {
 	}
 }
 
-// WithHeartbeatInterval [redis] handler 执行期间自动延期 doing 集 score 的心跳间隔；
+// WithHeartbeatInterval [redis][sql] handler 执行期间自动延期 doing 集 score 的心跳间隔；
 // <0 禁用；0 = VisibilityTimeout/3（不少于 1s）
 func WithHeartbeatInterval(v time.Duration) Option {
 	return func(cc *Options) {
@@ -207,20 +263,216 @@ func WithHeartbeatInterval(v time.Duration) Option {
 	}
 }
 
-// WithPollInterval [redis] poll 轮询间隔；<=0 时使用默认值 1s
+// WithPollInterval [redis][sql] poll 轮询间隔；<=0 时使用默认值 1s
 func WithPollInterval(v time.Duration) Option {
 	return func(cc *Options) {
 		cc.PollInterval = v
 	}
 }
 
-// WithReclaimInterval [redis] reclaim 轮询间隔；<=0 时使用默认值 1s
+// WithReclaimInterval [redis][sql] reclaim 轮询间隔；<=0 时使用默认值 1s
 func WithReclaimInterval(v time.Duration) Option {
 	return func(cc *Options) {
 		cc.ReclaimInterval = v
 	}
 }
 
+// WithDeadLetterRetention [redis] 死信在 dead 集中的保留时长；<=0 表示不写入 dead 集
+func WithDeadLetterRetention(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.DeadLetterRetention = v
+	}
+}
+
+// WithRedisShards [redis] 单 topic 的 Redis 分片数；<=1 表示不分片
+func WithRedisShards(v int) Option {
+	return func(cc *Options) {
+		cc.RedisShards = v
+	}
+}
+
+// WithConsumerID [redis] 消费者实例 ID；非空时启用租约登记与归属跟踪
+func WithConsumerID(v string) Option {
+	return func(cc *Options) {
+		cc.ConsumerID = v
+	}
+}
+
+// WithConsumerLeaseTTL [redis] 消费者租约有效期；<=0 时使用默认值 30s
+func WithConsumerLeaseTTL(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.ConsumerLeaseTTL = v
+	}
+}
+
+// WithSpoolSize [redis] Redis 不可用时本地缓冲 Push 的最大条数；<=0 表示不启用
+func WithSpoolSize(v int) Option {
+	return func(cc *Options) {
+		cc.SpoolSize = v
+	}
+}
+
+// WithSpoolPath [redis] 本地缓冲落盘文件路径；空表示仅内存缓冲
+func WithSpoolPath(v string) Option {
+	return func(cc *Options) {
+		cc.SpoolPath = v
+	}
+}
+
+// WithBreakerFailureThreshold [redis] 熔断打开所需的连续失败次数；<=0 表示不启用熔断
+func WithBreakerFailureThreshold(v int) Option {
+	return func(cc *Options) {
+		cc.BreakerFailureThreshold = v
+	}
+}
+
+// WithBreakerOpenTimeout [redis] 熔断打开到半开的等待时长；<=0 时使用默认值 5s
+func WithBreakerOpenTimeout(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.BreakerOpenTimeout = v
+	}
+}
+
+// WithBreakerHalfOpenProbes [redis] 半开状态探测请求数；<=0 时使用默认值 1
+func WithBreakerHalfOpenProbes(v int) Option {
+	return func(cc *Options) {
+		cc.BreakerHalfOpenProbes = v
+	}
+}
+
+// WithFileSnapshotInterval [file] WAL 压缩为快照的间隔；<=0 时使用默认值 1min
+func WithFileSnapshotInterval(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.FileSnapshotInterval = v
+	}
+}
+
+// WithFileSyncWrites [file] 每次写 WAL 后 fsync
+func WithFileSyncWrites(v bool) Option {
+	return func(cc *Options) {
+		cc.FileSyncWrites = v
+	}
+}
+
+// WithSQLTableName [sql] SQL 后端表名
+func WithSQLTableName(v string) Option {
+	return func(cc *Options) {
+		cc.SQLTableName = v
+	}
+}
+
+// WithTieredThreshold [tiered] 分层队列路由阈值；New 中 >0 启用，<=0 时 NewTieredTopicQueue 取默认值 1min
+func WithTieredThreshold(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.TieredThreshold = v
+	}
+}
+
+// WithTieredPromoteAhead [tiered] 提前把 Redis item 拉入内存的时长；<=0 时使用默认值 5s
+func WithTieredPromoteAhead(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.TieredPromoteAhead = v
+	}
+}
+
+// WithMemorySnapshotPath [memory] Close 时保存、Start 时恢复时间轮的快照文件路径，支持 {topic} 占位；空表示不持久化
+func WithMemorySnapshotPath(v string) Option {
+	return func(cc *Options) {
+		cc.MemorySnapshotPath = v
+	}
+}
+
+// WithMemoryCompactInterval [memory] 后台摘除已取消节点的间隔，<=0 表示不压缩
+func WithMemoryCompactInterval(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.MemoryCompactInterval = v
+	}
+}
+
+// WithMemoryShards [memory] 时间轮分片数，<=1 表示不分片
+func WithMemoryShards(v int) Option {
+	return func(cc *Options) {
+		cc.MemoryShards = v
+	}
+}
+
+// WithWorkerPool [all] 固定 worker 池大小；>0 时常驻 worker 执行 handler，替代每 item 一个 goroutine；<=0 表示禁用
+func WithWorkerPool(v int) Option {
+	return func(cc *Options) {
+		cc.WorkerPool = v
+	}
+}
+
+// WithHandlerMiddleware [all] handler middleware，Start / StartManualAck 均生效；第一个位于最外层
+func WithHandlerMiddleware(v ...HandlerMiddleware) Option {
+	return func(cc *Options) {
+		cc.HandlerMiddleware = v
+	}
+}
+
+// WithPushInterceptor [all] 入队拦截器，Push / PushBatch 的每个 item 入队前按顺序调用，返回 error 拒绝入队
+func WithPushInterceptor(v ...PushInterceptor) Option {
+	return func(cc *Options) {
+		cc.PushInterceptor = v
+	}
+}
+
+// WithOnPushed [all] item 成功入队后回调
+func WithOnPushed(v func(item *Item)) Option {
+	return func(cc *Options) {
+		cc.OnPushed = v
+	}
+}
+
+// WithOnDispatched [all] item 派发给 handler 前回调
+func WithOnDispatched(v func(item *Item)) Option {
+	return func(cc *Options) {
+		cc.OnDispatched = v
+	}
+}
+
+// WithOnAcked [all] item 处理成功并完成 ack 后回调
+func WithOnAcked(v func(item *Item)) Option {
+	return func(cc *Options) {
+		cc.OnAcked = v
+	}
+}
+
+// WithOnRetryScheduled [all] 失败 item 重新入队后回调，delay 为重试延迟
+func WithOnRetryScheduled(v func(item *Item, delay time.Duration)) Option {
+	return func(cc *Options) {
+		cc.OnRetryScheduled = v
+	}
+}
+
+// WithOnReclaimed [redis] reclaim 把 doing 集 item 搬回 delay 集后回调
+func WithOnReclaimed(v func(topic string, values [][]byte)) Option {
+	return func(cc *Options) {
+		cc.OnReclaimed = v
+	}
+}
+
+// WithHistorySize [redis][memory] 每个 item 保留的生命周期历史条数；<=0 表示不记录
+func WithHistorySize(v int) Option {
+	return func(cc *Options) {
+		cc.HistorySize = v
+	}
+}
+
+// WithHistoryRetention [redis][memory] item 完成后历史的保留时长
+func WithHistoryRetention(v time.Duration) Option {
+	return func(cc *Options) {
+		cc.HistoryRetention = v
+	}
+}
+
+// WithForecastBuckets [all] Collector 导出 forecast Gauge 的升序区间上界；为空时不导出
+func WithForecastBuckets(v ...time.Duration) Option {
+	return func(cc *Options) {
+		cc.ForecastBuckets = v
+	}
+}
+
 // InstallOptionsWatchDog the installed func will called when newConfig  called
 func InstallOptionsWatchDog(dog func(cc *Options)) { watchDogOptions = dog }
 
@@ -252,6 +504,34 @@ func newDefaultOptions() *Options {
 		WithHeartbeatInterval(0),
 		WithPollInterval(0),
 		WithReclaimInterval(0),
+		WithDeadLetterRetention(0),
+		WithRedisShards(0),
+		WithConsumerID(""),
+		WithConsumerLeaseTTL(0),
+		WithSpoolSize(0),
+		WithSpoolPath(""),
+		WithBreakerFailureThreshold(0),
+		WithBreakerOpenTimeout(0),
+		WithBreakerHalfOpenProbes(0),
+		WithFileSnapshotInterval(0),
+		WithFileSyncWrites(false),
+		WithSQLTableName("delayq_items"),
+		WithTieredThreshold(0),
+		WithTieredPromoteAhead(0),
+		WithMemorySnapshotPath(""),
+		WithMemoryCompactInterval(time.Second * 10),
+		WithMemoryShards(1),
+		WithWorkerPool(0),
+		WithHandlerMiddleware(nil...),
+		WithPushInterceptor(nil...),
+		WithOnPushed(nil),
+		WithOnDispatched(nil),
+		WithOnAcked(nil),
+		WithOnRetryScheduled(nil),
+		WithOnReclaimed(nil),
+		WithHistorySize(0),
+		WithHistoryRetention(24 * time.Hour),
+		WithForecastBuckets(nil...),
 	} {
 		opt(cc)
 	}
@@ -277,12 +557,42 @@ func (cc *Options) GetMaxRetryInterval() time.Duration  { return cc.MaxRetryInte
 func (cc *Options) GetRetryIntervalFunc() func(failedCount int) time.Duration {
 	return cc.RetryIntervalFunc
 }
-func (cc *Options) GetDisableValueIndex() bool          { return cc.DisableValueIndex }
-func (cc *Options) GetPushRatePerSec() float64          { return cc.PushRatePerSec }
-func (cc *Options) GetPushBurst() int                   { return cc.PushBurst }
-func (cc *Options) GetHeartbeatInterval() time.Duration { return cc.HeartbeatInterval }
-func (cc *Options) GetPollInterval() time.Duration      { return cc.PollInterval }
-func (cc *Options) GetReclaimInterval() time.Duration   { return cc.ReclaimInterval }
+func (cc *Options) GetDisableValueIndex() bool                { return cc.DisableValueIndex }
+func (cc *Options) GetPushRatePerSec() float64                { return cc.PushRatePerSec }
+func (cc *Options) GetPushBurst() int                         { return cc.PushBurst }
+func (cc *Options) GetHeartbeatInterval() time.Duration       { return cc.HeartbeatInterval }
+func (cc *Options) GetPollInterval() time.Duration            { return cc.PollInterval }
+func (cc *Options) GetReclaimInterval() time.Duration         { return cc.ReclaimInterval }
+func (cc *Options) GetDeadLetterRetention() time.Duration     { return cc.DeadLetterRetention }
+func (cc *Options) GetRedisShards() int                       { return cc.RedisShards }
+func (cc *Options) GetConsumerID() string                     { return cc.ConsumerID }
+func (cc *Options) GetConsumerLeaseTTL() time.Duration        { return cc.ConsumerLeaseTTL }
+func (cc *Options) GetSpoolSize() int                         { return cc.SpoolSize }
+func (cc *Options) GetSpoolPath() string                      { return cc.SpoolPath }
+func (cc *Options) GetBreakerFailureThreshold() int           { return cc.BreakerFailureThreshold }
+func (cc *Options) GetBreakerOpenTimeout() time.Duration      { return cc.BreakerOpenTimeout }
+func (cc *Options) GetBreakerHalfOpenProbes() int             { return cc.BreakerHalfOpenProbes }
+func (cc *Options) GetFileSnapshotInterval() time.Duration    { return cc.FileSnapshotInterval }
+func (cc *Options) GetFileSyncWrites() bool                   { return cc.FileSyncWrites }
+func (cc *Options) GetSQLTableName() string                   { return cc.SQLTableName }
+func (cc *Options) GetTieredThreshold() time.Duration         { return cc.TieredThreshold }
+func (cc *Options) GetTieredPromoteAhead() time.Duration      { return cc.TieredPromoteAhead }
+func (cc *Options) GetMemorySnapshotPath() string             { return cc.MemorySnapshotPath }
+func (cc *Options) GetMemoryCompactInterval() time.Duration   { return cc.MemoryCompactInterval }
+func (cc *Options) GetMemoryShards() int                      { return cc.MemoryShards }
+func (cc *Options) GetWorkerPool() int                        { return cc.WorkerPool }
+func (cc *Options) GetHandlerMiddleware() []HandlerMiddleware { return cc.HandlerMiddleware }
+func (cc *Options) GetPushInterceptor() []PushInterceptor     { return cc.PushInterceptor }
+func (cc *Options) GetOnPushed() func(item *Item)             { return cc.OnPushed }
+func (cc *Options) GetOnDispatched() func(item *Item)         { return cc.OnDispatched }
+func (cc *Options) GetOnAcked() func(item *Item)              { return cc.OnAcked }
+func (cc *Options) GetOnRetryScheduled() func(item *Item, delay time.Duration) {
+	return cc.OnRetryScheduled
+}
+func (cc *Options) GetOnReclaimed() func(topic string, values [][]byte) { return cc.OnReclaimed }
+func (cc *Options) GetHistorySize() int                                 { return cc.HistorySize }
+func (cc *Options) GetHistoryRetention() time.Duration                  { return cc.HistoryRetention }
+func (cc *Options) GetForecastBuckets() []time.Duration                 { return cc.ForecastBuckets }
 
 // GetName 已废弃别名，等同于 GetMetricNamespace
 //
@@ -315,6 +625,34 @@ type OptionsVisitor interface {
 	GetHeartbeatInterval() time.Duration
 	GetPollInterval() time.Duration
 	GetReclaimInterval() time.Duration
+	GetDeadLetterRetention() time.Duration
+	GetRedisShards() int
+	GetConsumerID() string
+	GetConsumerLeaseTTL() time.Duration
+	GetSpoolSize() int
+	GetSpoolPath() string
+	GetBreakerFailureThreshold() int
+	GetBreakerOpenTimeout() time.Duration
+	GetBreakerHalfOpenProbes() int
+	GetFileSnapshotInterval() time.Duration
+	GetFileSyncWrites() bool
+	GetSQLTableName() string
+	GetTieredThreshold() time.Duration
+	GetTieredPromoteAhead() time.Duration
+	GetMemorySnapshotPath() string
+	GetMemoryCompactInterval() time.Duration
+	GetMemoryShards() int
+	GetWorkerPool() int
+	GetHandlerMiddleware() []HandlerMiddleware
+	GetPushInterceptor() []PushInterceptor
+	GetOnPushed() func(item *Item)
+	GetOnDispatched() func(item *Item)
+	GetOnAcked() func(item *Item)
+	GetOnRetryScheduled() func(item *Item, delay time.Duration)
+	GetOnReclaimed() func(topic string, values [][]byte)
+	GetHistorySize() int
+	GetHistoryRetention() time.Duration
+	GetForecastBuckets() []time.Duration
 }
 
 // OptionsInterface visitor + ApplyOption interface for Options
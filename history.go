@@ -0,0 +1,261 @@
+package delayq
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// historyLua 追加 item 历史事件、裁剪到最大条数并设置过期时间。
+// KEYS: 各 item 的历史 key（同一分片，可重复）；ARGV[1]: 最大条数；
+// 之后每个 key 依次对应 3 个参数：事件 JSON、过期秒数、mode（1 = 仅延长过期时间，0 = 直接设置）
+var historyLua = `
+local size = tonumber(ARGV[1])
+for i, key in ipairs(KEYS) do
+	local base = 2 + (i - 1) * 3
+	redis.call('RPUSH', key, ARGV[base])
+	redis.call('LTRIM', key, -size, -1)
+	local ttl = tonumber(ARGV[base + 1])
+	if ARGV[base + 2] == '0' or redis.call('TTL', key) < ttl then
+		redis.call('EXPIRE', key, ttl)
+	end
+end
+return #KEYS
+`
+
+// historyGetLua 读取 item 的全部历史事件（按发生顺序）
+var historyGetLua = `
+return redis.call('LRANGE', KEYS[1], 0, -1)
+`
+
+// HistoryEventType item 历史事件类型
+type HistoryEventType string
+
+const (
+	// HistoryPushed item 入队
+	HistoryPushed HistoryEventType = "pushed"
+	// HistoryDispatched item 派发给 handler，Consumer 为派发实例的 ConsumerID
+	HistoryDispatched HistoryEventType = "dispatched"
+	// HistoryFailed handler 返回 error / panic 或手动 Nack，Error 为错误信息
+	HistoryFailed HistoryEventType = "failed"
+	// HistoryRetryScheduled 失败后按重试策略重新入队，Delay 为重试延迟
+	HistoryRetryScheduled HistoryEventType = "retry_scheduled"
+	// HistoryReclaimed [redis] visibility 超时或消费者租约过期，item 被搬回 delay 集
+	HistoryReclaimed HistoryEventType = "reclaimed"
+	// HistoryAcked 处理成功并完成 ack
+	HistoryAcked HistoryEventType = "acked"
+	// HistoryDeadLetter 重试耗尽进入死信
+	HistoryDeadLetter HistoryEventType = "dead_letter"
+)
+
+// HistoryEvent item 生命周期中的一条记录
+type HistoryEvent struct {
+	Type HistoryEventType `json:"type"`
+	At   time.Time        `json:"at"`
+	// Consumer 处理该事件的实例（ConsumerID），未配置时为空
+	Consumer string `json:"consumer,omitempty"`
+	// Error HistoryFailed 的错误信息
+	Error string `json:"error,omitempty"`
+	// Delay HistoryRetryScheduled 的重试延迟
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+// historyEntry 一条待写入的历史
+type historyEntry struct {
+	value []byte
+	event HistoryEvent
+	// next 距离该 item 下一次预期事件的时长，历史至少保留 next + HistoryRetention
+	next time.Duration
+	// terminal item 已完成（ack / 死信），过期时间直接设为 HistoryRetention
+	terminal bool
+}
+
+// historyStore item 历史的存储后端
+type historyStore interface {
+	append(entries []historyEntry) error
+	load(value []byte) ([]HistoryEvent, error)
+}
+
+// historyHolder 支持 History 查询的 TopicQueue 实现
+type historyHolder interface {
+	itemHistory(value []byte) ([]HistoryEvent, error)
+}
+
+// History 返回 topic 中 value 对应 item 的生命周期历史（按发生顺序，至多 HistorySize 条）。
+// 同一 value 的多次入队共享一份历史。未配置 HistorySize 或后端不支持时返回 ErrHistoryUnsupported。
+func (q *queue) History(topic string, value []byte) ([]HistoryEvent, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return nil, ErrTopicQueueHasClosed
+	}
+	h, ok := val.(historyHolder)
+	if !ok {
+		return nil, ErrHistoryUnsupported
+	}
+	return h.itemHistory(value)
+}
+
+func (q *baseQueue) itemHistory(value []byte) ([]HistoryEvent, error) {
+	if q.history == nil {
+		return nil, ErrHistoryUnsupported
+	}
+	return q.history.load(value)
+}
+
+// recordHistory 写入历史；失败只记录日志与 MetricHistoryError，不影响 item 处理
+func (q *baseQueue) recordHistory(entries ...historyEntry) {
+	if q.history == nil || len(entries) == 0 {
+		return
+	}
+	if err := q.history.append(entries); err != nil {
+		q.monitorCount(MetricHistoryError)
+		q.log.Warnf("topic=%s record history error: %v", q.topic, err)
+	}
+}
+
+// historyEvent 构造一条当前时间、带 ConsumerID 的事件
+func (q *baseQueue) historyEvent(t HistoryEventType) HistoryEvent {
+	return HistoryEvent{Type: t, At: nowFunc(), Consumer: q.opts.GetConsumerID()}
+}
+
+// memHistory 内存队列的 item 历史，按过期时间由 sweep 定期清理
+type memHistory struct {
+	size      int
+	retention time.Duration
+
+	mu      sync.Mutex
+	records map[string]*historyRecord
+}
+
+type historyRecord struct {
+	events   []HistoryEvent
+	expireAt time.Time
+}
+
+// historySweepInterval 内存历史的过期清理间隔
+const historySweepInterval = time.Minute
+
+func newMemHistory(opts *Options) *memHistory {
+	return &memHistory{
+		size:      opts.GetHistorySize(),
+		retention: opts.GetHistoryRetention(),
+		records:   make(map[string]*historyRecord),
+	}
+}
+
+func (h *memHistory) append(entries []historyEntry) error {
+	now := nowFunc()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range entries {
+		key := string(e.value)
+		r := h.records[key]
+		if r == nil {
+			r = &historyRecord{}
+			h.records[key] = r
+		}
+		r.events = append(r.events, e.event)
+		if n := len(r.events); n > h.size {
+			r.events = append(r.events[:0:0], r.events[n-h.size:]...)
+		}
+		if exp := now.Add(e.next + h.retention); e.terminal || exp.After(r.expireAt) {
+			r.expireAt = exp
+		}
+	}
+	return nil
+}
+
+func (h *memHistory) load(value []byte) ([]HistoryEvent, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.records[string(value)]
+	if r == nil || !nowFunc().Before(r.expireAt) {
+		return nil, nil
+	}
+	return append([]HistoryEvent(nil), r.events...), nil
+}
+
+// sweep 删除已过期的历史
+func (h *memHistory) sweep() error {
+	now := nowFunc()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for k, r := range h.records {
+		if !now.Before(r.expireAt) {
+			delete(h.records, k)
+		}
+	}
+	return nil
+}
+
+// redisHistory Redis 队列的 item 历史：每个 item 一个 LIST（history:{topic}:<value>），
+// 与 failed:{topic} 同一 hash tag，通过 EXPIRE 在完成后自动过期
+type redisHistory struct {
+	q         *redisQueue
+	size      int
+	retention time.Duration
+}
+
+// historyTTLSec 过期秒数，至少 1
+func historyTTLSec(d time.Duration) int64 {
+	if sec := int64(d / time.Second); sec > 0 {
+		return sec
+	}
+	return 1
+}
+
+func (h *redisHistory) append(entries []historyEntry) error {
+	groups := make(map[*redisShard][]historyEntry)
+	var order []*redisShard
+	for _, e := range entries {
+		sh := h.q.shardOf(e.value)
+		if _, ok := groups[sh]; !ok {
+			order = append(order, sh)
+		}
+		groups[sh] = append(groups[sh], e)
+	}
+	var firstErr error
+	for _, sh := range order {
+		es := groups[sh]
+		keys := make([]string, 0, len(es))
+		args := make([]interface{}, 0, 1+len(es)*3)
+		args = append(args, int64(h.size))
+		for _, e := range es {
+			b, err := json.Marshal(e.event)
+			if err != nil {
+				return err
+			}
+			mode := int64(1)
+			if e.terminal {
+				mode = 0
+			}
+			keys = append(keys, sh.historyKeyPrefix+string(e.value))
+			args = append(args, b, historyTTLSec(e.next+h.retention), mode)
+		}
+		if _, err := h.q.runScript(h.q.opCtx(), h.q.historyScript, keys, args...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (h *redisHistory) load(value []byte) ([]HistoryEvent, error) {
+	res, err := h.q.runScript(h.q.opCtx(), h.q.historyGetScript,
+		[]string{h.q.shardOf(value).historyKeyPrefix + string(value)})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]HistoryEvent, 0, len(res))
+	for _, r := range res {
+		s, ok := r.(string)
+		if !ok {
+			continue
+		}
+		var e HistoryEvent
+		if err := json.Unmarshal([]byte(s), &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,198 @@
+package delayq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	idxHistory    = 18
+	idxHistoryGet = 19
+)
+
+// historyTypes 把历史事件压缩为 "type[:error|delay]" 便于比较
+func historyTypes(events []HistoryEvent) string {
+	var out []string
+	for _, e := range events {
+		s := string(e.Type)
+		if e.Error != "" {
+			s += ":" + e.Error
+		}
+		if e.Delay > 0 {
+			s += ":" + e.Delay.String()
+		}
+		out = append(out, s)
+	}
+	return strings.Join(out, ",")
+}
+
+// TestHistory_MemoryTimeline 内存队列记录入队、派发、失败（含错误信息）、重试与 ack
+func TestHistory_MemoryTimeline(t *testing.T) {
+	var attempts int64
+	q := New(WithLogger(NopLogger()), WithHistorySize(16), WithRetryInterval(100*time.Millisecond))
+	defer q.Close()
+	if err := q.Start("hist", func(*Item) error {
+		if atomic.AddInt64(&attempts, 1) == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Topic: "hist", Value: []byte("order-1")}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	events, err := q.History("hist", []byte("order-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "pushed,dispatched,failed:boom,retry_scheduled:100ms,dispatched,acked"
+	if got := historyTypes(events); got != want {
+		t.Fatalf("history\n got %s\nwant %s", got, want)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].At.Before(events[i-1].At) {
+			t.Fatalf("events not in order at %d", i)
+		}
+	}
+	if _, err := q.History("missing", []byte("x")); !errors.Is(err, ErrTopicQueueHasClosed) {
+		t.Fatalf("want ErrTopicQueueHasClosed got %v", err)
+	}
+}
+
+// TestHistory_Disabled 未配置 HistorySize 时返回 ErrHistoryUnsupported
+func TestHistory_Disabled(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	if err := q.Start("hist-off", noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.History("hist-off", []byte("x")); !errors.Is(err, ErrHistoryUnsupported) {
+		t.Fatalf("want ErrHistoryUnsupported got %v", err)
+	}
+}
+
+// TestHistory_MemoryBoundedAndExpire 只保留最近 HistorySize 条；完成后超过 HistoryRetention 不再返回并被 sweep 清理
+func TestHistory_MemoryBoundedAndExpire(t *testing.T) {
+	h := newMemHistory(newConfig(WithHistorySize(3), WithHistoryRetention(time.Hour)))
+	v := []byte("v")
+	for _, typ := range []HistoryEventType{HistoryPushed, HistoryDispatched, HistoryFailed, HistoryRetryScheduled} {
+		_ = h.append([]historyEntry{{value: v, event: HistoryEvent{Type: typ}, next: 48 * time.Hour}})
+	}
+	events, _ := h.load(v)
+	if got := historyTypes(events); got != "dispatched,failed,retry_scheduled" {
+		t.Fatalf("want last 3 events, got %s", got)
+	}
+	_ = h.append([]historyEntry{{value: v, event: HistoryEvent{Type: HistoryAcked}, terminal: true}})
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	later := time.Now().Add(30 * time.Minute)
+	nowFunc = func() time.Time { return later }
+	if events, _ := h.load(v); len(events) != 3 {
+		t.Fatalf("history should be retained within retention, got %d", len(events))
+	}
+	// ack 把过期时间从 48h+1h 缩短为 1h
+	later = later.Add(time.Hour)
+	if events, _ := h.load(v); events != nil {
+		t.Fatalf("expired history should not be returned, got %v", events)
+	}
+	_ = h.sweep()
+	if len(h.records) != 0 {
+		t.Fatalf("sweep should drop expired records, left %d", len(h.records))
+	}
+}
+
+// TestHistory_Redis 历史写入与 failed:{topic} 同 hash tag 的 LIST：未完成时仅延长过期时间，
+// ack 后设置为 HistoryRetention；reclaim 记录被搬回的 value；History 解码 LRANGE 结果
+func TestHistory_Redis(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "hist-redis",
+		WithRedisScriptBuilder(b),
+		WithLogger(NopLogger()),
+		WithConsumerID("pod-a"),
+		WithHistorySize(8),
+		WithHistoryRetention(time.Hour),
+	).(*redisQueue)
+	stubAllScriptsOK(b)
+	type call struct {
+		keys []string
+		args []interface{}
+	}
+	var mu sync.Mutex
+	var calls []call
+	b.scripts[idxHistory].evalShaFn = func(_ context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		calls = append(calls, call{keys, args})
+		mu.Unlock()
+		return []interface{}{int64(len(keys))}, nil
+	}
+	if err := rq.Push(&Item{Value: []byte("r1"), DelaySecond: 60}); err != nil {
+		t.Fatal(err)
+	}
+	rq.notifyAcked(&Item{Value: []byte("r1")})
+	b.scripts[idxMove].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{"r2", "100"}, nil
+	}
+	b.scripts[idxLeaseReclaim].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return nil, nil
+	}
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 3 {
+		t.Fatalf("want 3 history writes got %d", len(calls))
+	}
+	key := "__dq:history:{hist-redis}:r1"
+	checks := []struct {
+		key  string
+		typ  HistoryEventType
+		ttl  int64
+		mode int64
+	}{
+		{key, HistoryPushed, 3600 + 60, 1},
+		{key, HistoryAcked, 3600, 0},
+		{"__dq:history:{hist-redis}:r2", HistoryReclaimed, 3600, 1},
+	}
+	for i, c := range checks {
+		got := calls[i]
+		if len(got.keys) != 1 || got.keys[0] != c.key || len(got.args) != 4 || got.args[0].(int64) != 8 {
+			t.Fatalf("call %d: unexpected keys=%v args=%v", i, got.keys, got.args)
+		}
+		var e HistoryEvent
+		if err := json.Unmarshal(got.args[1].([]byte), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != c.typ || e.Consumer != "pod-a" || got.args[2].(int64) != c.ttl || got.args[3].(int64) != c.mode {
+			t.Fatalf("call %d: event=%+v ttl=%v mode=%v", i, e, got.args[2], got.args[3])
+		}
+	}
+
+	b.scripts[idxHistoryGet].evalShaFn = func(_ context.Context, keys []string, _ ...interface{}) ([]interface{}, error) {
+		if keys[0] != key {
+			t.Errorf("unexpected history key %v", keys)
+		}
+		return []interface{}{`{"type":"pushed","at":"2024-01-01T00:00:00Z"}`, `{"type":"failed","at":"2024-01-01T00:00:01Z","error":"timeout"}`}, nil
+	}
+	events, err := rq.itemHistory([]byte("r1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := historyTypes(events); got != "pushed,failed:timeout" {
+		t.Fatalf("decoded history %s", got)
+	}
+}
@@ -0,0 +1,97 @@
+package delayq
+
+import "time"
+
+// 生命周期钩子：OnPushed / OnDispatched / OnAcked / OnRetryScheduled / OnReclaimed / OnDeadLetter。
+// 钩子在队列内部 goroutine 中同步调用，应尽快返回；panic 会被捕获并记录日志，不影响 item 处理。
+// 配置 HistorySize 时，同一位置同时写入 item 历史（见 history.go）。
+
+// invokeHook 安全调用生命周期钩子，捕获 panic
+func (q *baseQueue) invokeHook(name string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			q.log.Errorf("topic=%s %s callback panic: %v", q.topic, name, r)
+		}
+	}()
+	f()
+}
+
+// notifyPushed 对成功入队的每个 item 回调 OnPushed
+func (q *baseQueue) notifyPushed(items ...*Item) {
+	if q.history != nil {
+		entries := make([]historyEntry, len(items))
+		for i, it := range items {
+			entries[i] = historyEntry{value: it.GetValue(), event: q.historyEvent(HistoryPushed)}
+			if d := it.GetDelaySecond(); d > 0 {
+				entries[i].next = time.Duration(d) * time.Second
+			}
+		}
+		q.recordHistory(entries...)
+	}
+	f := q.opts.GetOnPushed()
+	if f == nil {
+		return
+	}
+	for _, it := range items {
+		q.invokeHook("OnPushed", func() { f(it) })
+	}
+}
+
+// notifyDispatched 在 handler 执行前回调 OnDispatched
+func (q *baseQueue) notifyDispatched(item *Item) {
+	if q.history != nil {
+		q.recordHistory(historyEntry{value: item.GetValue(), event: q.historyEvent(HistoryDispatched), next: q.opts.GetVisibilityTimeout()})
+	}
+	if f := q.opts.GetOnDispatched(); f != nil {
+		q.invokeHook("OnDispatched", func() { f(item) })
+	}
+}
+
+// notifyFailed handler 失败或手动 Nack 时记录历史（无对应钩子，重试 / 死信由后续事件回调）
+func (q *baseQueue) notifyFailed(item *Item, err error) {
+	if q.history == nil {
+		return
+	}
+	e := q.historyEvent(HistoryFailed)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	q.recordHistory(historyEntry{value: item.GetValue(), event: e, next: q.opts.GetVisibilityTimeout()})
+}
+
+// notifyAcked 在成功 ack 后回调 OnAcked
+func (q *baseQueue) notifyAcked(item *Item) {
+	if q.history != nil {
+		q.recordHistory(historyEntry{value: item.GetValue(), event: q.historyEvent(HistoryAcked), terminal: true})
+	}
+	if f := q.opts.GetOnAcked(); f != nil {
+		q.invokeHook("OnAcked", func() { f(item) })
+	}
+}
+
+// notifyRetryScheduled 在失败 item 重新入队后上报重试延迟并回调 OnRetryScheduled
+func (q *baseQueue) notifyRetryScheduled(item *Item, delay time.Duration) {
+	q.monitorDuration(MetricRetryDelayMs, delay)
+	if q.history != nil {
+		e := q.historyEvent(HistoryRetryScheduled)
+		e.Delay = delay
+		q.recordHistory(historyEntry{value: item.GetValue(), event: e, next: delay})
+	}
+	if f := q.opts.GetOnRetryScheduled(); f != nil {
+		q.invokeHook("OnRetryScheduled", func() { f(item, delay) })
+	}
+}
+
+// notifyReclaimed 在 reclaim 搬回 item 后回调 OnReclaimed；values 为空时不回调
+func (q *baseQueue) notifyReclaimed(values [][]byte) {
+	if q.history != nil && len(values) > 0 {
+		entries := make([]historyEntry, len(values))
+		for i, v := range values {
+			entries[i] = historyEntry{value: v, event: q.historyEvent(HistoryReclaimed)}
+		}
+		q.recordHistory(entries...)
+	}
+	if f := q.opts.GetOnReclaimed(); f != nil && len(values) > 0 {
+		q.invokeHook("OnReclaimed", func() { f(q.topic, values) })
+	}
+}
@@ -0,0 +1,156 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// hookRecorder 把生命周期事件按发生顺序记录为 "<event>:<value>"
+type hookRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *hookRecorder) add(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+	r.mu.Unlock()
+}
+
+func (r *hookRecorder) joined() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+func (r *hookRecorder) options() []Option {
+	return []Option{
+		WithOnPushed(func(item *Item) { r.add("pushed:%s", item.GetValue()) }),
+		WithOnDispatched(func(item *Item) { r.add("dispatched:%s", item.GetValue()) }),
+		WithOnAcked(func(item *Item) { r.add("acked:%s", item.GetValue()) }),
+		WithOnRetryScheduled(func(item *Item, delay time.Duration) { r.add("retry:%s:%v", item.GetValue(), delay) }),
+		WithOnDeadLetter(func(item *Item) { r.add("dead:%s", item.GetValue()) }),
+	}
+}
+
+// TestHooks_MemoryTimeline 内存队列按 入队 → 派发 → 重试 → 派发 → ack 的顺序回调；重试耗尽时回调死信
+func TestHooks_MemoryTimeline(t *testing.T) {
+	rec := &hookRecorder{}
+	opts := append(rec.options(), WithLogger(NopLogger()), WithRetryTimes(1), WithRetryInterval(100*time.Millisecond))
+	var attempts int64
+	tp := NewMemoryTopicQueue(context.Background(), "hooks", opts...)
+	if err := tp.Start(func(item *Item) error {
+		if string(item.GetValue()) == "bad" || atomic.AddInt64(&attempts, 1) == 1 {
+			return errors.New("fail")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	if err := tp.Push(&Item{Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.joined(), "pushed:a,dispatched:a,retry:a:100ms,dispatched:a,acked:a"; got != want {
+		t.Fatalf("timeline\n got %s\nwant %s", got, want)
+	}
+
+	rec.events = nil
+	if err := tp.PushBatch([]*Item{{Value: []byte("bad")}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.joined(), "pushed:bad,dispatched:bad,retry:bad:100ms,dispatched:bad,dead:bad"; got != want {
+		t.Fatalf("dead letter timeline\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestHooks_ManualAckAndPanic 手动 Ack 回调 OnAcked；钩子 panic 被捕获，不影响 item 处理
+func TestHooks_ManualAckAndPanic(t *testing.T) {
+	var acked int64
+	tp := NewMemoryTopicQueue(context.Background(), "hooks-manual",
+		WithLogger(NopLogger()),
+		WithOnDispatched(func(*Item) { panic("hook panic") }),
+		WithOnAcked(func(*Item) { atomic.AddInt64(&acked, 1) }),
+	)
+	if err := tp.StartManualAck(func(_ *Item, ack Acker) { ack.Ack() }); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	for i := 0; i < 3; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("m%d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&acked); n != 3 {
+		t.Fatalf("want 3 acked got %d", n)
+	}
+}
+
+// TestHooks_Redis 入队仅在写入成功后回调；ackFailed 成功后回调重试延迟；
+// reclaim 与租约回收把搬回的 value 交给 OnReclaimed
+func TestHooks_Redis(t *testing.T) {
+	rec := &hookRecorder{}
+	b := &fakeScriptBuilder{}
+	opts := append(rec.options(),
+		WithRedisScriptBuilder(b),
+		WithLogger(NopLogger()),
+		WithConsumerID("pod-a"),
+		WithRetryInterval(3*time.Second),
+		WithOnReclaimed(func(topic string, values [][]byte) {
+			var vs []string
+			for _, v := range values {
+				vs = append(vs, string(v))
+			}
+			rec.add("reclaimed:%s:%s", topic, strings.Join(vs, "|"))
+		}),
+	)
+	rq := NewRedisTopicQueue(context.Background(), "hooks-redis", opts...).(*redisQueue)
+	stubAllScriptsOK(b)
+	if err := rq.Push(&Item{Value: []byte("p1"), DelaySecond: 5}); err != nil {
+		t.Fatal(err)
+	}
+	b.scripts[idxAdd].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return nil, errors.New("redis down")
+	}
+	if err := rq.PushBatch([]*Item{{Value: []byte("p2")}}); err == nil {
+		t.Fatal("want add error")
+	}
+	if err := rq.onFailed(&Item{Value: []byte("f1")}); err != nil {
+		t.Fatal(err)
+	}
+	b.scripts[idxMove].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{"r1", "100", "r2", "101"}, nil
+	}
+	b.scripts[idxConsumers].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{"pod-b", "0"}, nil
+	}
+	b.scripts[idxLeaseReclaim].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{"l1"}, nil
+	}
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	want := "pushed:p1,retry:f1:3s,reclaimed:hooks-redis:l1,reclaimed:hooks-redis:r1|r2"
+	if got := rec.joined(); got != want {
+		t.Fatalf("events\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package delayq
+
+import (
+	"sync"
+	"time"
+)
+
+// latenessWindowSize Status.MaxLateness 的统计窗口：报告最近一到两个窗口内观测到的最大派发延迟
+const latenessWindowSize = time.Minute
+
+// latenessWindow 记录最近一段时间内的最大派发延迟（实际派发时间 - 计划执行时间）。
+// 按固定窗口滚动，只保留当前与上一个窗口的最大值，开销与派发次数无关。
+type latenessWindow struct {
+	mu    sync.Mutex
+	start time.Time
+	cur   time.Duration
+	prev  time.Duration
+}
+
+// rotateLocked 当前窗口结束时滚动；超过两个窗口无观测时清零
+func (w *latenessWindow) rotateLocked(now time.Time) {
+	if elapsed := now.Sub(w.start); elapsed >= latenessWindowSize {
+		if elapsed >= 2*latenessWindowSize {
+			w.prev = 0
+		} else {
+			w.prev = w.cur
+		}
+		w.cur = 0
+		w.start = now
+	}
+}
+
+func (w *latenessWindow) observe(now time.Time, d time.Duration) {
+	w.mu.Lock()
+	w.rotateLocked(now)
+	if d > w.cur {
+		w.cur = d
+	}
+	w.mu.Unlock()
+}
+
+func (w *latenessWindow) max(now time.Time) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rotateLocked(now)
+	if w.prev > w.cur {
+		return w.prev
+	}
+	return w.cur
+}
+
+// observeLateness 在派发时上报实际时间与计划执行时间之差；提前派发（如分层队列提前拉取）记为 0
+func (q *baseQueue) observeLateness(now, scheduled time.Time) {
+	d := now.Sub(scheduled)
+	if d < 0 {
+		d = 0
+	}
+	q.monitorDuration(MetricLatenessMs, d)
+	q.lateness.observe(now, d)
+}
+
+// maxLateness 最近一到两个统计窗口内的最大派发延迟
+func (q *baseQueue) maxLateness() time.Duration {
+	return q.lateness.max(nowFunc())
+}
@@ -0,0 +1,107 @@
+package delayq
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestLateness_MemoryWheel 时间轮节点记录计划执行时间，派发时上报延迟并进入 Status.MaxLateness
+func TestLateness_MemoryWheel(t *testing.T) {
+	var observed int64 = -1
+	q := New(WithLogger(NopLogger()), WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+		if metric == MetricLatenessMs {
+			atomic.StoreInt64(&observed, value)
+		}
+	})).(*queue)
+	defer q.Close()
+	tq := q.newTopicQueue("late")
+	q.topicQueues.Store(tq.Topic(), tq)
+	mq := tq.(*memQueue)
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	base := time.UnixMilli(time.Now().UnixMilli())
+	nowFunc = func() time.Time { return base }
+	mq.insertOne(&Item{Value: []byte("a")}, 0)
+	nowFunc = func() time.Time { return base.Add(3 * time.Second) }
+	if items := mq.advanceShards(); len(items) != 1 {
+		t.Fatalf("want 1 due item got %d", len(items))
+	}
+	if v := atomic.LoadInt64(&observed); v != 3000 {
+		t.Fatalf("want lateness 3000ms got %d", v)
+	}
+	if d := q.Status().MaxLateness["late"]; d != 3*time.Second {
+		t.Fatalf("want max lateness 3s got %v", d)
+	}
+	// 超过两个统计窗口没有新的派发，最大延迟清零
+	nowFunc = func() time.Time { return base.Add(3*time.Second + 2*latenessWindowSize) }
+	if d := q.Status().MaxLateness["late"]; d != 0 {
+		t.Fatalf("max lateness should expire, got %v", d)
+	}
+}
+
+// TestLateness_Window 当前窗口结束后仍报告上一个窗口的最大值
+func TestLateness_Window(t *testing.T) {
+	var w latenessWindow
+	base := time.Now()
+	w.observe(base, 5*time.Second)
+	w.observe(base.Add(time.Second), time.Second)
+	next := base.Add(latenessWindowSize + time.Second)
+	w.observe(next, 2*time.Second)
+	if d := w.max(next); d != 5*time.Second {
+		t.Fatalf("previous window max should be kept, got %v", d)
+	}
+	if d := w.max(next.Add(latenessWindowSize)); d != 2*time.Second {
+		t.Fatalf("want 2s after rotation got %v", d)
+	}
+}
+
+// TestLateness_RedisPoll poll 按 delay 集 score（计划执行秒数）计算派发延迟；提前派发记为 0
+func TestLateness_RedisPoll(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	observed := make(chan int64, 4)
+	rq := NewRedisTopicQueue(context.Background(), "late-redis",
+		WithRedisScriptBuilder(b),
+		WithLogger(NopLogger()),
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			if metric == MetricLatenessMs {
+				observed <- value
+			}
+		}),
+	).(*redisQueue)
+	stubAllScriptsOK(b)
+	var polled int32
+	now := time.Now().Unix()
+	b.scripts[idxPoll].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		if atomic.CompareAndSwapInt32(&polled, 0, 1) {
+			late := strconv.FormatFloat(float64(now-5)-3e-6, 'f', -1, 64)
+			early := strconv.FormatFloat(float64(now+60), 'f', -1, 64)
+			return []interface{}{"a", late, int64(0), int64(0), "b", early, int64(0), int64(0)}, nil
+		}
+		return nil, nil
+	}
+	if err := rq.Start(noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	defer rq.Close()
+	var got []int64
+	for len(got) < 2 {
+		select {
+		case v := <-observed:
+			got = append(got, v)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lateness not observed, got %v", got)
+		}
+	}
+	if got[0] < 5000 || got[0] > 8000 || got[1] != 0 {
+		t.Fatalf("unexpected lateness %v", got)
+	}
+	if d := rq.maxLateness(); d < 5*time.Second || d > 8*time.Second {
+		t.Fatalf("unexpected max lateness %v", d)
+	}
+}
@@ -4,22 +4,17 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const wheelSize = 3600
-
-type wheelNode struct {
-	cycleCount int
-	wheelIndex int
-	priority   int32
-	canceled   bool // Cancel 标记，ticker 时跳过
-	item       *Item
-	next       *wheelNode
-}
-
-type wheel struct {
-	nodes *wheelNode
+// subSecondRetry 一个等待 time.AfterFunc 派发的亚秒重试
+type subSecondRetry struct {
+	item  *Item
+	at    time.Time
+	timer *time.Timer
+	// done 在 timer 回调结束或被 Cancel 停止时关闭
+	done chan struct{}
 }
 
 type ticker struct {
@@ -50,16 +45,30 @@ type baseQueue struct {
 	// 用于 Redis 心跳延期等扩展。
 	onItemStart func(*Item) (stop func())
 	limiter     *tokenBucket // Push 限流器，nil 表示不限流
+	// history item 生命周期历史；未配置 HistorySize 或后端不支持时为 nil
+	history historyStore
+	// metrics Collector 的原生 Prometheus 指标，由 queue 外观层注入；独立构造时为 nil
+	metrics atomic.Pointer[nativeMetrics]
+	// lateness 最近的最大派发延迟，供 Status.MaxLateness 使用
+	lateness latenessWindow
+
+	// tickerRetryAfter 在 ticker 出错时返回至少需要等待的时长，与指数退避取较大值；
+	// 用于 Redis 熔断打开期间推迟 ticker 重试。nil 表示仅使用指数退避
+	tickerRetryAfter func(err error) time.Duration
 
 	// wg 用于 ticker goroutine 的等待
 	wg sync.WaitGroup
 	// execWG 用于业务处理 goroutine 的等待，Close 时保证所有 handler 返回
 	execWG sync.WaitGroup
-	// sem worker pool 信号量，nil 表示不限制
+	// sem 并发信号量，nil 表示不限制；启用 WorkerPool 时为 nil
 	sem chan struct{}
-	// inFlight 当前正在执行 handler 的 goroutine 数（不含等待 sem 的）
+	// poolSize 常驻 worker 数；0 表示每个 item 启动一个 goroutine
+	poolSize int
+	// work worker 池的派发通道（无缓冲）：worker 全忙时派发方阻塞，item 不会滞留在通道中
+	work chan poolTask
+	// inFlight 当前正在执行 handler 的数量（不含等待 sem / worker 的）
 	inFlight atomicInt64
-	// pendingExec ticker 已检出但 execute 尚未启动 goroutine 的 item 数；
+	// pendingExec ticker 已检出但尚未登记到 inFlight 的 item 数；
 	// 用于 Drain 判定"全部消化"语义，避免 (count=0, inFlight=0) 的瞬时窗口
 	pendingExec atomicInt64
 
@@ -83,7 +92,9 @@ func newBaseQueue(ctx context.Context, topic string, opts *Options) *baseQueue {
 	if q.log == nil {
 		q.log = newDefaultLogger()
 	}
-	if n := opts.GetMaxConcurrency(); n > 0 {
+	if n := opts.GetWorkerPool(); n > 0 {
+		q.poolSize = n
+	} else if n := opts.GetMaxConcurrency(); n > 0 {
 		q.sem = make(chan struct{}, n)
 	}
 	if rate := opts.GetPushRatePerSec(); rate > 0 {
@@ -133,6 +144,9 @@ func (q *baseQueue) drain(ctx context.Context, lengthFn func() int64) error {
 
 // invokeDeadLetter 安全调用用户的 OnDeadLetter 回调，捕获 panic
 func (q *baseQueue) invokeDeadLetter(item *Item) {
+	if q.history != nil {
+		q.recordHistory(historyEntry{value: item.GetValue(), event: q.historyEvent(HistoryDeadLetter), terminal: true})
+	}
 	f := q.opts.GetOnDeadLetter()
 	if f == nil {
 		q.log.Warnf("topic=%s dead letter: %v", q.topic, item)
@@ -149,7 +163,7 @@ func (q *baseQueue) invokeDeadLetter(item *Item) {
 // prepareItem 在 Push 前对 item 进行规范化与告警：
 //   - 检查 drain 状态
 //   - 检查限流（消耗 1 token）
-//   - 注入 topic、校验 value 大小
+//   - 注入 topic、调用 PushInterceptor、校验 value 大小
 //
 // 返回 nil 表示通过；返回 error 表示拒绝入队。
 func (q *baseQueue) prepareItem(item *Item) error {
@@ -175,7 +189,7 @@ func (q *baseQueue) prepareItemNoRate(item *Item) error {
 	return q.normalizeItem(item)
 }
 
-// normalizeItem 注入 topic 并对大 value 记 WARN
+// normalizeItem 注入 topic、调用 PushInterceptor 并对大 value 记 WARN
 func (q *baseQueue) normalizeItem(item *Item) error {
 	// 如果用户没填 Topic 或填错（非该 queue 的 topic），用 queue.topic 覆盖
 	if item.GetTopic() != q.topic {
@@ -184,6 +198,9 @@ func (q *baseQueue) normalizeItem(item *Item) error {
 		}
 		item.Topic = q.topic
 	}
+	if err := applyPushInterceptors(item, q.opts.GetPushInterceptor()); err != nil {
+		return err
+	}
 	if size := len(item.GetValue()); size >= largeValueWarnThreshold {
 		q.log.Warnf("topic=%s pushing large item value: size=%d bytes (recommended <= 1KB; consider storing payload externally and pushing only an ID)",
 			q.topic, size)
@@ -215,7 +232,7 @@ func (q *baseQueue) executeOneWithRetry(item *Item) {
 	start := nowFunc()
 	defer func() {
 		q.inFlight.Add(-1)
-		q.monitorObserve(MetricHandleDurationMs, nowFunc().Sub(start).Milliseconds())
+		q.monitorDuration(MetricHandleDurationMs, nowFunc().Sub(start))
 	}()
 
 	// onItemStart 钩子：用于 Redis 模式启动 heartbeat 等扩展
@@ -226,6 +243,7 @@ func (q *baseQueue) executeOneWithRetry(item *Item) {
 	if stopHook != nil {
 		defer stopHook()
 	}
+	q.notifyDispatched(item)
 
 	// manual ack 模式：派发给用户回调 + Acker，由用户决定何时 ack
 	if q.manualHandler != nil {
@@ -248,12 +266,15 @@ func (q *baseQueue) executeOneWithRetry(item *Item) {
 		q.monitorCount(MetricHandlePanic)
 	}
 	if err != nil {
+		q.notifyFailed(item, err)
 		if ferr := q.failed.call(item); ferr != nil {
 			q.log.Errorf("topic=%s failed callback error: %v item=%v", q.topic, ferr, item)
 		}
 	} else {
 		if serr := q.success.call(item); serr != nil {
 			q.log.Errorf("topic=%s success callback error: %v item=%v", q.topic, serr, item)
+		} else {
+			q.notifyAcked(item)
 		}
 	}
 }
@@ -265,6 +286,8 @@ func (q *baseQueue) executeOneWithRetry(item *Item) {
 //  2. 阻塞式获取信号量；若期间感知到关闭（exitC / ctx.Done）则退出
 //  3. 信号量获取成功后 execWG.Add(1) + inFlight.Add(1)，保证 wg 严格成对
 //  4. 子 goroutine 内 defer 释放信号量并 Done
+//
+// 启用 WorkerPool 时改由 dispatchToPool 交给常驻 worker，不再按 item 启动 goroutine。
 func (q *baseQueue) execute(items ...*Item) {
 	q.executeInternal(items, false)
 }
@@ -280,6 +303,10 @@ func (q *baseQueue) executeInternal(items []*Item, hasPending bool) {
 	if len(items) == 0 {
 		return
 	}
+	if q.work != nil {
+		q.dispatchToPool(items, hasPending)
+		return
+	}
 	useSem := q.sem != nil
 	for i, item := range items {
 		if q.isClosed() {
@@ -321,6 +348,59 @@ func (q *baseQueue) executeInternal(items []*Item, hasPending bool) {
 	}
 }
 
+// poolTask worker 池中的一个待执行 item
+type poolTask struct {
+	item *Item
+	// pending item 已计入 pendingExec，由接收的 worker 在登记 inFlight 后扣减
+	pending bool
+}
+
+// dispatchToPool 把 items 逐个交给空闲 worker；worker 全忙时阻塞，感知到关闭则丢弃剩余 items。
+// execWG 在发送前 +1：发送成功后由 worker Done，发送失败时在这里 Done，保证 Close 不会漏等。
+func (q *baseQueue) dispatchToPool(items []*Item, hasPending bool) {
+	for i, item := range items {
+		if q.isClosed() {
+			if hasPending {
+				q.pendingExec.Add(-int64(len(items) - i))
+			}
+			return
+		}
+		q.execWG.Add(1)
+		select {
+		case q.work <- poolTask{item: item, pending: hasPending}:
+			continue
+		case <-q.exitC:
+		case <-q.ctx.Done():
+		}
+		q.execWG.Done()
+		if hasPending {
+			q.pendingExec.Add(-int64(len(items) - i))
+		}
+		return
+	}
+}
+
+// runWorker 常驻 worker：循环从 work 通道取 item 执行，队列关闭后退出。
+// 与 goroutine 模式相同，先 inFlight+1 再扣减 pendingExec，Drain 不会观察到空窗。
+func (q *baseQueue) runWorker() {
+	defer q.wg.Done()
+	for {
+		select {
+		case t := <-q.work:
+			q.inFlight.Add(1)
+			if t.pending {
+				q.pendingExec.Add(-1)
+			}
+			q.executeOneWithRetry(t.item)
+			q.execWG.Done()
+		case <-q.exitC:
+			return
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
 func (q *baseQueue) close() error {
 	if !q.started.CompareAndSwap(1, 0) {
 		return ErrTopicQueueHasClosed
@@ -342,9 +422,23 @@ func (q *baseQueue) start(f func(item *Item) error, ts ...ticker) error {
 		return ErrTopicQueueHasStarted
 	}
 	q.wg.Add(len(ts))
+	if mws := q.opts.GetHandlerMiddleware(); len(mws) > 0 {
+		if q.manualHandler != nil {
+			q.manualHandler = chainManualHandler(q.manualHandler, mws)
+		} else {
+			f = chainHandler(f, mws)
+		}
+	}
 	q.handle = f
 	q.exitC = make(chan struct{})
 	q.closeOnce = sync.Once{}
+	if q.poolSize > 0 {
+		q.work = make(chan poolTask)
+		q.wg.Add(q.poolSize)
+		for i := 0; i < q.poolSize; i++ {
+			go q.runWorker()
+		}
+	}
 	var doTicker = func(ti ticker) {
 		t := time.NewTimer(0)
 		defer func() {
@@ -364,6 +458,11 @@ func (q *baseQueue) start(f func(item *Item) error, ts ...ticker) error {
 					if backoff := backoffDuration(ti.d, consecutiveErrs, tickerErrorBackoffMax); backoff > next {
 						next = backoff
 					}
+					if q.tickerRetryAfter != nil {
+						if d := q.tickerRetryAfter(err); d > next {
+							next = d
+						}
+					}
 				} else if consecutiveErrs > 0 {
 					q.log.Infof("topic=%s ticker recovered after %d consecutive errors", q.topic, consecutiveErrs)
 					consecutiveErrs = 0
@@ -411,33 +510,67 @@ func backoffDuration(base time.Duration, failures int, maxBackoff time.Duration)
 
 type memQueue struct {
 	*baseQueue
-	index int
 
-	// mx 保护 wheels、count、byValue、index
-	mx     sync.Mutex
-	wheels [wheelSize]wheel
-	// count 跟踪所有在队列中的节点数（含 canceled），用于 Length
-	count int64
-	// byValue 用于按 value 反查节点，支持 Get / Cancel；DisableValueIndex=true 时为 nil
-	byValue map[string][]*wheelNode
+	// shards 按 value 哈希划分的时间轮分片，各自加锁；MemoryShards<=1 时只有一个分片
+	shards []*memShard
+	// journal 持久化扩展（fileQueue 的 WAL）；nil 表示纯内存
+	journal journal
+}
+
+// journal memQueue 的持久化扩展，由 fileQueue 实现。
+// memQueue 在 item 进入时间轮前、处理完成后、被取消时回调，保证重启后可重放出未完成的 item。
+type journal interface {
+	// pushed 在 items 进入时间轮前调用，execAts 为对应的绝对执行时间；返回 error 时放弃入队
+	pushed(items []*Item, execAts []time.Time) error
+	// done 在 item 处理完成（成功、投递死信、已转为重试 item）后调用
+	done(item *Item)
+	// canceled 在 items 被 Cancel 标记后调用，调用时持有 items 所在分片的 memShard.mx
+	canceled(items []*Item)
+}
+
+// journalPush 在入队前记录 items；未启用 journal 时直接返回 nil
+func (q *memQueue) journalPush(items []*Item, delays []time.Duration) error {
+	if q.journal == nil {
+		return nil
+	}
+	now := nowFunc()
+	execAts := make([]time.Time, len(items))
+	for i, d := range delays {
+		execAts[i] = now.Add(d)
+	}
+	return q.journal.pushed(items, execAts)
+}
+
+// journalDone 记录 item 处理完成；未启用 journal 时为 no-op
+func (q *memQueue) journalDone(item *Item) {
+	if q.journal != nil {
+		q.journal.done(item)
+	}
 }
 
 // NewMemoryTopicQueue 构造一个仅在内存中的延迟队列。
-// 时间轮粒度为 1 秒，最大延迟受 wheelSize（3600 秒）* cycle 约束（无硬上限）。
+// 时间轮粒度为 1 秒，分三层（1 秒 / 1 小时 / 150 天槽位），长延迟 item 不增加每秒 tick 的开销。
 func NewMemoryTopicQueue(ctx context.Context, topic string, opts ...Option) TopicQueue {
 	return newMemoryTopicQueue(ctx, topic, newConfig(opts...))
 }
 
 func newMemoryTopicQueue(ctx context.Context, topic string, opts *Options) TopicQueue {
-	q := &memQueue{}
-	if !opts.GetDisableValueIndex() {
-		q.byValue = make(map[string][]*wheelNode)
-	}
+	q := &memQueue{shards: newMemShards(opts.GetMemoryShards(), !opts.GetDisableValueIndex())}
 	q.baseQueue = newBaseQueue(ctx, topic, opts)
 	q.failed = q.onFailed
+	q.success = q.onSuccess
+	if opts.GetHistorySize() > 0 {
+		q.history = newMemHistory(opts)
+	}
 	return q
 }
 
+// onSuccess 内存队列的成功回调：仅在启用 journal 时记录完成
+func (q *memQueue) onSuccess(item *Item) error {
+	q.journalDone(item)
+	return nil
+}
+
 // onFailed 内存队列的失败回调
 // 语义：Item.DelaySecond 为负时，其绝对值作为已失败次数。
 // RetryTimes 语义：
@@ -457,6 +590,7 @@ func (q *memQueue) onFailed(item *Item) error {
 	rt := q.opts.GetRetryTimes()
 	if rt >= 0 && failedCount > rt {
 		q.invokeDeadLetter(item)
+		q.journalDone(item)
 		return nil
 	}
 	retry := &Item{
@@ -465,52 +599,89 @@ func (q *memQueue) onFailed(item *Item) error {
 		Value:       item.GetValue(),
 	}
 	delay := computeRetryDelay(q.opts, failedCount)
+	var err error
 	// 亚秒重试：直接 time.AfterFunc 旁路时间轮（时间轮粒度 1s 会把 <1s 截断为 1s）。
 	if delay > 0 && delay < time.Second {
-		return q.scheduleSubSecondRetry(retry, delay)
+		err = q.scheduleSubSecondRetry(retry, delay)
+	} else {
+		delaySec := int64(delay / time.Second)
+		if delaySec < 0 {
+			delaySec = 0
+		}
+		delay = time.Duration(delaySec) * time.Second
+		err = q.pushRetry(retry, delaySec)
 	}
-	delaySec := int64(delay / time.Second)
-	if delaySec < 0 {
-		delaySec = 0
+	if err != nil {
+		return err
 	}
-	return q.pushRetry(retry, delaySec)
+	q.notifyRetryScheduled(item, delay)
+	// 重试 item 已记录，原 item 视为完成
+	q.journalDone(item)
+	return nil
 }
 
 // scheduleSubSecondRetry 在亚秒级延迟后直接派发 item 到 execute（旁路时间轮）。
 // 时间轮粒度 1s 会把 <1s 的 retry delay 截断到下一个 tick，导致 LowLatencyPreset
 // 等亚秒重试间隔不生效；本路径用 time.AfterFunc 解决。
+// 等待中的重试登记在 retries 索引中，Get / Cancel 与时间轮中的 item 行为一致。
 //
 // 队列关闭时取消 timer 并立即丢弃，返回 nil。
 func (q *memQueue) scheduleSubSecondRetry(item *Item, delay time.Duration) error {
 	if q.isClosed() {
 		return ErrTopicQueueHasClosed
 	}
+	if err := q.journalPush([]*Item{item}, []time.Duration{delay}); err != nil {
+		return err
+	}
 	// pendingExec 计入正在等待重试派发的 item，避免 Drain 早退
 	q.pendingExec.Add(1)
-	doneCh := make(chan struct{})
-	t := time.AfterFunc(delay, func() {
-		defer close(doneCh)
+	r := &subSecondRetry{item: item, at: nowFunc().Add(delay), done: make(chan struct{})}
+	sh := q.shardOf(item.GetValue())
+	// 持锁创建 timer，保证回调摘除索引时 r.timer 已赋值
+	sh.mx.Lock()
+	r.timer = time.AfterFunc(delay, func() {
+		defer close(r.done)
+		sh.mx.Lock()
+		sh.forgetRetryLocked(r)
+		sh.mx.Unlock()
 		if q.isClosed() {
 			q.pendingExec.Add(-1)
 			return
 		}
 		// 直接派发到 execute；executeWithPending 会负责 -1 pendingExec 并 +1 inFlight
+		q.observeLateness(nowFunc(), r.at)
 		q.executeWithPending(item)
 	})
+	if sh.retries != nil {
+		key := string(item.GetValue())
+		sh.retries[key] = append(sh.retries[key], r)
+	}
+	sh.mx.Unlock()
 	// 队列关闭时立即取消 timer，避免阻塞 close
 	go func() {
 		select {
 		case <-q.exitC:
-			if t.Stop() {
-				// timer 还未触发，回退 pendingExec 计数
-				q.pendingExec.Add(-1)
-			}
-		case <-doneCh:
+			sh.mx.Lock()
+			q.stopRetryLocked(sh, r)
+			sh.mx.Unlock()
+		case <-r.done:
 		}
 	}()
 	return nil
 }
 
+// stopRetryLocked 在持有 sh.mx 时停止尚未触发的亚秒重试：回退 pendingExec 并移出索引，返回是否停止成功。
+// timer 已触发时返回 false，由回调负责派发与清理。
+func (q *memQueue) stopRetryLocked(sh *memShard, r *subSecondRetry) bool {
+	if !r.timer.Stop() {
+		return false
+	}
+	q.pendingExec.Add(-1)
+	sh.forgetRetryLocked(r)
+	close(r.done)
+	return true
+}
+
 // pushRetry 按给定 delaySecond 重新入队，不修改 item.DelaySecond 中编码的失败计数
 func (q *memQueue) pushRetry(item *Item, delaySecond int64) error {
 	if q.isClosed() {
@@ -519,129 +690,94 @@ func (q *memQueue) pushRetry(item *Item, delaySecond int64) error {
 	if delaySecond < 0 {
 		delaySecond = 0
 	}
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	q.insertLocked(item, delaySecond)
+	if err := q.journalPush([]*Item{item}, []time.Duration{time.Duration(delaySecond) * time.Second}); err != nil {
+		return err
+	}
+	q.insertOne(item, delaySecond)
 	return nil
 }
 
-// insertLocked 在持锁状态下把 item 插入到对应槽位，按 priority 降序保持链表有序
-func (q *memQueue) insertLocked(item *Item, delaySecond int64) {
-	calculateValue := int64(q.index) + delaySecond
-	cycle := int(calculateValue / wheelSize)
-	idx := int(calculateValue % wheelSize)
-
-	n := &wheelNode{
-		cycleCount: cycle,
-		wheelIndex: idx,
-		priority:   item.GetPriority(),
-		item:       item,
-	}
-	// 按 priority 降序插入链表。
-	// 当 head.priority <= n.priority 时直接头插：高优先级在前；
-	// 同 priority 时新节点也插到队首（不保证 FIFO，但 push 路径 O(1)）。
-	head := q.wheels[idx].nodes
-	if head == nil || head.priority <= n.priority {
-		n.next = head
-		q.wheels[idx].nodes = n
-	} else {
-		prev := head
-		for prev.next != nil && prev.next.priority > n.priority {
-			prev = prev.next
-		}
-		n.next = prev.next
-		prev.next = n
-	}
-	q.count++
-	if q.byValue == nil {
-		return
-	}
-	if v := item.GetValue(); len(v) != 0 {
-		key := string(v)
-		q.byValue[key] = append(q.byValue[key], n)
+// ticker 时间轮推进：检出当前 tick 所有分片中到期的节点，批量派发给 execute
+func (q *memQueue) ticker() error {
+	if due := q.advanceShards(); len(due) > 0 {
+		q.executeWithPending(due...)
 	}
+	return nil
 }
 
-// removeFromByValueLocked 在持锁下移除 byValue 索引中的节点
-func (q *memQueue) removeFromByValueLocked(n *wheelNode) {
-	if q.byValue == nil {
-		return
-	}
-	v := string(n.item.GetValue())
-	if v == "" {
-		return
-	}
-	list := q.byValue[v]
-	for i, p := range list {
-		if p == n {
-			list = append(list[:i], list[i+1:]...)
-			break
-		}
+// Start 启动时间轮；配置 MemorySnapshotPath 时加载 Close 保存的快照
+func (q *memQueue) Start(f func(item *Item) error) error {
+	if err := q.start(f, q.wheelTickers()...); err != nil {
+		return err
 	}
-	if len(list) == 0 {
-		delete(q.byValue, v)
-	} else {
-		q.byValue[v] = list
+	q.restoreOnStart()
+	return nil
+}
+
+// StartManualAck 启动手动 ack 模式
+func (q *memQueue) StartManualAck(f func(item *Item, ack Acker)) error {
+	q.manualHandler = f
+	if err := q.start(func(*Item) error { return nil }, q.wheelTickers()...); err != nil {
+		return err
 	}
+	q.restoreOnStart()
+	return nil
 }
 
-// ticker 时间轮推进：检出当前槽位所有到期节点，批量派发给 execute
-func (q *memQueue) ticker() error {
-	q.mx.Lock()
-	headIndex := q.index % wheelSize
-	q.index = headIndex + 1
-
-	// 使用 dummy head 简化链表删除
-	dummy := &wheelNode{next: q.wheels[headIndex].nodes}
-	prev := dummy
-	var due []*Item
-	for p := dummy.next; p != nil; {
-		if p.cycleCount == 0 {
-			// 取出并从链表中摘除
-			if !p.canceled {
-				due = append(due, p.item)
-			}
-			q.count--
-			q.removeFromByValueLocked(p)
-			prev.next = p.next
-			p = p.next
-		} else {
-			p.cycleCount--
-			prev = p
-			p = p.next
-		}
+// wheelTickers 时间轮推进与（启用时）已取消节点压缩两个 ticker，文件 / 分层队列复用
+func (q *memQueue) wheelTickers() []ticker {
+	ts := []ticker{{d: 1 * time.Second, f: q.ticker}}
+	if d := q.opts.GetMemoryCompactInterval(); d > 0 {
+		ts = append(ts, ticker{d: d, f: q.compactCanceled})
 	}
-	q.wheels[headIndex].nodes = dummy.next
-	// 在持锁期间预加 pendingExec，避免 unlock → execute 之间出现
-	// (count=0, inFlight=0, pendingExec=0) 的瞬时窗口导致 Drain 早退
-	if n := len(due); n > 0 {
-		q.pendingExec.Add(int64(n))
+	if h, ok := q.history.(*memHistory); ok {
+		ts = append(ts, ticker{d: historySweepInterval, f: h.sweep})
 	}
-	q.mx.Unlock()
+	return ts
+}
 
-	if len(due) > 0 {
-		q.executeWithPending(due...)
+// compactCanceled 逐个分片检查：已取消节点达到存活节点数的 1/4 时遍历该分片的时间轮，
+// 把它们摘除并移出 value 索引。按比例触发避免少量取消时反复全量遍历；持锁时间与分片节点数成正比。
+func (q *memQueue) compactCanceled() error {
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		if sh.canceledNodes > 0 && sh.canceledNodes*4 >= sh.count {
+			sh.compactCanceledLocked()
+		}
+		sh.mx.Unlock()
 	}
 	return nil
 }
 
-func (q *memQueue) Start(f func(item *Item) error) error {
-	return q.start(f, ticker{d: 1 * time.Second, f: q.ticker})
-}
-
-// StartManualAck 启动手动 ack 模式
-func (q *memQueue) StartManualAck(f func(item *Item, ack Acker)) error {
-	q.manualHandler = f
-	return q.start(func(*Item) error { return nil }, ticker{d: 1 * time.Second, f: q.ticker})
+// restoreOnStart 加载快照；失败只记日志，不阻止启动
+func (q *memQueue) restoreOnStart() {
+	if err := q.restoreSnapshot(); err != nil {
+		q.log.Errorf("topic=%s restore snapshot %s error: %v", q.topic, q.snapshotPath(), err)
+	}
 }
 
+// Length 返回各分片中未取消的 item 数之和
 func (q *memQueue) Length() int64 {
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	return q.count
+	var n int64
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		n += sh.count
+		sh.mx.Unlock()
+	}
+	return n
 }
 
-func (q *memQueue) Close() error { return q.close() }
+// Close 关闭队列并等待在途 handler 返回；配置 MemorySnapshotPath 时把剩余 item 写入快照
+func (q *memQueue) Close() error {
+	if err := q.close(); err != nil {
+		return err
+	}
+	if err := q.saveSnapshot(); err != nil {
+		q.log.Errorf("topic=%s save snapshot %s error: %v", q.topic, q.snapshotPath(), err)
+		return err
+	}
+	return nil
+}
 
 // Drain 进入 drain 状态：拒绝新 Push，等待所有现有 item 派发完毕（Length=0 && InFlight=0）。
 // ctx 取消时提前返回 ctx.Err()。Drain 后队列仍可用（draining 标志被清除）。
@@ -661,13 +797,15 @@ func (q *memQueue) Push(item *Item) error {
 	if delaySecond < 0 {
 		delaySecond = 0
 	}
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	q.insertLocked(item, delaySecond)
+	if err := q.journalPush([]*Item{item}, []time.Duration{time.Duration(delaySecond) * time.Second}); err != nil {
+		return err
+	}
+	q.insertOne(item, delaySecond)
+	q.notifyPushed(item)
 	return nil
 }
 
-// PushBatch 批量推送多个 item（持锁一次性插入全部）。
+// PushBatch 批量推送多个 item（每个分片持锁一次性插入）。
 // 任何一个 item 校验失败都会终止批次（已入队的不会回滚）。
 // 限流时整批一次性扣 len(items) 个 token，不足直接拒绝整批。
 func (q *memQueue) PushBatch(items []*Item) error {
@@ -685,20 +823,26 @@ func (q *memQueue) PushBatch(items []*Item) error {
 		return ErrRateLimited
 	}
 	// 此处 prepareItem 会被旁路（用 prepareItemNoRate）以避免重复扣 token
-	for _, it := range items {
+	delays := make([]int64, len(items))
+	for i, it := range items {
 		if err := q.prepareItemNoRate(it); err != nil {
 			return err
 		}
+		if d := it.GetDelaySecond(); d > 0 {
+			delays[i] = d
+		}
 	}
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	for _, it := range items {
-		delaySecond := it.GetDelaySecond()
-		if delaySecond < 0 {
-			delaySecond = 0
+	if q.journal != nil {
+		ds := make([]time.Duration, len(delays))
+		for i, d := range delays {
+			ds[i] = time.Duration(d) * time.Second
+		}
+		if err := q.journalPush(items, ds); err != nil {
+			return err
 		}
-		q.insertLocked(it, delaySecond)
 	}
+	q.insert(items, delays)
+	q.notifyPushed(items...)
 	return nil
 }
 
@@ -706,27 +850,31 @@ func (q *memQueue) PushBatch(items []*Item) error {
 // 多个相同 value 时返回剩余延迟最小的那个。
 // DisableValueIndex=true 时返回 ErrValueIndexDisabled。
 func (q *memQueue) Get(value []byte) (remaining time.Duration, exists bool, err error) {
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	if q.byValue == nil {
+	sh := q.shardOf(value)
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	if sh.byValue == nil {
 		return 0, false, ErrValueIndexDisabled
 	}
-	list, ok := q.byValue[string(value)]
-	if !ok || len(list) == 0 {
-		return 0, false, nil
-	}
+	key := string(value)
 	// 找到剩余延迟最小的节点
-	minRemain := -1
-	for _, n := range list {
+	minRemain := time.Duration(-1)
+	for _, n := range sh.byValue[key] {
 		if n.canceled {
 			continue
 		}
-		// remaining = (cycleCount * wheelSize + 距离 head 的偏移)
-		offset := n.wheelIndex - q.index
-		if offset < 0 {
-			offset += wheelSize
+		remain := time.Duration(sh.wheel.remaining(n)) * time.Second
+		if minRemain < 0 || remain < minRemain {
+			minRemain = remain
+		}
+	}
+	// 等待中的亚秒重试
+	now := nowFunc()
+	for _, r := range sh.retries[key] {
+		remain := r.at.Sub(now)
+		if remain < 0 {
+			remain = 0
 		}
-		remain := n.cycleCount*wheelSize + offset
 		if minRemain < 0 || remain < minRemain {
 			minRemain = remain
 		}
@@ -734,28 +882,14 @@ func (q *memQueue) Get(value []byte) (remaining time.Duration, exists bool, err
 	if minRemain < 0 {
 		return 0, false, nil
 	}
-	return time.Duration(minRemain) * time.Second, true, nil
+	return minRemain, true, nil
 }
 
-// Cancel 标记所有匹配 value 的节点为 canceled，ticker 时跳过派发并清理。
+// Cancel 标记所有匹配 value 的节点为 canceled，ticker 时跳过派发并清理；
+// 等待中的亚秒重试直接停止。
 // 返回是否至少取消了一个节点。
 // DisableValueIndex=true 时返回 ErrValueIndexDisabled。
 func (q *memQueue) Cancel(value []byte) (bool, error) {
-	q.mx.Lock()
-	defer q.mx.Unlock()
-	if q.byValue == nil {
-		return false, ErrValueIndexDisabled
-	}
-	list, ok := q.byValue[string(value)]
-	if !ok || len(list) == 0 {
-		return false, nil
-	}
-	canceled := false
-	for _, n := range list {
-		if !n.canceled {
-			n.canceled = true
-			canceled = true
-		}
-	}
-	return canceled, nil
+	canceled, err := q.cancelValues([][]byte{value})
+	return len(canceled) > 0, err
 }
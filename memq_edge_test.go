@@ -232,6 +232,71 @@ func TestMemq_RetrySuccessBeforeDeadletter(t *testing.T) {
 	}
 }
 
+// TestMemq_CancelUpdatesLength 验证 Cancel 后 Length 立即扣减，Drain 不再等待已取消的 item
+func TestMemq_CancelUpdatesLength(t *testing.T) {
+	tp := NewMemoryTopicQueue(context.Background(), "cancel-len", WithMemoryCompactInterval(0))
+	defer tp.Close()
+	if err := tp.Start(func(item *Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"a", "a", "b"} {
+		if err := tp.Push(&Item{DelaySecond: 7200, Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tp.Cancel([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if l := tp.Length(); l != 1 {
+		t.Fatalf("want length=1 after cancel got=%d", l)
+	}
+	if _, err := tp.Cancel([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatalf("drain should not wait for canceled items: %v", err)
+	}
+}
+
+// TestMemq_CompactCanceled 验证取消节点达到存活节点 1/4 时被摘除并移出 value 索引，比例不足时保留
+func TestMemq_CompactCanceled(t *testing.T) {
+	q := newMemoryTopicQueue(context.Background(), "compact", newConfig()).(*memQueue)
+	sh := q.shards[0]
+	for i := 0; i < 10; i++ {
+		q.insertOne(&Item{Value: []byte(fmt.Sprintf("v%d", i)), DelaySecond: int64(i)}, int64(i*500))
+	}
+	if _, err := q.Cancel([]byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.compactCanceled(); err != nil {
+		t.Fatal(err)
+	}
+	if sh.canceledNodes != 1 {
+		t.Fatalf("1 canceled among 9 live is below threshold, canceledNodes=%d", sh.canceledNodes)
+	}
+	if _, err := q.cancelBatch([][]byte{[]byte("v2"), []byte("v9")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.compactCanceled(); err != nil {
+		t.Fatal(err)
+	}
+	if sh.canceledNodes != 0 || sh.count != 7 || len(sh.byValue) != 7 {
+		t.Fatalf("unexpected state canceled=%d count=%d index=%d", sh.canceledNodes, sh.count, len(sh.byValue))
+	}
+	nodes := 0
+	sh.wheel.each(func(p *wheelNode) {
+		if p.canceled {
+			t.Fatalf("canceled node %s still linked", p.item.GetValue())
+		}
+		nodes++
+	})
+	if nodes != 7 {
+		t.Fatalf("want 7 linked nodes got %d", nodes)
+	}
+}
+
 // waitGroupTimeout 等 WaitGroup 完成或报错超时
 func waitGroupTimeout(t *testing.T, wg *sync.WaitGroup, d time.Duration) {
 	t.Helper()
@@ -0,0 +1,255 @@
+package delayq
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memShard 内存队列的一个分片：独立加锁的时间轮、计数与 value 索引。
+// 同一 value 总是落在同一分片，Get / Cancel 只需锁定一个分片。
+type memShard struct {
+	// mx 保护本分片的全部字段
+	mx    sync.Mutex
+	wheel timingWheel
+	// count 跟踪时间轮中未取消的节点数，用于 Length / Drain；Cancel 时立即扣减
+	count int64
+	// canceledNodes 已取消但仍挂在时间轮上的节点数，由 ticker 到期或 compactCanceled 摘除
+	canceledNodes int64
+	// byValue 用于按 value 反查节点，支持 Get / Cancel；DisableValueIndex=true 时为 nil
+	byValue map[string][]*wheelNode
+	// retries 旁路时间轮的亚秒重试按 value 索引，支持 Get / Cancel；DisableValueIndex=true 时为 nil
+	retries map[string][]*subSecondRetry
+	// seq 所有分片共享的入队序号计数器，合并派发时同 priority 按序号先进先出
+	seq *atomicInt64
+}
+
+// newMemShards 构造 n 个分片（至少一个）
+func newMemShards(n int, valueIndex bool) []*memShard {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*memShard, n)
+	seq := new(atomicInt64)
+	for i := range shards {
+		sh := &memShard{seq: seq}
+		if valueIndex {
+			sh.byValue = make(map[string][]*wheelNode)
+			sh.retries = make(map[string][]*subSecondRetry)
+		}
+		shards[i] = sh
+	}
+	return shards
+}
+
+// shardOf 返回 value 所在分片
+func (q *memQueue) shardOf(value []byte) *memShard {
+	if len(q.shards) == 1 {
+		return q.shards[0]
+	}
+	return q.shards[shardIndex(value, len(q.shards))]
+}
+
+// insertOne 加锁把 item 插入所在分片
+func (q *memQueue) insertOne(item *Item, delaySecond int64) {
+	sh := q.shardOf(item.GetValue())
+	sh.mx.Lock()
+	sh.insertLocked(item, delaySecond)
+	sh.mx.Unlock()
+}
+
+// insert 按分片分组插入 items，每个分片只加锁一次
+func (q *memQueue) insert(items []*Item, delays []int64) {
+	q.insertAt(items, delays, nil)
+}
+
+// insertAt 同 insert，execAts 非空时为各 item 原计划执行时间（unix 毫秒），
+// 用于恢复快照、导入与分层拉取时保留原执行时间，派发延迟仍从原时间起算
+func (q *memQueue) insertAt(items []*Item, delays []int64, execAts []int64) {
+	execAt := func(i int) int64 {
+		if execAts == nil {
+			return 0
+		}
+		return execAts[i]
+	}
+	if len(q.shards) == 1 {
+		sh := q.shards[0]
+		sh.mx.Lock()
+		for i, it := range items {
+			sh.insertLockedAt(it, delays[i], execAt(i))
+		}
+		sh.mx.Unlock()
+		return
+	}
+	groups := make([][]int, len(q.shards))
+	for i, it := range items {
+		idx := shardIndex(it.GetValue(), len(q.shards))
+		groups[idx] = append(groups[idx], i)
+	}
+	for idx, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		sh := q.shards[idx]
+		sh.mx.Lock()
+		for _, i := range g {
+			sh.insertLockedAt(items[i], delays[i], execAt(i))
+		}
+		sh.mx.Unlock()
+	}
+}
+
+// insertLocked 在持锁状态下把 item 插入时间轮，同一到期秒内按 priority 降序、同 priority 先进先出
+func (sh *memShard) insertLocked(item *Item, delaySecond int64) {
+	sh.insertLockedAt(item, delaySecond, 0)
+}
+
+// insertLockedAt 同 insertLocked，execAt 为计划执行时间（unix 毫秒），<=0 时取 now+delaySecond
+func (sh *memShard) insertLockedAt(item *Item, delaySecond, execAt int64) {
+	if delaySecond < 0 {
+		delaySecond = 0
+	}
+	if execAt <= 0 {
+		execAt = nowFunc().UnixMilli() + delaySecond*1000
+	}
+	n := &wheelNode{
+		expire:   sh.wheel.tick + delaySecond,
+		priority: item.GetPriority(),
+		seq:      sh.seq.Add(1),
+		execAt:   execAt,
+		item:     item,
+	}
+	sh.wheel.add(n)
+	sh.count++
+	if sh.byValue == nil {
+		return
+	}
+	if v := item.GetValue(); len(v) != 0 {
+		key := string(v)
+		sh.byValue[key] = append(sh.byValue[key], n)
+	}
+}
+
+// unlinkedLocked 在节点从链表摘除后调用：更新计数并移出 byValue 索引
+func (sh *memShard) unlinkedLocked(n *wheelNode) {
+	if n.canceled {
+		sh.canceledNodes--
+	} else {
+		sh.count--
+	}
+	sh.removeFromByValueLocked(n)
+}
+
+// removeFromByValueLocked 在持锁下移除 byValue 索引中的节点
+func (sh *memShard) removeFromByValueLocked(n *wheelNode) {
+	if sh.byValue == nil {
+		return
+	}
+	v := string(n.item.GetValue())
+	if v == "" {
+		return
+	}
+	list := sh.byValue[v]
+	for i, p := range list {
+		if p == n {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(sh.byValue, v)
+	} else {
+		sh.byValue[v] = list
+	}
+}
+
+// forgetRetryLocked 在持锁下把亚秒重试移出 retries 索引
+func (sh *memShard) forgetRetryLocked(r *subSecondRetry) {
+	if sh.retries == nil {
+		return
+	}
+	key := string(r.item.GetValue())
+	list := sh.retries[key]
+	for i, p := range list {
+		if p == r {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(sh.retries, key)
+	} else {
+		sh.retries[key] = list
+	}
+}
+
+// advance 推进本分片时间轮一个 tick，返回到期且未取消的节点（按 priority 降序、同 priority 先进先出）。
+// 在持锁期间预加 pendingExec，避免 unlock → execute 之间出现
+// (count=0, inFlight=0, pendingExec=0) 的瞬时窗口导致 Drain 早退。
+func (sh *memShard) advance(pendingExec *atomicInt64) []*wheelNode {
+	sh.mx.Lock()
+	defer sh.mx.Unlock()
+	var due []*wheelNode
+	for p := sh.wheel.advance(); p != nil; p = p.next {
+		if !p.canceled {
+			due = append(due, p)
+		}
+		sh.unlinkedLocked(p)
+	}
+	if n := len(due); n > 0 {
+		pendingExec.Add(int64(n))
+	}
+	return due
+}
+
+// compactCanceledLocked 摘除本分片中已取消的节点
+func (sh *memShard) compactCanceledLocked() {
+	sh.wheel.removeIf(func(p *wheelNode) bool {
+		if p.canceled {
+			sh.unlinkedLocked(p)
+		}
+		return p.canceled
+	})
+}
+
+// resetLocked 清空时间轮与 value 索引（不含亚秒重试）
+func (sh *memShard) resetLocked() {
+	sh.wheel.reset()
+	sh.count, sh.canceledNodes = 0, 0
+	if sh.byValue != nil {
+		sh.byValue = make(map[string][]*wheelNode)
+	}
+}
+
+// advanceShards 并行推进所有分片，合并各分片到期的 item：按 priority 降序，同 priority 按全局入队序号先进先出
+func (q *memQueue) advanceShards() []*Item {
+	var due []*wheelNode
+	if len(q.shards) == 1 {
+		due = q.shards[0].advance(&q.pendingExec)
+	} else {
+		parts := make([][]*wheelNode, len(q.shards))
+		var wg sync.WaitGroup
+		for i, sh := range q.shards {
+			wg.Add(1)
+			go func(i int, sh *memShard) {
+				defer wg.Done()
+				parts[i] = sh.advance(&q.pendingExec)
+			}(i, sh)
+		}
+		wg.Wait()
+		for _, p := range parts {
+			due = append(due, p...)
+		}
+		sort.Slice(due, func(i, j int) bool { return due[i].before(due[j]) })
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	now := nowFunc()
+	items := make([]*Item, len(due))
+	for i, p := range due {
+		items[i] = p.item
+		q.observeLateness(now, time.UnixMilli(p.execAt))
+	}
+	return items
+}
@@ -0,0 +1,115 @@
+package delayq
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMemShard_Routing 分片后同一 value 总落在同一分片，Length/Get/Cancel/CancelByPrefix/Purge 覆盖所有分片
+func TestMemShard_Routing(t *testing.T) {
+	q := newMemoryTopicQueue(context.Background(), "shard", newConfig(WithLogger(NopLogger()), WithMemoryShards(4))).(*memQueue)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if len(q.shards) != 4 {
+		t.Fatalf("want 4 shards got %d", len(q.shards))
+	}
+	var items []*Item
+	for i := 0; i < 100; i++ {
+		items = append(items, &Item{Value: []byte(fmt.Sprintf("k%d", i)), DelaySecond: 60})
+	}
+	if err := q.PushBatch(items[:50]); err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range items[50:] {
+		if err := q.Push(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used := 0
+	for _, sh := range q.shards {
+		if sh.count > 0 {
+			used++
+		}
+		for key := range sh.byValue {
+			if q.shardOf([]byte(key)) != sh {
+				t.Fatalf("value %s indexed in the wrong shard", key)
+			}
+		}
+	}
+	if used < 2 {
+		t.Fatalf("values should spread across shards, used=%d", used)
+	}
+	if n := q.Length(); n != 100 {
+		t.Fatalf("want length 100 got %d", n)
+	}
+	if remain, ok, err := q.Get([]byte("k7")); err != nil || !ok || remain <= 0 {
+		t.Fatalf("Get: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	if ok, err := q.Cancel([]byte("k7")); err != nil || !ok {
+		t.Fatalf("Cancel: ok=%v err=%v", ok, err)
+	}
+	if n, err := q.cancelBatch([][]byte{[]byte("k1"), []byte("k2"), []byte("k7")}); err != nil || n != 2 {
+		t.Fatalf("cancelBatch: n=%d err=%v", n, err)
+	}
+	// k10..k19
+	if n, err := q.cancelByPrefix([]byte("k1")); err != nil || n != 10 {
+		t.Fatalf("cancelByPrefix: n=%d err=%v", n, err)
+	}
+	if n := q.Length(); n != 87 {
+		t.Fatalf("want length 87 got %d", n)
+	}
+	if n, err := q.purge(); err != nil || n != 87 || q.Length() != 0 {
+		t.Fatalf("purge: n=%d err=%v length=%d", n, err, q.Length())
+	}
+}
+
+// TestMemShard_TickerMergesByPriority ticker 并行推进各分片，合并后的到期 item 按 priority 降序，并预加 pendingExec
+func TestMemShard_TickerMergesByPriority(t *testing.T) {
+	q := newMemoryTopicQueue(context.Background(), "shard-prio", newConfig(WithMemoryShards(8))).(*memQueue)
+	for i := 0; i < 64; i++ {
+		q.insertOne(&Item{Value: []byte(fmt.Sprintf("p%d", i)), Priority: int32(i % 7)}, 0)
+	}
+	due := q.advanceShards()
+	if len(due) != 64 || q.pendingExec.Get() != 64 {
+		t.Fatalf("want 64 due items and pendingExec, got %d / %d", len(due), q.pendingExec.Get())
+	}
+	for i := 1; i < len(due); i++ {
+		if due[i].GetPriority() > due[i-1].GetPriority() {
+			t.Fatalf("priority not desc-sorted at %d: %d > %d", i, due[i].GetPriority(), due[i-1].GetPriority())
+		}
+	}
+	if q.Length() != 0 {
+		t.Fatalf("all shards should be empty, length=%d", q.Length())
+	}
+}
+
+// TestMemShard_Drain 分片队列派发全部 item 后 Drain 返回，期间不会因分片间的计数窗口提前返回
+func TestMemShard_Drain(t *testing.T) {
+	var handled int64
+	tp := NewMemoryTopicQueue(context.Background(), "shard-drain", WithLogger(NopLogger()), WithMemoryShards(8))
+	if err := tp.Start(func(*Item) error {
+		atomic.AddInt64(&handled, 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	for i := 0; i < 200; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("d%d", i)), DelaySecond: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&handled); n != 200 {
+		t.Fatalf("want 200 handled got %d", n)
+	}
+}
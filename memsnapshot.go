@@ -0,0 +1,107 @@
+package delayq
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// snapshotPath 返回内存队列快照文件路径（{topic} 已替换）；未配置时返回空串
+func (q *memQueue) snapshotPath() string {
+	return strings.ReplaceAll(q.opts.GetMemorySnapshotPath(), "{topic}", q.topic)
+}
+
+// restoreSnapshot 在 Start 成功后加载快照：按绝对执行时间插入时间轮（停机期间到期的 item 立即到期），
+// 加载成功后删除文件，避免下次启动重复加载。文件不存在时直接返回。
+func (q *memQueue) restoreSnapshot() error {
+	path := q.snapshotPath()
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var recs []*ExportRecord
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		rec := &ExportRecord{}
+		if err = dec.Decode(rec); err == io.EOF {
+			break
+		} else if err != nil {
+			_ = f.Close()
+			return err
+		}
+		recs = append(recs, rec)
+	}
+	_ = f.Close()
+	if err = q.insertRecords(recs); err != nil {
+		return err
+	}
+	if len(recs) > 0 {
+		q.log.Infof("topic=%s restored %d items from snapshot %s", q.topic, len(recs), path)
+	}
+	return os.Remove(path)
+}
+
+// saveSnapshot 在 Close 后把时间轮中剩余的 item 写入快照（临时文件 + rename）并清空时间轮，
+// 保证同一实例再次 Start 时不会与快照重复。没有剩余 item 时删除旧快照。
+func (q *memQueue) saveSnapshot() error {
+	path := q.snapshotPath()
+	if path == "" {
+		return nil
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	n := 0
+	err = q.exportRecords(func(rec *ExportRecord) error {
+		n++
+		return enc.Encode(rec)
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if n == 0 {
+		_ = os.Remove(tmp)
+		if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	q.resetWheel()
+	q.log.Infof("topic=%s saved %d items to snapshot %s", q.topic, n, path)
+	return nil
+}
+
+// resetWheel 清空各分片的时间轮与 value 索引
+func (q *memQueue) resetWheel() {
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		sh.resetLocked()
+		sh.mx.Unlock()
+	}
+}
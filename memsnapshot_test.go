@@ -0,0 +1,144 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMemorySnapshot_SaveAndRestore Close 保存剩余 item，新实例 Start 时恢复并删除快照
+func TestMemorySnapshot_SaveAndRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "{topic}.snap")
+	opts := newConfig(WithLogger(NopLogger()), WithMemorySnapshotPath(path))
+	q := newMemoryTopicQueue(context.Background(), "snap", opts).(*memQueue)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{{Value: []byte("a"), DelaySecond: 100, Priority: 5}, {Value: []byte("b"), DelaySecond: 4000}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Cancel([]byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.pushRetry(&Item{Value: []byte("r"), DelaySecond: -2}, 50); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(filepath.Dir(path), "snap.snap")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Fatalf("want 2 records (canceled excluded) got %d: %s", lines, data)
+	}
+
+	q2 := newMemoryTopicQueue(context.Background(), "snap", opts).(*memQueue)
+	if err = q2.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q2.Close()
+	remain, ok, err := q2.Get([]byte("a"))
+	if err != nil || !ok || remain < 98*time.Second || remain > 100*time.Second {
+		t.Fatalf("a: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	for _, n := range q2.shards[0].byValue["r"] {
+		if n.item.GetDelaySecond() != -2 {
+			t.Fatalf("attempts should survive restart, got %v", n.item)
+		}
+	}
+	for _, n := range q2.shards[0].byValue["a"] {
+		if n.item.GetPriority() != 5 {
+			t.Fatalf("priority should survive restart, got %v", n.item)
+		}
+	}
+	if _, err = os.Stat(file); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("snapshot should be removed after restore: %v", err)
+	}
+}
+
+// TestMemorySnapshot_DowntimeCorrected 停机时长从剩余延迟中扣除，停机期间到期的 item 立即到期
+func TestMemorySnapshot_DowntimeCorrected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dq.snap")
+	opts := newConfig(WithLogger(NopLogger()), WithMemorySnapshotPath(path))
+	q := newMemoryTopicQueue(context.Background(), "down", opts).(*memQueue)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{{Value: []byte("soon"), DelaySecond: 30}, {Value: []byte("later"), DelaySecond: 600}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	later := time.Now().Add(2 * time.Minute)
+	nowFunc = func() time.Time { return later }
+
+	// 不启动 ticker 直接加载快照，避免时间轮推进影响剩余延迟断言
+	q2 := newMemoryTopicQueue(context.Background(), "down", opts).(*memQueue)
+	if err := q2.restoreSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if remain, ok, _ := q2.Get([]byte("soon")); !ok || remain != 0 {
+		t.Fatalf("overdue item should be due immediately, remain=%v ok=%v", remain, ok)
+	}
+	if remain, ok, _ := q2.Get([]byte("later")); !ok || remain < 478*time.Second || remain > 480*time.Second {
+		t.Fatalf("downtime should be subtracted, remain=%v ok=%v", remain, ok)
+	}
+}
+
+// TestMemorySnapshot_RestartSameInstance 同一实例 Close 后再次 Start 不会产生重复 item
+func TestMemorySnapshot_RestartSameInstance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dq.snap")
+	q := newMemoryTopicQueue(context.Background(), "same", newConfig(WithLogger(NopLogger()), WithMemorySnapshotPath(path))).(*memQueue)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("x"), DelaySecond: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if n := q.Length(); n != 1 {
+		t.Fatalf("want 1 item after restart got %d", n)
+	}
+}
+
+// TestMemorySnapshot_CloseGracefullyTimeout CloseGracefully 等待超时后剩余 item 写入快照；无剩余时不留文件
+func TestMemorySnapshot_CloseGracefullyTimeout(t *testing.T) {
+	dir := t.TempDir()
+	dq := New(WithLogger(NopLogger()), WithMemorySnapshotPath(filepath.Join(dir, "{topic}.snap")))
+	for _, topic := range []string{"busy", "idle"} {
+		if err := dq.Start(topic, func(*Item) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dq.Push(&Item{Topic: "busy", Value: []byte("v"), DelaySecond: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := dq.CloseGracefully(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "busy.snap")); err != nil {
+		t.Fatalf("busy topic should be snapshotted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "idle.snap")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("idle topic should not leave a snapshot: %v", err)
+	}
+}
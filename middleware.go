@@ -0,0 +1,100 @@
+package delayq
+
+import (
+	"errors"
+	"sync"
+)
+
+// errNackWithoutReason manual ack 模式下 Nack(nil) 时作为 next 的返回值，保证 middleware 能感知失败
+var errNackWithoutReason = errors.New("delayq: nacked without error")
+
+// HandlerFunc 业务消费回调，与 Start 的 handler 签名一致
+type HandlerFunc func(item *Item) error
+
+// HandlerMiddleware 包装 HandlerFunc，用于日志、链路追踪、幂等、监控等横切逻辑。
+// 通过 WithHandlerMiddleware 注册，第一个 middleware 位于最外层。
+type HandlerMiddleware func(next HandlerFunc) HandlerFunc
+
+// PushInterceptor 在 item 入队前调用（Push 与 PushBatch 的每个 item），可修改 item；
+// 返回非 nil error 时拒绝入队并原样返回给调用方。重试与 Import 不经过拦截器。
+type PushInterceptor func(item *Item) error
+
+// chainHandler 按注册顺序包装 f：mws[0](mws[1](...(f)))
+func chainHandler(f HandlerFunc, mws []HandlerMiddleware) HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			f = mws[i](f)
+		}
+	}
+	return f
+}
+
+// chainManualHandler 让 manual ack 模式同样经过 middleware 链。
+//
+// next 在用户回调返回时返回：回调返回前已 Nack 时返回 Nack 的 error，否则返回 nil；
+// 之后异步的 Ack/Nack 不影响 next 的返回值。middleware 未调用 next 时由其返回值决定应答：
+// 返回 error 视为 Nack，返回 nil 视为 Ack，避免 item 因无人应答而滞留。
+func chainManualHandler(f func(*Item, Acker), mws []HandlerMiddleware) func(*Item, Acker) {
+	return func(item *Item, ack Acker) {
+		called := false
+		h := chainHandler(func(item *Item) error {
+			called = true
+			ra := &recordingAcker{inner: ack}
+			f(item, ra)
+			return ra.returned()
+		}, mws)
+		err := h(item)
+		if called {
+			return
+		}
+		if err != nil {
+			ack.Nack(err)
+		} else {
+			ack.Ack()
+		}
+	}
+}
+
+// recordingAcker 转发 Ack/Nack，并记录回调返回前的 Nack error
+type recordingAcker struct {
+	inner Acker
+
+	mu       sync.Mutex
+	nackErr  error
+	finished bool // 用户回调已返回，此后的应答不再记录
+}
+
+func (a *recordingAcker) Ack() { a.inner.Ack() }
+
+func (a *recordingAcker) Nack(err error) {
+	a.mu.Lock()
+	if !a.finished && a.nackErr == nil {
+		a.nackErr = err
+		if a.nackErr == nil {
+			a.nackErr = errNackWithoutReason
+		}
+	}
+	a.mu.Unlock()
+	a.inner.Nack(err)
+}
+
+// returned 标记用户回调已返回，返回期间记录的 Nack error
+func (a *recordingAcker) returned() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.finished = true
+	return a.nackErr
+}
+
+// applyPushInterceptors 依次调用入队拦截器，遇到第一个 error 即返回
+func applyPushInterceptors(item *Item, ics []PushInterceptor) error {
+	for _, ic := range ics {
+		if ic == nil {
+			continue
+		}
+		if err := ic(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// recordMiddleware 记录进入/退出顺序与 next 的返回值
+func recordMiddleware(name string, mu *sync.Mutex, trace *[]string) HandlerMiddleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(item *Item) error {
+			mu.Lock()
+			*trace = append(*trace, name+">")
+			mu.Unlock()
+			err := next(item)
+			mu.Lock()
+			*trace = append(*trace, fmt.Sprintf("<%s:%v", name, err))
+			mu.Unlock()
+			return err
+		}
+	}
+}
+
+// TestMiddleware_StartChainOrder 第一个 middleware 位于最外层，handler 的 error 沿链返回并触发重试
+func TestMiddleware_StartChainOrder(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+	done := make(chan struct{})
+	q := New(
+		WithLogger(NopLogger()),
+		WithRetryTimes(0),
+		WithOnDeadLetter(func(*Item) { close(done) }),
+		WithHandlerMiddleware(recordMiddleware("a", &mu, &trace), recordMiddleware("b", &mu, &trace)),
+	)
+	defer q.Close()
+	if err := q.Start("mw", func(*Item) error {
+		mu.Lock()
+		trace = append(trace, "handler")
+		mu.Unlock()
+		return errors.New("boom")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Topic: "mw", Value: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("item not dead-lettered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := strings.Join(trace, ","), "a>,b>,handler,<b:boom,<a:boom"; got != want {
+		t.Fatalf("trace\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestMiddleware_ShortCircuit middleware 不调用 next 时 handler 不执行，返回值决定成功或失败
+func TestMiddleware_ShortCircuit(t *testing.T) {
+	var handled, succeeded int64
+	tp := NewMemoryTopicQueue(context.Background(), "mw-skip",
+		WithLogger(NopLogger()),
+		WithHandlerMiddleware(func(next HandlerFunc) HandlerFunc {
+			return func(item *Item) error {
+				if string(item.GetValue()) == "dup" {
+					atomic.AddInt64(&succeeded, 1)
+					return nil
+				}
+				return next(item)
+			}
+		}),
+	)
+	if err := tp.Start(func(*Item) error {
+		atomic.AddInt64(&handled, 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	if err := tp.PushBatch([]*Item{{Value: []byte("dup")}, {Value: []byte("new")}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if h, s := atomic.LoadInt64(&handled), atomic.LoadInt64(&succeeded); h != 1 || s != 1 {
+		t.Fatalf("want handled=1 skipped=1 got %d / %d", h, s)
+	}
+}
+
+// TestMiddleware_ManualAck manual ack 模式同样经过 middleware：回调返回前的 Nack 作为 next 的返回值，
+// 异步 Ack 不影响返回值；middleware 短路时按其返回值应答
+func TestMiddleware_ManualAck(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+	var acks, nacks int64
+	q := New(
+		WithLogger(NopLogger()),
+		WithRetryTimes(0),
+		WithOnDeadLetter(func(*Item) { atomic.AddInt64(&nacks, 1) }),
+		WithHandlerMiddleware(
+			recordMiddleware("m", &mu, &trace),
+			func(next HandlerFunc) HandlerFunc {
+				return func(item *Item) error {
+					if string(item.GetValue()) == "reject" {
+						return errors.New("rejected")
+					}
+					return next(item)
+				}
+			},
+		),
+		WithMonitorCounter(func(metric string, _ int64, _ prometheus.Labels) {
+			if metric == MetricHandle {
+				atomic.AddInt64(&acks, 1)
+			}
+		}),
+	)
+	defer q.Close()
+	var wg sync.WaitGroup
+	if err := q.StartManualAck("mw-manual", func(item *Item, ack Acker) {
+		switch string(item.GetValue()) {
+		case "nack":
+			ack.Nack(nil)
+		case "async":
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				time.Sleep(20 * time.Millisecond)
+				ack.Ack()
+			}()
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"nack", "async", "reject"} {
+		if err := q.Push(&Item{Topic: "mw-manual", Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	if a, n := atomic.LoadInt64(&acks), atomic.LoadInt64(&nacks); a != 1 || n != 2 {
+		t.Fatalf("want 1 ack and 2 dead letters, got %d / %d", a, n)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Join(trace, ",")
+	for _, want := range []string{"<m:" + errNackWithoutReason.Error(), "<m:<nil>", "<m:rejected"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("trace %s missing %s", got, want)
+		}
+	}
+}
+
+// TestPushInterceptor_Memory 拦截器作用于 Push 与 PushBatch 的每个 item：可修改 item，error 拒绝入队（批次整体拒绝）
+func TestPushInterceptor_Memory(t *testing.T) {
+	errReject := errors.New("reject")
+	var seen []string
+	tp := NewMemoryTopicQueue(context.Background(), "pi",
+		WithLogger(NopLogger()),
+		WithPushInterceptor(
+			func(item *Item) error {
+				seen = append(seen, item.GetTopic()+"/"+string(item.GetValue()))
+				if string(item.GetValue()) == "bad" {
+					return errReject
+				}
+				return nil
+			},
+			func(item *Item) error {
+				item.Priority = 7
+				return nil
+			},
+		),
+	)
+	if err := tp.Start(noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	item := &Item{Value: []byte("ok"), DelaySecond: 60}
+	if err := tp.Push(item); err != nil {
+		t.Fatal(err)
+	}
+	if item.GetPriority() != 7 {
+		t.Fatalf("interceptor should be able to modify item, priority=%d", item.GetPriority())
+	}
+	if err := tp.Push(&Item{Value: []byte("bad")}); !errors.Is(err, errReject) {
+		t.Fatalf("want errReject got %v", err)
+	}
+	if err := tp.PushBatch([]*Item{{Value: []byte("b1"), DelaySecond: 60}, {Value: []byte("bad")}}); !errors.Is(err, errReject) {
+		t.Fatalf("want errReject from batch got %v", err)
+	}
+	if n := tp.Length(); n != 1 {
+		t.Fatalf("rejected items should not be queued, length=%d", n)
+	}
+	if got, want := strings.Join(seen, ","), "pi/ok,pi/bad,pi/b1,pi/bad"; got != want {
+		t.Fatalf("interceptor calls\n got %s\nwant %s", got, want)
+	}
+}
+
+// TestPushInterceptor_Redis Redis 后端写入拦截器修改后的 item，拒绝时不调用 add 脚本
+func TestPushInterceptor_Redis(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "pi-redis",
+		WithRedisScriptBuilder(b),
+		WithLogger(NopLogger()),
+		WithPushInterceptor(func(item *Item) error {
+			if string(item.GetValue()) == "bad" {
+				return ErrNilItem
+			}
+			item.Value = append([]byte("tenant-"), item.GetValue()...)
+			return nil
+		}),
+	)
+	var adds []string
+	b.scripts[idxAdd].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		for i := 0; i < len(args); i += 2 {
+			adds = append(adds, string(args[i].([]byte)))
+		}
+		return []interface{}{true}, nil
+	}
+	if err := tp.Push(&Item{Value: []byte("a"), DelaySecond: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tp.PushBatch([]*Item{{Value: []byte("b"), DelaySecond: 5}, {Value: []byte("bad")}}); err == nil {
+		t.Fatal("batch with a rejected item should fail")
+	}
+	if got := strings.Join(adds, ","); got != "tenant-a" {
+		t.Fatalf("unexpected add calls %s", got)
+	}
+}
+
+// TestPushInterceptor_Tiered 分层队列中写入 Redis 层的 item 只经过一次拦截器
+func TestPushInterceptor_Tiered(t *testing.T) {
+	calls := make(map[string]int)
+	q, b := newTestTieredQueue(t, WithPushInterceptor(func(item *Item) error {
+		calls[string(item.GetValue())]++
+		item.Value = append([]byte("t-"), item.GetValue()...)
+		return nil
+	}))
+	adds := recordAdds(b)
+	if err := q.Start(noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push(&Item{Value: []byte("far"), DelaySecond: 3600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{{Value: []byte("near"), DelaySecond: 5}, {Value: []byte("far2"), DelaySecond: 3600}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Fatalf("interceptor should only see pushed values, calls=%v", calls)
+	}
+	for _, v := range []string{"far", "near", "far2"} {
+		if calls[v] != 1 {
+			t.Fatalf("interceptor should run once for %s, calls=%v", v, calls)
+		}
+	}
+	if got, _ := adds(); strings.Join(got, ",") != "t-far,t-far2" {
+		t.Fatalf("unexpected add calls %v", got)
+	}
+}
@@ -1,6 +1,10 @@
 package delayq
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -32,8 +36,75 @@ const (
 	MetricHeartbeat = "delayq_heartbeat"
 	// MetricHeartbeatError doing 集心跳失败 (Counter)
 	MetricHeartbeatError = "delayq_heartbeat_error"
+	// MetricConsumerReclaim 因消费者租约过期被立即回收的 item 数 (Counter)
+	MetricConsumerReclaim = "delayq_consumer_reclaim"
+	// MetricConsumerLeaseError 消费者租约续约失败 (Counter)
+	MetricConsumerLeaseError = "delayq_consumer_lease_error"
+	// MetricSpooled Redis 写入失败后进入本地缓冲的 item 数 (Counter)
+	MetricSpooled = "delayq_spooled"
+	// MetricSpoolDepth 本地缓冲当前深度（Gauge 风格上报，缓冲变化时上报最新值）
+	MetricSpoolDepth = "delayq_spool_depth"
+	// MetricSpoolDropped Close 时 Redis 仍不可用且未配置 SpoolPath，被丢弃的缓冲 item 数 (Counter)
+	MetricSpoolDropped = "delayq_spool_dropped"
+	// MetricBreakerOpen Redis 熔断器打开 (Counter)
+	MetricBreakerOpen = "delayq_breaker_open"
+	// MetricBreakerHalfOpen Redis 熔断器进入半开状态 (Counter)
+	MetricBreakerHalfOpen = "delayq_breaker_half_open"
+	// MetricBreakerClose Redis 熔断器恢复关闭 (Counter)
+	MetricBreakerClose = "delayq_breaker_close"
+	// MetricTieredPromote 分层队列从 Redis 拉入内存时间轮的 item 数 (Counter)
+	MetricTieredPromote = "delayq_tiered_promote"
+	// MetricHistoryError item 历史写入失败 (Counter)
+	MetricHistoryError = "delayq_history_error"
+	// MetricRetryDelayMs 失败后重新入队的重试延迟（毫秒，Histogram 风格上报）
+	MetricRetryDelayMs = "delayq_retry_delay_ms"
+	// MetricPollBatchSize 一次 poll 认领到的 item 数（非空批次，Histogram 风格上报）
+	MetricPollBatchSize = "delayq_poll_batch_size"
+	// MetricRedisScriptMs Redis 脚本执行耗时（毫秒，Histogram 风格上报）
+	MetricRedisScriptMs = "delayq_redis_script_ms"
+	// MetricLatenessMs 派发时实际时间与计划执行时间之差（毫秒，Histogram 风格上报）
+	MetricLatenessMs = "delayq_lateness_ms"
 )
 
+// counterMetrics 以原生 CounterVec 导出的计数类 metric，名称为 <namespace>_<metric 去掉 delayq_ 前缀>_total
+var counterMetrics = map[string]string{
+	MetricProduce:            "Number of items pushed successfully.",
+	MetricProduceError:       "Number of failed pushes.",
+	MetricHandle:             "Number of items handled successfully.",
+	MetricHandleError:        "Number of handler invocations that returned an error or panicked.",
+	MetricHandlePanic:        "Number of handler panics.",
+	MetricPollError:          "Number of failed polls.",
+	MetricReclaim:            "Number of items moved back after visibility timeout.",
+	MetricReclaimError:       "Number of failed reclaims.",
+	MetricRateLimited:        "Number of items rejected by the push rate limiter.",
+	MetricHeartbeat:          "Number of successful visibility heartbeats.",
+	MetricHeartbeatError:     "Number of failed visibility heartbeats.",
+	MetricConsumerReclaim:    "Number of items reclaimed from consumers whose lease expired.",
+	MetricConsumerLeaseError: "Number of failed consumer lease renewals.",
+	MetricSpooled:            "Number of items buffered locally while Redis is unavailable.",
+	MetricSpoolDropped:       "Number of spooled items dropped on close because Redis was unavailable and no spool path was set.",
+	MetricBreakerOpen:        "Number of times the Redis circuit breaker opened.",
+	MetricBreakerHalfOpen:    "Number of times the Redis circuit breaker went half-open.",
+	MetricBreakerClose:       "Number of times the Redis circuit breaker closed.",
+	MetricTieredPromote:      "Number of items promoted from Redis into the in-memory wheel.",
+	MetricHistoryError:       "Number of failed item history writes.",
+}
+
+// histogramMetric 以原生 HistogramVec 导出的观测类 metric
+type histogramMetric struct {
+	name    string
+	help    string
+	buckets []float64
+}
+
+// histogramMetrics 耗时类以秒为单位观测，MonitorCounter 回调仍上报毫秒
+var histogramMetrics = map[string]histogramMetric{
+	MetricHandleDurationMs: {"handle_duration_seconds", "Handler execution time in seconds.", prometheus.ExponentialBuckets(0.001, 4, 9)},
+	MetricLatenessMs:       {"lateness_seconds", "Time between an item's scheduled execute time and its dispatch, in seconds.", []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60, 300}},
+	MetricRetryDelayMs:     {"retry_delay_seconds", "Delay before a failed item is retried, in seconds.", prometheus.ExponentialBuckets(1, 4, 8)},
+	MetricPollBatchSize:    {"poll_batch_size", "Number of items claimed by a non-empty poll.", prometheus.ExponentialBuckets(1, 2, 11)},
+}
+
 type statsGetter interface {
 	Status() Status
 }
@@ -43,16 +114,38 @@ type Collector = prometheus.Collector
 
 type statsCollector struct {
 	getter          statsGetter
+	metrics         *nativeMetrics
 	queueLengthDesc *prometheus.Desc
 	inFlightDesc    *prometheus.Desc
-	opts            *Options
+	spoolDepthDesc  *prometheus.Desc
+	maxLatenessDesc *prometheus.Desc
+	// 详细状态 Gauge，见 Status.Doing / Dead / Overdue / OldestOverdue / NextDue
+	doingDesc         *prometheus.Desc
+	deadDesc          *prometheus.Desc
+	overdueDesc       *prometheus.Desc
+	oldestOverdueDesc *prometheus.Desc
+	nextDueDesc       *prometheus.Desc
+	// forecastDesc 配置 ForecastBuckets 时导出各区间内将要到期的 item 数；未配置时为 nil
+	forecastDesc *prometheus.Desc
+	opts         *Options
 }
 
 func newCollector(getter statsGetter, opts *Options) Collector {
 	name := opts.GetMetricNamespace()
+	var forecastDesc *prometheus.Desc
+	if len(opts.GetForecastBuckets()) > 0 {
+		forecastDesc = prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "forecast"),
+			"Number of items per topic becoming due after the previous forecast bucket and within the next horizon_seconds.",
+			[]string{"queue", "horizon_seconds"},
+			prometheus.Labels{},
+		)
+	}
 	return &statsCollector{
-		getter: getter,
-		opts:   opts,
+		forecastDesc: forecastDesc,
+		getter:       getter,
+		metrics:      newNativeMetrics(opts),
+		opts:         opts,
 		queueLengthDesc: prometheus.NewDesc(
 			prometheus.BuildFQName(name, subsystem, "queue_length"),
 			"Length of delay set per topic (waiting items).",
@@ -65,12 +158,65 @@ func newCollector(getter statsGetter, opts *Options) Collector {
 			[]string{"queue"},
 			prometheus.Labels{},
 		),
+		spoolDepthDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "spool_depth"),
+			"Number of pushes buffered locally while Redis is unavailable.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		maxLatenessDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "max_lateness_seconds"),
+			"Maximum dispatch lateness per topic over the last one to two minutes.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		doingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "doing"),
+			"Number of dispatched items waiting for ack per topic.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		deadDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "dead"),
+			"Number of dead-lettered items per topic.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		overdueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "overdue"),
+			"Number of items past their scheduled time but not yet dispatched per topic.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		oldestOverdueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "oldest_overdue_seconds"),
+			"Age of the oldest overdue item per topic.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
+		nextDueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(name, subsystem, "next_due_timestamp_seconds"),
+			"Unix time of the next scheduled item per topic.",
+			[]string{"queue"},
+			prometheus.Labels{},
+		),
 	}
 }
 
 func (c statsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.queueLengthDesc
 	ch <- c.inFlightDesc
+	ch <- c.spoolDepthDesc
+	ch <- c.maxLatenessDesc
+	ch <- c.doingDesc
+	ch <- c.deadDesc
+	ch <- c.overdueDesc
+	ch <- c.oldestOverdueDesc
+	ch <- c.nextDueDesc
+	if c.forecastDesc != nil {
+		ch <- c.forecastDesc
+	}
+	c.metrics.describe(ch)
 }
 
 func (c statsCollector) Collect(ch chan<- prometheus.Metric) {
@@ -91,6 +237,146 @@ func (c statsCollector) Collect(ch chan<- prometheus.Metric) {
 			k,
 		)
 	}
+	for k, v := range stats.Spooled {
+		ch <- prometheus.MustNewConstMetric(
+			c.spoolDepthDesc,
+			prometheus.GaugeValue,
+			float64(v),
+			k,
+		)
+	}
+	for k, v := range stats.MaxLateness {
+		ch <- prometheus.MustNewConstMetric(
+			c.maxLatenessDesc,
+			prometheus.GaugeValue,
+			v.Seconds(),
+			k,
+		)
+	}
+	for k, v := range stats.Doing {
+		ch <- prometheus.MustNewConstMetric(c.doingDesc, prometheus.GaugeValue, float64(v), k)
+	}
+	for k, v := range stats.Dead {
+		ch <- prometheus.MustNewConstMetric(c.deadDesc, prometheus.GaugeValue, float64(v), k)
+	}
+	for k, v := range stats.Overdue {
+		ch <- prometheus.MustNewConstMetric(c.overdueDesc, prometheus.GaugeValue, float64(v), k)
+	}
+	for k, v := range stats.OldestOverdue {
+		ch <- prometheus.MustNewConstMetric(c.oldestOverdueDesc, prometheus.GaugeValue, v.Seconds(), k)
+	}
+	for k, v := range stats.NextDue {
+		ch <- prometheus.MustNewConstMetric(c.nextDueDesc, prometheus.GaugeValue, float64(v.UnixMilli())/1000, k)
+	}
+	c.collectForecast(ch)
+	c.metrics.collect(ch)
+}
+
+// forecastGetter 支持按窗口统计将要到期 item 数的 statsGetter
+type forecastGetter interface {
+	forecastAll(buckets []time.Duration) map[string][]int64
+}
+
+// collectForecast 导出 ForecastBuckets 各区间的 forecast Gauge
+func (c statsCollector) collectForecast(ch chan<- prometheus.Metric) {
+	if c.forecastDesc == nil {
+		return
+	}
+	fg, ok := c.getter.(forecastGetter)
+	if !ok {
+		return
+	}
+	buckets := c.opts.GetForecastBuckets()
+	for topic, counts := range fg.forecastAll(buckets) {
+		for i, n := range counts {
+			ch <- prometheus.MustNewConstMetric(c.forecastDesc, prometheus.GaugeValue, float64(n),
+				topic, strconv.FormatFloat(buckets[i].Seconds(), 'f', -1, 64))
+		}
+	}
+}
+
+// nativeMetrics Collector 内置的原生 Prometheus 指标，按 queue 标签区分 topic；
+// 与 MonitorCounter 回调并行上报，方法对 nil 接收者安全（独立构造的 TopicQueue 不上报）
+type nativeMetrics struct {
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+	// scriptDuration Redis 脚本耗时，额外带 script 标签
+	scriptDuration *prometheus.HistogramVec
+}
+
+func newNativeMetrics(opts *Options) *nativeMetrics {
+	ns := opts.GetMetricNamespace()
+	m := &nativeMetrics{
+		counters:   make(map[string]*prometheus.CounterVec, len(counterMetrics)),
+		histograms: make(map[string]*prometheus.HistogramVec, len(histogramMetrics)),
+		scriptDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "redis_script_duration_seconds",
+			Help:      "Redis script execution time in seconds.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}, []string{"queue", "script"}),
+	}
+	for metric, help := range counterMetrics {
+		m.counters[metric] = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns,
+			Name:      strings.TrimPrefix(metric, "delayq_") + "_total",
+			Help:      help,
+		}, []string{"queue"})
+	}
+	for metric, h := range histogramMetrics {
+		m.histograms[metric] = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      h.name,
+			Help:      h.help,
+			Buckets:   h.buckets,
+		}, []string{"queue"})
+	}
+	return m
+}
+
+func (m *nativeMetrics) describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.counters {
+		c.Describe(ch)
+	}
+	for _, h := range m.histograms {
+		h.Describe(ch)
+	}
+	m.scriptDuration.Describe(ch)
+}
+
+func (m *nativeMetrics) collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.counters {
+		c.Collect(ch)
+	}
+	for _, h := range m.histograms {
+		h.Collect(ch)
+	}
+	m.scriptDuration.Collect(ch)
+}
+
+func (m *nativeMetrics) count(metric, topic string, value int) {
+	if m == nil {
+		return
+	}
+	if c, ok := m.counters[metric]; ok {
+		c.WithLabelValues(topic).Add(float64(value))
+	}
+}
+
+func (m *nativeMetrics) observe(metric, topic string, value float64) {
+	if m == nil {
+		return
+	}
+	if h, ok := m.histograms[metric]; ok {
+		h.WithLabelValues(topic).Observe(value)
+	}
+}
+
+func (m *nativeMetrics) observeScript(topic, script string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.scriptDuration.WithLabelValues(topic, script).Observe(d.Seconds())
 }
 
 // monitorCount 按 topic 上报一次计数；values[0] 为本次增量（默认 1）
@@ -115,13 +401,51 @@ func monitorObserve(metric string, topic string, opts *Options, value int64) {
 
 func (q *baseQueue) monitorCount(metric string, values ...int) {
 	monitorCount(metric, q.topic, q.opts, values...)
+	value := 1
+	if len(values) > 0 {
+		value = values[0]
+	}
+	q.metrics.Load().count(metric, q.topic, value)
 }
 
 func (q *baseQueue) monitorObserve(metric string, value int64) {
 	monitorObserve(metric, q.topic, q.opts, value)
+	q.metrics.Load().observe(metric, q.topic, float64(value))
+}
+
+// monitorDuration 上报耗时：MonitorCounter 回调为毫秒，原生 Histogram 为秒（保留亚毫秒精度）
+func (q *baseQueue) monitorDuration(metric string, d time.Duration) {
+	monitorObserve(metric, q.topic, q.opts, d.Milliseconds())
+	q.metrics.Load().observe(metric, q.topic, d.Seconds())
+}
+
+// setMetrics 由 queue 外观层在创建 / 注册 TopicQueue 时注入原生指标，已注入时不覆盖
+func (q *baseQueue) setMetrics(m *nativeMetrics) {
+	q.metrics.CompareAndSwap(nil, m)
+}
+
+// metricsSetter 可注入原生指标的 TopicQueue 实现
+type metricsSetter interface {
+	setMetrics(m *nativeMetrics)
+}
+
+// attachMetrics 把 Collector 的原生指标注入 tq；非本包实现时忽略
+func (q *queue) attachMetrics(tq TopicQueue) {
+	if ms, ok := tq.(metricsSetter); ok {
+		ms.setMetrics(q.metrics())
+	}
+}
+
+// metrics 返回 Collector 内置的原生指标
+func (q *queue) metrics() *nativeMetrics {
+	if c, ok := q.collector.(*statsCollector); ok {
+		return c.metrics
+	}
+	return nil
 }
 
 // monitorCounter 由 queue 外观层调用，按 topic 上报计数（永远 +1）
 func (q *queue) monitorCounter(metric, topic string) {
 	monitorCount(metric, topic, q.opts)
+	q.metrics().count(metric, topic, 1)
 }
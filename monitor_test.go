@@ -1,10 +1,13 @@
 package delayq
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
@@ -34,7 +37,7 @@ func TestCollector_DescribeAndCollect(t *testing.T) {
 	col := q.Collector()
 
 	// Describe
-	descCh := make(chan *prometheus.Desc, 4)
+	descCh := make(chan *prometheus.Desc, 64)
 	col.Describe(descCh)
 	close(descCh)
 	var descs []string
@@ -56,7 +59,7 @@ func TestCollector_DescribeAndCollect(t *testing.T) {
 	}
 
 	// Collect 同时验证 queue_length 与 in_flight 两类指标
-	metricCh := make(chan prometheus.Metric, 16)
+	metricCh := make(chan prometheus.Metric, 64)
 	col.Collect(metricCh)
 	close(metricCh)
 	queueLen := map[string]float64{}
@@ -127,5 +130,120 @@ func TestMonitorCount_WithValues(t *testing.T) {
 	}
 }
 
+// gatherValue 从 registry 中读取指定 metric 的值：Counter 返回计数，Histogram 返回样本数；
+// labels 须全部匹配，未找到时返回 -1
+func gatherValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			got := map[string]string{}
+			for _, lp := range m.GetLabel() {
+				got[lp.GetName()] = lp.GetValue()
+			}
+			for k, v := range labels {
+				if got[k] != v {
+					continue next
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return -1
+}
+
+// TestCollector_NativeMetrics Collector 内置计数与耗时 / 重试延迟直方图，MonitorCounter 回调照常上报
+func TestCollector_NativeMetrics(t *testing.T) {
+	var callbacks int64
+	var attempts int64
+	q := New(
+		WithName("native"),
+		WithLogger(NopLogger()),
+		WithRetryInterval(100*time.Millisecond),
+		WithMonitorCounter(func(string, int64, prometheus.Labels) { atomic.AddInt64(&callbacks, 1) }),
+	)
+	defer q.Close()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(q.Collector())
+	if err := q.Start("nm", func(*Item) error {
+		if atomic.AddInt64(&attempts, 1) == 1 {
+			return errors.New("fail")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Topic: "nm", Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	queue := map[string]string{"queue": "nm"}
+	for name, want := range map[string]float64{
+		"native_produce_total":           1,
+		"native_handle_total":            1,
+		"native_handle_error_total":      1,
+		"native_handle_duration_seconds": 2,
+		"native_retry_delay_seconds":     1,
+	} {
+		if got := gatherValue(t, reg, name, queue); got != want {
+			t.Fatalf("%s want %v got %v", name, want, got)
+		}
+	}
+	if atomic.LoadInt64(&callbacks) == 0 {
+		t.Fatal("MonitorCounter callback should still be invoked")
+	}
+}
+
+// TestCollector_NativeRedisMetrics Redis 后端上报非空 poll 的批大小与按脚本区分的耗时
+func TestCollector_NativeRedisMetrics(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	q := New(WithName("nr"), WithLogger(NopLogger()), WithRedisScriptBuilder(b)).(*queue)
+	defer q.Close()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(q.Collector())
+	tq := q.newTopicQueue("nr-topic")
+	stubAllScriptsOK(b)
+	var polled int32
+	b.scripts[idxPoll].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		if atomic.CompareAndSwapInt32(&polled, 0, 1) {
+			return []interface{}{"a", "100", int64(0), int64(0), "b", "100", int64(0), int64(0)}, nil
+		}
+		return nil, nil
+	}
+	var handled int64
+	if err := q.StartTopicQueue(tq, func(*Item) error {
+		atomic.AddInt64(&handled, 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Topic: "nr-topic", Value: []byte("a"), DelaySecond: 5}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 5000, func() bool { return atomic.LoadInt64(&handled) == 2 })
+	if got := gatherValue(t, reg, "nr_poll_batch_size", map[string]string{"queue": "nr-topic"}); got != 1 {
+		t.Fatalf("want one non-empty poll batch observed, got %v", got)
+	}
+	for _, script := range []string{"add", "poll"} {
+		if got := gatherValue(t, reg, "nr_redis_script_duration_seconds", map[string]string{"queue": "nr-topic", "script": script}); got < 1 {
+			t.Fatalf("script %s latency not observed: %v", script, got)
+		}
+	}
+}
+
 // 空结构体保证 sync 引用以免 lint 报 unused
 var _ = sync.Mutex{}
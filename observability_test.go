@@ -223,7 +223,7 @@ func TestMetric_InFlight_ExposedViaCollector(t *testing.T) {
 	}
 
 	col := q.Collector()
-	descCh := make(chan *prometheus.Desc, 4)
+	descCh := make(chan *prometheus.Desc, 64)
 	col.Describe(descCh)
 	close(descCh)
 	var hasInFlight bool
@@ -236,7 +236,7 @@ func TestMetric_InFlight_ExposedViaCollector(t *testing.T) {
 		t.Fatal("collector should describe in_flight metric")
 	}
 
-	mch := make(chan prometheus.Metric, 8)
+	mch := make(chan prometheus.Metric, 64)
 	col.Collect(mch)
 	close(mch)
 	var inFlightSeen bool
@@ -12,7 +12,10 @@ import (
 // 注释中的作用范围标记：
 //   - [all]    内存队列与 Redis 队列均生效
 //   - [redis]  仅 Redis 队列生效
-//   - [memory] 仅内存队列生效
+//   - [memory] 仅内存队列生效（文件队列基于内存队列，同样生效）
+//   - [file]   仅文件队列（NewFileTopicQueue）生效
+//   - [sql]    仅 SQL 队列（NewSQLTopicQueue）生效
+//   - [tiered] 仅分层队列（NewTieredTopicQueue）生效；分层队列同时受 [memory] 与 [redis] 选项影响
 //
 //go:generate optionGen  --new_func=newConfig --option_return_previous=false
 func OptionsOptionDeclareWithDefault() interface{} {
@@ -33,7 +36,7 @@ func OptionsOptionDeclareWithDefault() interface{} {
 		"Logger": Logger(nil),
 		// annotation@MaxConcurrency(comment="[all] 单 topic 业务处理最大并发 goroutine 数；<=0 表示不限制")
 		"MaxConcurrency": 256,
-		// annotation@VisibilityTimeout(comment="[redis] item 被 poll 拉走后多久未 ack 视为失败被 reclaim")
+		// annotation@VisibilityTimeout(comment="[redis][sql] item 被 poll 拉走后多久未 ack 视为失败被 reclaim")
 		"VisibilityTimeout": 10 * time.Minute,
 		// annotation@RetryInterval(comment="[all] 基础重试间隔；下次重试时间 = now + RetryInterval * RetryBackoff^(failedCount-1)，且不超过 MaxRetryInterval")
 		"RetryInterval": 1 * time.Second,
@@ -49,11 +52,67 @@ func OptionsOptionDeclareWithDefault() interface{} {
 		"PushRatePerSec": float64(0),
 		// annotation@PushBurst(comment="[all] Push 限流 burst 容量（token 数），<=0 时取 PushRatePerSec 同值")
 		"PushBurst": int(0),
-		// annotation@HeartbeatInterval(comment="[redis] handler 执行期间自动延期 doing 集 score 的心跳间隔；<0 表示禁用心跳；0 表示使用默认值 VisibilityTimeout/3（不少于 1s）")
+		// annotation@HeartbeatInterval(comment="[redis][sql] handler 执行期间自动延期 doing 集 score 的心跳间隔；<0 表示禁用心跳；0 表示使用默认值 VisibilityTimeout/3（不少于 1s）")
 		"HeartbeatInterval": time.Duration(0),
-		// annotation@PollInterval(comment="[redis] 把 delay 集中到期 item 搬到 doing 集的轮询间隔；<=0 表示使用默认值 1s")
+		// annotation@PollInterval(comment="[redis][sql] 把 delay 集中到期 item 搬到 doing 集（SQL：认领到期行）的轮询间隔；<=0 表示使用默认值 1s")
 		"PollInterval": time.Duration(0),
-		// annotation@ReclaimInterval(comment="[redis] 把 doing 集中超时 item 搬回 delay 集的轮询间隔；<=0 表示使用默认值 1s")
+		// annotation@ReclaimInterval(comment="[redis][sql] 把 doing 集中超时 item 搬回 delay 集的轮询间隔；<=0 表示使用默认值 1s")
 		"ReclaimInterval": time.Duration(0),
+		// annotation@DeadLetterRetention(comment="[redis] 死信在 dead:{<topic>} 集中的保留时长，超期死信在 poll 时清理；默认 0 不写入 dead 集（仅回调 OnDeadLetter），与旧版本行为一致")
+		"DeadLetterRetention": time.Duration(0),
+		// annotation@RedisShards(comment="[redis] 单 topic 的 Redis 分片数；>1 时 key 形如 <prefix>:do:{<topic>:<i>}，按 value 哈希路由到各分片，poll/reclaim 逐个分片处理；<=1 表示不分片。修改分片数前需迁移已有数据")
+		"RedisShards": 0,
+		// annotation@ConsumerID(comment="[redis] 消费者实例 ID（如 pod 名）；非空时登记消费者租约并记录 doing 集 item 归属，reclaim 可立即回收租约过期实例持有的 item；空表示不启用")
+		"ConsumerID": "",
+		// annotation@ConsumerLeaseTTL(comment="[redis] 消费者租约有效期，每 TTL/3（不少于 1s）续约一次；<=0 表示使用默认值 30s")
+		"ConsumerLeaseTTL": time.Duration(0),
+		// annotation@SpoolSize(comment="[redis] Redis 不可用时本地缓冲 Push 的最大条数；Redis 恢复后由后台 ticker 通过 PushBatch 补写。缓冲已满时 Push 返回 ErrSpoolFull；<=0 表示不启用，Push 直接返回 Redis 错误")
+		"SpoolSize": 0,
+		// annotation@SpoolPath(comment="[redis] 本地缓冲落盘文件路径；非空时缓冲内容同步写入该文件，进程重启后在构造队列时重新加载。多个 topic 需配置不同路径（可用 {topic} 占位）；空表示仅内存缓冲")
+		"SpoolPath": "",
+		// annotation@BreakerFailureThreshold(comment="[redis] Redis 脚本执行熔断阈值：连续失败达到该次数后熔断打开，期间所有 Redis 调用直接返回 ErrBackendUnavailable；同一 Queue 的所有 topic 共享熔断器。<=0 表示不启用")
+		"BreakerFailureThreshold": 0,
+		// annotation@BreakerOpenTimeout(comment="[redis] 熔断打开后多久进入半开状态放行探测请求；<=0 表示使用默认值 5s")
+		"BreakerOpenTimeout": time.Duration(0),
+		// annotation@BreakerHalfOpenProbes(comment="[redis] 半开状态允许的并发探测请求数，连续成功该次数后熔断关闭，任一失败重新打开；<=0 表示使用默认值 1")
+		"BreakerHalfOpenProbes": 0,
+		// annotation@FileSnapshotInterval(comment="[file] 文件后端把 WAL 压缩为快照的间隔；Close 时也会压缩一次。<=0 表示使用默认值 1min")
+		"FileSnapshotInterval": time.Duration(0),
+		// annotation@FileSyncWrites(comment="[file] 文件后端每次写 WAL 后调用 fsync；开启后机器掉电也不丢已确认的 Push，但吞吐显著下降。默认仅写入 OS 缓冲（进程崩溃不丢）")
+		"FileSyncWrites": false,
+		// annotation@SQLTableName(comment="[sql] SQL 后端使用的表名；多个 topic 共用一张表，以 topic 列区分")
+		"SQLTableName": "delayq_items",
+		// annotation@TieredThreshold(comment="[tiered] 分层队列的路由阈值：延迟小于该值的 item 进入进程内时间轮，其余写入 Redis；通过 New 创建且配置了 RedisScriptBuilder 时 >0 即启用分层队列。NewTieredTopicQueue 中 <=0 表示使用默认值 1min")
+		"TieredThreshold": time.Duration(0),
+		// annotation@TieredPromoteAhead(comment="[tiered] 分层队列提前把 Redis 中即将到期的 item 拉入进程内时间轮的时长；拉取后 item 在 Redis 中处于 doing 状态，进程退出后由 reclaim 回收。<=0 表示使用默认值 5s")
+		"TieredPromoteAhead": time.Duration(0),
+		// annotation@MemorySnapshotPath(comment="[memory] 内存队列快照文件路径：非空时 Close/CloseGracefully 把时间轮中剩余的 item（绝对执行时间、优先级、已失败次数）以 Export 格式写入该文件，Start 时重新加载并扣除停机时长，加载后删除文件。多个 topic 需配置不同路径（可用 {topic} 占位）；文件 / 分层队列忽略该选项；空表示不持久化")
+		"MemorySnapshotPath": "",
+		// annotation@MemoryCompactInterval(comment="[memory] 后台压缩间隔：被 Cancel 的节点数达到时间轮存活节点数的 1/4 时，按该间隔把它们从时间轮与 value 索引中摘除以释放内存；文件 / 分层队列同样生效；<=0 表示不压缩，被取消的节点在到期槽位处理时才释放")
+		"MemoryCompactInterval": time.Second * 10,
+		// annotation@MemoryShards(comment="[memory] 时间轮分片数：按 value 哈希把时间轮划分为 N 个独立加锁的分片，降低高并发 Push 时的锁竞争；ticker 并行推进各分片后按 priority 合并派发；Get / Cancel 只锁定 value 所在分片；文件 / 分层队列同样生效；<=1 表示不分片")
+		"MemoryShards": 1,
+		// annotation@WorkerPool(comment="[all] 固定 worker 池大小；>0 时由 n 个常驻 worker 从有界通道拉取 item 执行（替代每 item 一个 goroutine，MaxConcurrency 不再生效），Redis 心跳合并为一个 ticker；<=0 表示禁用")
+		"WorkerPool": 0,
+		// annotation@HandlerMiddleware(comment="[all] handler middleware，Start / StartManualAck 均生效；第一个位于最外层，manual ack 模式下 next 在回调返回时返回")
+		"HandlerMiddleware": ([]HandlerMiddleware)(nil),
+		// annotation@PushInterceptor(comment="[all] 入队拦截器，Push / PushBatch 的每个 item 入队前按顺序调用，返回 error 拒绝入队；重试与 Import 不经过")
+		"PushInterceptor": ([]PushInterceptor)(nil),
+		// annotation@OnPushed(comment="[all] item 成功入队（含进入本地缓冲）后回调，Push / PushBatch 的每个 item 各一次；重试与 Import 不回调")
+		"OnPushed": (func(item *Item))(nil),
+		// annotation@OnDispatched(comment="[all] item 派发给 handler（含 manual ack 回调）前回调")
+		"OnDispatched": (func(item *Item))(nil),
+		// annotation@OnAcked(comment="[all] handler 成功或手动 Ack 且后端确认完成后回调")
+		"OnAcked": (func(item *Item))(nil),
+		// annotation@OnRetryScheduled(comment="[all] handler 失败且已按重试策略重新入队后回调，item 为本次失败的 item，delay 为重试延迟；进入死信时回调 OnDeadLetter")
+		"OnRetryScheduled": (func(item *Item, delay time.Duration))(nil),
+		// annotation@OnReclaimed(comment="[redis] reclaim 把超时或租约过期消费者持有的 item 从 doing 集搬回 delay 集后回调，每个分片每次 reclaim 至多一次")
+		"OnReclaimed": (func(topic string, values [][]byte))(nil),
+		// annotation@HistorySize(comment="[redis][memory] 每个 item 保留的生命周期历史条数（入队、派发、失败、重试、reclaim、ack、死信），通过 Queue.History 查询；<=0 表示不记录")
+		"HistorySize": 0,
+		// annotation@HistoryRetention(comment="[redis][memory] item 完成（ack 或死信）后历史的保留时长；未完成时保留到下一次预期事件之后再加该时长")
+		"HistoryRetention": 24 * time.Hour,
+		// annotation@ForecastBuckets(comment="[all] Collector 导出 <namespace>_status_forecast 的升序区间上界（如 time.Minute, time.Hour, 24*time.Hour）；为空时不导出")
+		"ForecastBuckets": ([]time.Duration)(nil),
 	}
 }
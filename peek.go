@@ -0,0 +1,280 @@
+package delayq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// peekLua 按 score 区间分页读取一个 ZSET，同时返回失败计数。
+// ARGV: min, max, offset, count；返回 [value, score, failed, ...]
+var peekLua = `
+local set, failed_hash = KEYS[1], KEYS[2]
+local items = redis.call('ZRANGEBYSCORE', set, ARGV[1], ARGV[2], 'WITHSCORES', 'LIMIT', tonumber(ARGV[3]), tonumber(ARGV[4]))
+local out = {}
+for i = 1, #items, 2 do
+	table.insert(out, items[i])
+	table.insert(out, items[i+1])
+	table.insert(out, tonumber(redis.call('HGET', failed_hash, items[i]) or 0))
+end
+return out
+`
+
+// defaultPeekLimit PeekOptions.Limit<=0 时每页返回的最大条数
+const defaultPeekLimit = 100
+
+// ItemState item 在队列中的状态
+type ItemState string
+
+const (
+	// ItemStateDelayed 等待到期
+	ItemStateDelayed ItemState = "delayed"
+	// ItemStateDoing 已派发、等待 ack（Redis doing 集）
+	ItemStateDoing ItemState = "doing"
+	// ItemStateDead 已投递死信（Redis dead 集，受 DeadLetterRetention 约束）
+	ItemStateDead ItemState = "dead"
+)
+
+// PeekOptions Peek 的过滤与分页参数
+type PeekOptions struct {
+	// From/To 按 ScheduledAt 过滤的闭区间，零值表示不限
+	From, To time.Time
+	// Limit 每页最大条数，<=0 时为 100
+	Limit int
+	// Cursor 上一页返回的 NextCursor，空表示第一页
+	Cursor string
+	// State 要浏览的状态，空表示 ItemStateDelayed
+	State ItemState
+}
+
+// PeekedItem Peek 返回的一条 item
+type PeekedItem struct {
+	// Item topic、value 与 priority
+	Item *Item
+	// State item 所处状态
+	State ItemState
+	// ScheduledAt delayed: 计划执行时间；doing: visibility 超时时间；dead: 投递死信的时间
+	ScheduledAt time.Time
+	// Attempts 已失败次数
+	Attempts int64
+}
+
+// PeekResult Peek 的一页结果
+type PeekResult struct {
+	Items []*PeekedItem
+	// NextCursor 下一页游标，空表示已无更多数据
+	NextCursor string
+}
+
+// peeker 支持 Peek 的 TopicQueue 实现
+type peeker interface {
+	peek(opts PeekOptions) (PeekResult, error)
+}
+
+// Peek 浏览 topic 中指定状态的 item（只读，不影响调度），用于排查 item 为何未按时执行。
+// 内存队列按计划执行时间排序；Redis 队列在单个分片内按 score 排序，多分片时依次返回各分片。
+// 内存队列仅支持 ItemStateDelayed，其他状态返回空结果。
+func (q *queue) Peek(topic string, opts PeekOptions) (PeekResult, error) {
+	val, ok := q.topicQueues.Load(topic)
+	if !ok {
+		return PeekResult{}, ErrTopicQueueHasClosed
+	}
+	p, ok := val.(peeker)
+	if !ok {
+		return PeekResult{}, ErrPeekUnsupported
+	}
+	return p.peek(opts.normalize())
+}
+
+// normalize 填充默认值
+func (o PeekOptions) normalize() PeekOptions {
+	if o.Limit <= 0 {
+		o.Limit = defaultPeekLimit
+	}
+	if o.State == "" {
+		o.State = ItemStateDelayed
+	}
+	return o
+}
+
+// contains 判断 t 是否在 [From, To] 区间内
+func (o PeekOptions) contains(t time.Time) bool {
+	if !o.From.IsZero() && t.Before(o.From) {
+		return false
+	}
+	if !o.To.IsZero() && t.After(o.To) {
+		return false
+	}
+	return true
+}
+
+// peek 遍历时间轮，按计划执行时间（同一时间按 priority 降序）排序后分页；Cursor 为偏移量
+func (q *memQueue) peek(opts PeekOptions) (PeekResult, error) {
+	offset := 0
+	if opts.Cursor != "" {
+		n, err := strconv.Atoi(opts.Cursor)
+		if err != nil || n < 0 {
+			return PeekResult{}, fmt.Errorf("delayq: invalid peek cursor %q", opts.Cursor)
+		}
+		offset = n
+	}
+	if opts.State != ItemStateDelayed {
+		return PeekResult{}, nil
+	}
+	var all []*PeekedItem
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		sh.wheel.each(func(p *wheelNode) {
+			if p.canceled {
+				return
+			}
+			// 使用节点记录的计划执行时间（毫秒），不按剩余槽位取整，导入与恢复的 item 保留原时间
+			at := time.UnixMilli(p.execAt)
+			if !opts.contains(at) {
+				return
+			}
+			pi := &PeekedItem{
+				Item:        &Item{Topic: q.topic, Value: p.item.GetValue(), Priority: p.item.GetPriority()},
+				State:       ItemStateDelayed,
+				ScheduledAt: at,
+			}
+			if d := p.item.GetDelaySecond(); d < 0 {
+				pi.Attempts = -d
+			}
+			all = append(all, pi)
+		})
+		sh.mx.Unlock()
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].ScheduledAt.Equal(all[j].ScheduledAt) {
+			return all[i].ScheduledAt.Before(all[j].ScheduledAt)
+		}
+		return all[i].Item.GetPriority() > all[j].Item.GetPriority()
+	})
+	if offset >= len(all) {
+		return PeekResult{}, nil
+	}
+	end := offset + opts.Limit
+	res := PeekResult{}
+	if end < len(all) {
+		res.NextCursor = strconv.Itoa(end)
+	} else {
+		end = len(all)
+	}
+	res.Items = all[offset:end]
+	return res, nil
+}
+
+// peek 依次读取各分片对应状态的 ZSET；Cursor 格式为 "<分片序号>:<分片内偏移>"
+func (q *redisQueue) peek(opts PeekOptions) (PeekResult, error) {
+	shard, offset := 0, 0
+	if opts.Cursor != "" {
+		parts := strings.SplitN(opts.Cursor, ":", 2)
+		var err1, err2 error
+		if len(parts) == 2 {
+			shard, err1 = strconv.Atoi(parts[0])
+			offset, err2 = strconv.Atoi(parts[1])
+		}
+		if len(parts) != 2 || err1 != nil || err2 != nil || shard < 0 || offset < 0 {
+			return PeekResult{}, fmt.Errorf("delayq: invalid peek cursor %q", opts.Cursor)
+		}
+	}
+	lo, hi := "-inf", "+inf"
+	if !opts.From.IsZero() {
+		// priority 会让 score 略小于执行时间戳，放宽半秒保证边界上的 item 被包含
+		lo = strconv.FormatFloat(float64(opts.From.Unix())-0.5, 'f', -1, 64)
+	}
+	if !opts.To.IsZero() {
+		hi = strconv.FormatFloat(float64(opts.To.Unix())+0.5, 'f', -1, 64)
+	}
+	res := PeekResult{}
+	for ; shard < len(q.shards); shard, offset = shard+1, 0 {
+		sh := q.shards[shard]
+		var key string
+		switch opts.State {
+		case ItemStateDelayed:
+			key = sh.delaySetKey
+		case ItemStateDoing:
+			key = sh.doingSetKey
+		case ItemStateDead:
+			key = sh.deadSetKey
+		default:
+			return PeekResult{}, fmt.Errorf("delayq: unknown item state %q", opts.State)
+		}
+		want := opts.Limit - len(res.Items)
+		// 多取一条用于判断当前分片是否还有下一页
+		out, err := q.runScript(q.opCtx(), q.peekScript, []string{key, sh.failedHashKey}, lo, hi, offset, want+1)
+		if err != nil {
+			return PeekResult{}, err
+		}
+		n := 0
+		for i := 0; i+2 < len(out) && n < want; i += 3 {
+			val, ok := out[i].(string)
+			if !ok {
+				continue
+			}
+			score := parseFloat64(out[i+1])
+			execTs := scoreToExecTs(score)
+			res.Items = append(res.Items, &PeekedItem{
+				Item:        &Item{Topic: q.topic, Value: []byte(val), Priority: priorityFromScore(score, execTs)},
+				State:       opts.State,
+				ScheduledAt: time.Unix(execTs, 0),
+				Attempts:    parseInt64(out[i+2]),
+			})
+			n++
+		}
+		if len(out)/3 > want {
+			res.NextCursor = strconv.Itoa(shard) + ":" + strconv.Itoa(offset+n)
+			return res, nil
+		}
+		if len(res.Items) == opts.Limit {
+			if shard+1 < len(q.shards) {
+				res.NextCursor = strconv.Itoa(shard+1) + ":0"
+			}
+			return res, nil
+		}
+	}
+	return res, nil
+}
+
+// peek 先浏览内存层（含已拉入内存的 item），再浏览 Redis 层；Cursor 以 "m"/"r" 前缀区分所在层
+func (q *tieredQueue) peek(opts PeekOptions) (PeekResult, error) {
+	if opts.State != ItemStateDelayed {
+		return q.redis.peek(opts)
+	}
+	cursor := opts.Cursor
+	if !strings.HasPrefix(cursor, "r") {
+		opts.Cursor = strings.TrimPrefix(cursor, "m")
+		res, err := q.memQueue.peek(opts)
+		if err != nil || res.NextCursor != "" {
+			if res.NextCursor != "" {
+				res.NextCursor = "m" + res.NextCursor
+			}
+			return res, err
+		}
+		if len(res.Items) == opts.Limit {
+			res.NextCursor = "r"
+			return res, nil
+		}
+		rest := opts
+		rest.Cursor = ""
+		rest.Limit = opts.Limit - len(res.Items)
+		more, err := q.redis.peek(rest)
+		if err != nil {
+			return PeekResult{}, err
+		}
+		res.Items = append(res.Items, more.Items...)
+		if more.NextCursor != "" {
+			res.NextCursor = "r" + more.NextCursor
+		}
+		return res, nil
+	}
+	opts.Cursor = strings.TrimPrefix(cursor, "r")
+	res, err := q.redis.peek(opts)
+	if res.NextCursor != "" {
+		res.NextCursor = "r" + res.NextCursor
+	}
+	return res, err
+}
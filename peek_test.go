@@ -0,0 +1,167 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const idxPeek = 14
+
+// TestPeek_MemoryOrderFilterPage 内存队列按计划时间与优先级排序，支持时间区间过滤与游标分页
+func TestPeek_MemoryOrderFilterPage(t *testing.T) {
+	q := New(WithLogger(NopLogger()))
+	defer q.Close()
+	if err := q.Start("peek", func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{
+		{Topic: "peek", Value: []byte("late"), DelaySecond: 300},
+		{Topic: "peek", Value: []byte("low"), DelaySecond: 60},
+		{Topic: "peek", Value: []byte("high"), DelaySecond: 60, Priority: 9},
+		{Topic: "peek", Value: []byte("gone"), DelaySecond: 60},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Cancel("peek", []byte("gone")); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := q.Peek("peek", PeekOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || string(page.Items[0].Item.GetValue()) != "high" || string(page.Items[1].Item.GetValue()) != "low" {
+		t.Fatalf("unexpected first page %+v", page.Items)
+	}
+	if page.Items[0].State != ItemStateDelayed || page.Items[0].Item.GetPriority() != 9 {
+		t.Fatalf("unexpected item %+v", page.Items[0])
+	}
+	if at := time.Until(page.Items[0].ScheduledAt); at < 58*time.Second || at > 61*time.Second {
+		t.Fatalf("scheduled time should be ~60s ahead, got %v", at)
+	}
+	next, err := q.Peek("peek", PeekOptions{Limit: 2, Cursor: page.NextCursor})
+	if err != nil || len(next.Items) != 1 || string(next.Items[0].Item.GetValue()) != "late" || next.NextCursor != "" {
+		t.Fatalf("unexpected second page %+v err=%v", next, err)
+	}
+
+	ranged, err := q.Peek("peek", PeekOptions{From: time.Now().Add(2 * time.Minute)})
+	if err != nil || len(ranged.Items) != 1 || string(ranged.Items[0].Item.GetValue()) != "late" {
+		t.Fatalf("From filter failed: %+v err=%v", ranged, err)
+	}
+	if dead, _ := q.Peek("peek", PeekOptions{State: ItemStateDead}); len(dead.Items) != 0 {
+		t.Fatal("memory queue keeps no dead letters")
+	}
+	if _, err = q.Peek("peek", PeekOptions{Cursor: "x"}); err == nil {
+		t.Fatal("invalid cursor should error")
+	}
+	if _, err = q.Peek("missing", PeekOptions{}); !errors.Is(err, ErrTopicQueueHasClosed) {
+		t.Fatalf("want ErrTopicQueueHasClosed got %v", err)
+	}
+}
+
+// TestPeek_MemoryExactScheduledAt 内存队列按节点记录的毫秒级执行时间过滤并返回 ScheduledAt
+func TestPeek_MemoryExactScheduledAt(t *testing.T) {
+	tp := NewMemoryTopicQueue(context.Background(), "peek-exact", WithLogger(NopLogger())).(*memQueue)
+	if err := tp.Start(noopHandler); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	execAt := nowFunc().Add(30*time.Second + 456*time.Millisecond).UnixMilli()
+	if err := tp.importRecords([]*ExportRecord{{Value: []byte("exact"), ExecuteAt: execAt}}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := tp.peek(PeekOptions{State: ItemStateDelayed, Limit: 10})
+	if err != nil || len(page.Items) != 1 {
+		t.Fatalf("unexpected page %+v err=%v", page, err)
+	}
+	if at := page.Items[0].ScheduledAt; !at.Equal(time.UnixMilli(execAt)) {
+		t.Fatalf("want scheduled at %v got %v", time.UnixMilli(execAt), at)
+	}
+	// 区间边界按毫秒比较
+	if page, _ = tp.peek(PeekOptions{State: ItemStateDelayed, Limit: 10, From: time.UnixMilli(execAt + 1)}); len(page.Items) != 0 {
+		t.Fatalf("From after execute time should exclude item, got %+v", page.Items)
+	}
+	if page, _ = tp.peek(PeekOptions{State: ItemStateDelayed, Limit: 10, To: time.UnixMilli(execAt)}); len(page.Items) != 1 {
+		t.Fatalf("To at execute time should include item, got %+v", page.Items)
+	}
+}
+
+// TestPeek_RedisShardsAndStates Redis 队列按分片分页，区间换算为 score，按状态选择 ZSET
+func TestPeek_RedisShardsAndStates(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "rpeek", WithRedisScriptBuilder(b), WithRedisShards(2)).(*redisQueue)
+	now := unix()
+	var keys []string
+	var ranges [][]interface{}
+	// 分片 0 有 3 条、分片 1 有 1 条
+	b.scripts[idxPeek].evalShaFn = func(_ context.Context, k []string, args ...interface{}) ([]interface{}, error) {
+		keys = append(keys, k[0])
+		ranges = append(ranges, args)
+		total := 3
+		if k[0] == rq.shards[1].delaySetKey {
+			total = 1
+		}
+		offset, count := args[2].(int), args[3].(int)
+		var out []interface{}
+		for i := offset; i < total && i < offset+count; i++ {
+			out = append(out, k[0]+"#"+strconv.Itoa(i), itemScore(now+int64(i), 2), int64(i))
+		}
+		return out, nil
+	}
+
+	page, err := rq.peek(PeekOptions{Limit: 2}.normalize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || page.NextCursor != "0:2" {
+		t.Fatalf("unexpected first page %d items cursor=%q", len(page.Items), page.NextCursor)
+	}
+	if it := page.Items[1]; it.Attempts != 1 || it.Item.GetPriority() != 2 || it.ScheduledAt.Unix() != now+1 {
+		t.Fatalf("unexpected item %+v", it)
+	}
+	page, err = rq.peek(PeekOptions{Limit: 2, Cursor: page.NextCursor}.normalize())
+	if err != nil || len(page.Items) != 2 || page.NextCursor != "" {
+		t.Fatalf("second page should span both shards: %+v err=%v", page, err)
+	}
+	if keys[len(keys)-1] != rq.shards[1].delaySetKey {
+		t.Fatalf("second page should continue into shard 1, keys=%v", keys)
+	}
+
+	from := time.Unix(now+10, 0)
+	if _, err = rq.peek(PeekOptions{From: from, State: ItemStateDead}.normalize()); err != nil {
+		t.Fatal(err)
+	}
+	last := ranges[len(ranges)-1]
+	if keys[len(keys)-2] != rq.shards[0].deadSetKey || last[0] != strconv.FormatFloat(float64(now+10)-0.5, 'f', -1, 64) || last[1] != "+inf" {
+		t.Fatalf("dead state should scan dead set with score range, keys=%v args=%v", keys, last)
+	}
+}
+
+// TestPeek_TieredSpansTiers 分层队列先返回内存层再返回 Redis 层，游标跨层连续
+func TestPeek_TieredSpansTiers(t *testing.T) {
+	q, b := newTestTieredQueue(t)
+	b.scripts[idxPeek].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		if args[2].(int) > 0 {
+			return nil, nil
+		}
+		return []interface{}{"remote", itemScore(unix()+600, 0), int64(0)}, nil
+	}
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push(&Item{Value: []byte("local"), DelaySecond: 10}); err != nil {
+		t.Fatal(err)
+	}
+	page, err := q.peek(PeekOptions{Limit: 1}.normalize())
+	if err != nil || len(page.Items) != 1 || string(page.Items[0].Item.GetValue()) != "local" || page.NextCursor != "r" {
+		t.Fatalf("unexpected memory page %+v err=%v", page, err)
+	}
+	page, err = q.peek(PeekOptions{Limit: 1, Cursor: page.NextCursor}.normalize())
+	if err != nil || len(page.Items) != 1 || string(page.Items[0].Item.GetValue()) != "remote" || page.NextCursor != "" {
+		t.Fatalf("unexpected redis page %+v err=%v", page, err)
+	}
+}
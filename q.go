@@ -50,6 +50,8 @@ type queue struct {
 	topicQueues sync.Map
 	monitors    *sync.Map
 	collector   Collector
+	// breaker 所有 Redis topic 共享的熔断器；未启用时为 nil
+	breaker *circuitBreaker
 
 	mx sync.Mutex
 }
@@ -62,6 +64,7 @@ func New(opts ...Option) Queue {
 	ctx, cancel := context.WithCancel(context.Background())
 	q := &queue{opts: newConfig(opts...), ctx: ctx, cancel: cancel, monitors: new(sync.Map)}
 	q.collector = newCollector(q, q.opts)
+	q.breaker = newCircuitBreaker(q.opts)
 	return q
 }
 
@@ -72,14 +75,41 @@ func (q *queue) Status() Status {
 	defer q.mx.Unlock()
 
 	s := Status{
-		QueueLength: make(map[string]int64),
-		InFlight:    make(map[string]int64),
+		QueueLength:   make(map[string]int64),
+		InFlight:      make(map[string]int64),
+		Consumers:     make(map[string]map[string]int64),
+		Spooled:       make(map[string]int64),
+		MaxLateness:   make(map[string]time.Duration),
+		Doing:         make(map[string]int64),
+		Dead:          make(map[string]int64),
+		Overdue:       make(map[string]int64),
+		OldestOverdue: make(map[string]time.Duration),
+		NextDue:       make(map[string]time.Time),
 	}
+	now := nowFunc()
 	q.topicQueues.Range(func(key, value any) bool {
 		topic := key.(string)
 		tq := value.(TopicQueue)
 		s.QueueLength[topic] = tq.Length()
 		s.InFlight[topic] = tq.InFlight()
+		if cq, ok := tq.(interface{ consumerInFlight() map[string]int64 }); ok {
+			if cs := cq.consumerInFlight(); cs != nil {
+				s.Consumers[topic] = cs
+			}
+		}
+		if dq, ok := tq.(statusDetailer); ok {
+			if d, err := dq.statusDetail(); err == nil {
+				s.fillDetail(topic, d, now)
+			}
+		}
+		if lq, ok := tq.(interface{ maxLateness() time.Duration }); ok {
+			s.MaxLateness[topic] = lq.maxLateness()
+		}
+		if sq, ok := tq.(interface{ spoolDepth() int64 }); ok {
+			if n := sq.spoolDepth(); n >= 0 {
+				s.Spooled[topic] = n
+			}
+		}
 		return true
 	})
 	return s
@@ -90,6 +120,7 @@ func (q *queue) StartTopicQueue(tq TopicQueue, f func(*Item) error) error {
 	if ok {
 		return ErrTopicQueueHasRegistered
 	}
+	q.attachMetrics(tq)
 	topic := tq.Topic()
 	return tq.Start(func(item *Item) (err error) {
 		// 即使 panic 也要让 monitor 计数 + 重新抛给 baseQueue 让其捕获并打 panic metric
@@ -121,6 +152,7 @@ func (q *queue) StartManualAck(topic string, f func(*Item, Acker)) error {
 	if ok {
 		return ErrTopicQueueHasRegistered
 	}
+	q.attachMetrics(tq)
 	wrapped := func(item *Item, ack Acker) {
 		f(item, ackerWithMonitor{
 			inner: ack,
@@ -131,10 +163,23 @@ func (q *queue) StartManualAck(topic string, f func(*Item, Acker)) error {
 	return tq.StartManualAck(wrapped)
 }
 
-// newTopicQueue 根据 RedisScriptBuilder 是否设置选择 Redis 或 内存实现
+// newTopicQueue 根据 RedisScriptBuilder 是否设置选择 Redis 或 内存实现；
+// 同时配置了 TieredThreshold 时使用内存 + Redis 分层实现
 func (q *queue) newTopicQueue(topic string) TopicQueue {
+	if q.opts.GetRedisScriptBuilder() != nil && q.opts.GetTieredThreshold() > 0 {
+		tq := newTieredTopicQueue(q.ctx, topic, q.opts)
+		if q.breaker != nil {
+			tq.redis.breaker = q.breaker
+			tq.tickerRetryAfter = tq.redis.breakerRetryAfter
+		}
+		return tq
+	}
 	if q.opts.GetRedisScriptBuilder() != nil {
-		return newRedisTopicQueue(q.ctx, topic, q.opts)
+		tq := newRedisTopicQueue(q.ctx, topic, q.opts)
+		if rq, ok := tq.(*redisQueue); ok && q.breaker != nil {
+			rq.breaker = q.breaker
+		}
+		return tq
 	}
 	return newMemoryTopicQueue(q.ctx, topic, q.opts)
 }
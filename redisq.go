@@ -2,25 +2,31 @@ package delayq
 
 import (
 	"context"
-	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 // moveLua 把 source ZSET 中 score <= max_score 的成员搬到 target，
-// 同时把 target 中的 score 设为 to_score。
+// 同时把 target 中的 score 设为 to_score；传入 KEYS[3]（owner hash）时一并清除被搬走成员的归属，
+// KEYS[4..] 为各消费者的持有集。
 // 返回原始 ZRANGEBYSCORE 结果 [value, score, value, score, ...]
 //
 // 注意：max_score 是"score 上界"（通常是当前时间戳），与 delayq 的 Item.Priority 无关。
-var moveLua = `
-local source_set, target_set  = KEYS[1], KEYS[2]
+var moveLua = releaseOwnerLua + `
+local source_set, target_set, owner_hash  = KEYS[1], KEYS[2], KEYS[3]
 local max_score, to_score = ARGV[1], ARGV[2]
+local owned = owner_hash and owned_sets(owner_hash, 4)
 local items = redis.call('ZRANGEBYSCORE', source_set, '-inf', max_score, 'WITHSCORES')
 for i, value in ipairs(items) do
 	if i % 2 ~= 0 then
 		redis.call('ZADD', target_set, to_score or 0.0, value)
 		redis.call('ZREM', source_set, value)
+		if owner_hash then
+			release_owner(owner_hash, owned, value)
+		end
 	end
 end
 return items
@@ -34,48 +40,112 @@ local l2 = redis.call('ZCARD', doing_set)
 return {l1, l2}
 `
 
-// addLua 把若干 (value, score) 对添加到 delay 集。
+// addLua 把若干 (value, score) 对添加到 delay 集，并按参数顺序为每个 value 分配递增的入队序号，
+// poll 时同一 score（同秒同 priority）的 item 按序号先进先出。
+// score 同时记为计划执行时间（seq hash 字段 'e:'），reclaim 改写 delay 集 score 后仍可据此计算派发延迟。
 // ARGV: value1, score1, value2, score2, ...
 var addLua = `
-local delay_set  = KEYS[1]
+local delay_set, seq_hash = KEYS[1], KEYS[2]
+local n = #ARGV / 2
+local base = redis.call('HINCRBY', seq_hash, 'n', n) - n
 for i = 1, #ARGV, 2 do
 	local v, s = ARGV[i], ARGV[i+1]
 	redis.call('ZADD', delay_set, s, v)
+	redis.call('HSET', seq_hash, 'v:' .. v, base + (i + 1) / 2, 'e:' .. v, s)
 end
 return {true}
 `
 
-// ackSuccessLua 业务处理成功，从 delay/doing/failed 三处清除
-var ackSuccessLua = `
-local delay_set, doing_set, failed_hash  = KEYS[1], KEYS[2], KEYS[3]
+// ackSuccessLua 业务处理成功，从 delay/doing/failed/owner/seq 五处清除
+var ackSuccessLua = releaseOwnerLua + `
+local delay_set, doing_set, failed_hash, owner_hash, seq_hash  = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local owned = owned_sets(owner_hash, 6)
 local value = ARGV[1]
 redis.call('ZREM', delay_set, value)
 redis.call('ZREM', doing_set, value)
 redis.call('HDEL', failed_hash, value)
+release_owner(owner_hash, owned, value)
+redis.call('HDEL', seq_hash, 'v:' .. value, 'e:' .. value)
 return {true}
 `
 
 // ackFailedLua 业务处理失败：
-// - 从 doing 移除
-// - 重新加入 delay，score=next_score（未来时间戳）
+// - 从 doing 移除，并清除归属记录
+// - 重新加入 delay，score=next_score（未来时间戳），分配新的入队序号并把 next_score 记为计划执行时间
 // - 失败计数 Hash[value] += 1，返回新的失败计数
-var ackFailedLua = `
-local delay_set, doing_set, failed_hash  = KEYS[1], KEYS[2], KEYS[3]
+var ackFailedLua = releaseOwnerLua + `
+local delay_set, doing_set, failed_hash, owner_hash, seq_hash  = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local owned = owned_sets(owner_hash, 6)
 local value, next_score = ARGV[1], ARGV[2]
 redis.call('ZREM', doing_set, value)
+release_owner(owner_hash, owned, value)
 redis.call('ZADD', delay_set, next_score, value)
+redis.call('HSET', seq_hash, 'v:' .. value, redis.call('HINCRBY', seq_hash, 'n', 1), 'e:' .. value, next_score)
 local cnt = redis.call('HINCRBY', failed_hash, value, 1)
 return {cnt}
 `
 
-// failedCountLua 读取多个 value 的失败计数
-var failedCountLua = `
-local failed_hash = KEYS[1]
+// pollLua 一次往返完成 poll：把 delay 集中 score <= now 的 item 取出，同时读取失败计数。
+// 取出的 item 按 (score, 入队序号) 排序后处理，同秒同 priority 的 item 先进先出；
+// 被 reclaim 放回 delay 集的 item 没有序号，排在同 score 的最前面。
+//   - 失败计数未超过 retry_times（或 retry_times<0）：搬到 doing 集（score=to_score），
+//     清除旧归属，consumer 非空时登记到 owner hash 与该消费者的持有集（KEYS[7..] 声明，含本实例）
+//   - 失败计数已超过 retry_times：直接在服务端投递死信，清除失败计数与归属；
+//     retention>0 时写入 dead 集（score=now）并清理超过 retention 秒的旧死信
+//
+// 返回 [value, score, failed, dead, value, score, failed, dead, ...]，dead=1 表示已投递死信。
+// score 为入队（或重试）时记录的计划执行 score，被 reclaim 放回的 item 仍返回原值；
+// 没有记录时（旧版本写入的 item）回退到 delay 集 score。计划执行 score 保留到 ack/cancel/死信时清除。
+var pollLua = releaseOwnerLua + `
+local delay_set, doing_set, failed_hash, owner_hash, dead_set, seq_hash = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6]
+local owned = owned_sets(owner_hash, 7)
+local now, to_score = tonumber(ARGV[1]), ARGV[2]
+local retry_times, consumer, retention = tonumber(ARGV[3]), ARGV[4], tonumber(ARGV[5])
+local items = redis.call('ZRANGEBYSCORE', delay_set, '-inf', now, 'WITHSCORES')
+local due = {}
+for i = 1, #items, 2 do
+	local field = 'v:' .. items[i]
+	local seq = tonumber(redis.call('HGET', seq_hash, field) or 0)
+	redis.call('HDEL', seq_hash, field)
+	table.insert(due, {items[i], items[i+1], tonumber(items[i+1]), seq})
+end
+table.sort(due, function(a, b)
+	if a[3] ~= b[3] then return a[3] < b[3] end
+	if a[4] ~= b[4] then return a[4] < b[4] end
+	return a[1] < b[1]
+end)
 local out = {}
-for i, v in ipairs(ARGV) do
-	local c = redis.call('HGET', failed_hash, v)
-	if c == false then c = 0 end
-	out[i] = c
+for _, e in ipairs(due) do
+	local value = e[1]
+	local score = redis.call('HGET', seq_hash, 'e:' .. value) or e[2]
+	redis.call('ZREM', delay_set, value)
+	local failed = tonumber(redis.call('HGET', failed_hash, value) or 0)
+	local dead = 0
+	if retry_times >= 0 and failed > retry_times then
+		dead = 1
+		redis.call('HDEL', failed_hash, value)
+		redis.call('HDEL', seq_hash, 'e:' .. value)
+		release_owner(owner_hash, owned, value)
+		if retention > 0 then
+			redis.call('ZADD', dead_set, now, value)
+		end
+	else
+		redis.call('ZADD', doing_set, to_score, value)
+		release_owner(owner_hash, owned, value)
+		if consumer ~= '' then
+			redis.call('HSET', owner_hash, value, consumer)
+			if owned[consumer] then
+				redis.call('SADD', owned[consumer], value)
+			end
+		end
+	end
+	table.insert(out, value)
+	table.insert(out, score)
+	table.insert(out, failed)
+	table.insert(out, dead)
+end
+if retention > 0 then
+	redis.call('ZREMRANGEBYSCORE', dead_set, '-inf', '(' .. (now - retention))
 end
 return out
 `
@@ -92,14 +162,17 @@ if s2 then return {2, s2} end
 return {0, 0}
 `
 
-// cancelLua 从 delay/doing/failed 三处删除 value，返回删除数量
-var cancelLua = `
-local delay_set, doing_set, failed_hash = KEYS[1], KEYS[2], KEYS[3]
+// cancelLua 从 delay/doing/failed/owner/seq 五处删除 value，返回删除数量
+var cancelLua = releaseOwnerLua + `
+local delay_set, doing_set, failed_hash, owner_hash, seq_hash = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local owned = owned_sets(owner_hash, 6)
 local value = ARGV[1]
 local n = 0
 n = n + redis.call('ZREM', delay_set, value)
 n = n + redis.call('ZREM', doing_set, value)
 redis.call('HDEL', failed_hash, value)
+release_owner(owner_hash, owned, value)
+redis.call('HDEL', seq_hash, 'v:' .. value, 'e:' .. value)
 return {n}
 `
 
@@ -129,9 +202,10 @@ type RedisScriptBuilder interface {
 	Build(src string) RedisScript
 }
 
-// priorityScale 优先级在 score 中占的最大权重（秒级）。
-// score = execTimestamp - priority * priorityScale；priorityScale=1e-6 表示 priority 在 microsecond
-// 级别影响排序，不会跨秒错位（10^9 时间戳 + 10^-6 weight 仍在 double 精度内）。
+// priorityScale 每单位 priority 在 score 中的权重（秒）。
+// score = execTimestamp - priority * priorityScale，即 priority 每增加 1，score 提前 1µs；
+// |priority| < 500000 时偏移不足半秒，不会跨秒错位，scoreToExecTs 四舍五入即可还原执行秒数
+// （10^9 时间戳 + 10^-6 weight 仍在 double 精度内）。
 const priorityScale = 1e-6
 
 // itemScore 计算 item 的 ZSET score
@@ -148,22 +222,52 @@ func scoreToExecTs(score float64) int64 {
 	return int64(score - 0.5)
 }
 
+// priorityFromScore 从 ZSET score 与执行时间戳还原 item.Priority
+func priorityFromScore(score float64, execTs int64) int32 {
+	return int32(math.Round((float64(execTs) - score) / priorityScale))
+}
+
 type redisQueue struct {
 	*baseQueue
 
-	delaySetKey   string
-	doingSetKey   string
-	failedHashKey string
-
-	moveScript        RedisScript
-	addScript         RedisScript
-	lengthScript      RedisScript
-	ackSuccessScript  RedisScript
-	ackFailedScript   RedisScript
-	failedCountScript RedisScript
-	getScript         RedisScript
-	cancelScript      RedisScript
-	heartbeatScript   RedisScript
+	// shards topic 的分片 key；未配置 RedisShards 时仅一个分片
+	shards     []*redisShard
+	consumerID string
+	// spool Redis 不可用时的本地 Push 缓冲；未配置 SpoolSize 时为 nil
+	spool *spool
+	// breaker Redis 脚本执行熔断器；未配置 BreakerFailureThreshold 时为 nil。
+	// 通过 New 创建时同一 Queue 的所有 topic 共享
+	breaker *circuitBreaker
+	// hbItems WorkerPool 模式下正在执行、由 heartbeatAll 统一续期的 item
+	hbMu    sync.Mutex
+	hbItems map[*Item]struct{}
+
+	moveScript         RedisScript
+	addScript          RedisScript
+	lengthScript       RedisScript
+	ackSuccessScript   RedisScript
+	ackFailedScript    RedisScript
+	pollScript         RedisScript
+	getScript          RedisScript
+	cancelScript       RedisScript
+	heartbeatScript    RedisScript
+	leaseScript        RedisScript
+	leaseReclaimScript RedisScript
+	consumersScript    RedisScript
+	exportScript       RedisScript
+	importScript       RedisScript
+	peekScript         RedisScript
+	cancelBatchScript  RedisScript
+	cancelPrefixScript RedisScript
+	purgeScript        RedisScript
+	historyScript      RedisScript
+	historyGetScript   RedisScript
+	statusScript       RedisScript
+	forecastScript     RedisScript
+	ownedCountScript   RedisScript
+
+	// consumers 各分片已登记消费者的缓存，用于声明持有集 key
+	consumers consumerCache
 }
 
 // NewRedisTopicQueue 构造一个使用 Redis 作为后端的 TopicQueue。
@@ -175,28 +279,53 @@ func NewRedisTopicQueue(ctx context.Context, topic string, opts ...Option) Topic
 func newRedisTopicQueue(ctx context.Context, topic string, opts *Options) TopicQueue {
 	builder := opts.GetRedisScriptBuilder()
 	q := &redisQueue{
-		delaySetKey:       fmt.Sprintf("do:{%s}", topic),
-		doingSetKey:       fmt.Sprintf("doing:{%s}", topic),
-		failedHashKey:     fmt.Sprintf("failed:{%s}", topic),
-		moveScript:        builder.Build(moveLua),
-		addScript:         builder.Build(addLua),
-		lengthScript:      builder.Build(lengthLua),
-		ackSuccessScript:  builder.Build(ackSuccessLua),
-		ackFailedScript:   builder.Build(ackFailedLua),
-		failedCountScript: builder.Build(failedCountLua),
-		getScript:         builder.Build(getLua),
-		cancelScript:      builder.Build(cancelLua),
-		heartbeatScript:   builder.Build(heartbeatLua),
-	}
-	if prefix := opts.GetRedisKeyPrefix(); len(prefix) > 0 {
-		q.delaySetKey = fmt.Sprintf("%s:%s", prefix, q.delaySetKey)
-		q.doingSetKey = fmt.Sprintf("%s:%s", prefix, q.doingSetKey)
-		q.failedHashKey = fmt.Sprintf("%s:%s", prefix, q.failedHashKey)
+		shards:             newRedisShards(opts.GetRedisKeyPrefix(), topic, opts.GetRedisShards()),
+		consumerID:         opts.GetConsumerID(),
+		moveScript:         buildScript(builder, "move", moveLua),
+		addScript:          buildScript(builder, "add", addLua),
+		lengthScript:       buildScript(builder, "length", lengthLua),
+		ackSuccessScript:   buildScript(builder, "ackSuccess", ackSuccessLua),
+		ackFailedScript:    buildScript(builder, "ackFailed", ackFailedLua),
+		pollScript:         buildScript(builder, "poll", pollLua),
+		getScript:          buildScript(builder, "get", getLua),
+		cancelScript:       buildScript(builder, "cancel", cancelLua),
+		heartbeatScript:    buildScript(builder, "heartbeat", heartbeatLua),
+		leaseScript:        buildScript(builder, "lease", leaseLua),
+		leaseReclaimScript: buildScript(builder, "leaseReclaim", leaseReclaimLua),
+		consumersScript:    buildScript(builder, "consumers", consumersLua),
+		exportScript:       buildScript(builder, "export", exportLua),
+		importScript:       buildScript(builder, "import", importLua),
+		peekScript:         buildScript(builder, "peek", peekLua),
+		cancelBatchScript:  buildScript(builder, "cancelBatch", cancelBatchLua),
+		cancelPrefixScript: buildScript(builder, "cancelPrefix", cancelPrefixLua),
+		purgeScript:        buildScript(builder, "purge", purgeLua),
+		historyScript:      buildScript(builder, "history", historyLua),
+		historyGetScript:   buildScript(builder, "historyGet", historyGetLua),
+		statusScript:       buildScript(builder, "status", statusLua),
+		forecastScript:     buildScript(builder, "forecast", forecastLua),
+		ownedCountScript:   buildScript(builder, "ownedCount", ownedCountLua),
 	}
 	q.baseQueue = newBaseQueue(ctx, topic, opts)
 	q.success = q.onSuccess
+	if q.breaker = newCircuitBreaker(opts); q.breaker != nil {
+		q.tickerRetryAfter = q.breakerRetryAfter
+	}
+	if size := opts.GetSpoolSize(); size > 0 {
+		sp, err := newSpool(topic, size, opts.GetSpoolPath())
+		if err != nil {
+			q.log.Errorf("topic=%s load spool file %s error: %v", q.topic, sp.path, err)
+		}
+		if n := sp.len(); n > 0 {
+			q.log.Infof("topic=%s loaded %d spooled items from %s", q.topic, n, sp.path)
+		}
+		q.spool = sp
+	}
 	q.failed = q.onFailed
 
+	if n := opts.GetHistorySize(); n > 0 {
+		q.history = &redisHistory{q: q, size: n, retention: opts.GetHistoryRetention()}
+	}
+
 	// 心跳：handler 执行期间定期 ZADD XX 刷新 doing 集 score，避免 reclaim 误判长任务
 	if interval := q.heartbeatInterval(); interval > 0 {
 		q.onItemStart = q.startHeartbeat
@@ -206,36 +335,23 @@ func newRedisTopicQueue(ctx context.Context, topic string, opts *Options) TopicQ
 
 // heartbeatInterval 返回心跳间隔；0 表示禁用，否则返回实际间隔（默认 VisibilityTimeout/3）
 func (q *redisQueue) heartbeatInterval() time.Duration {
-	hi := q.opts.GetHeartbeatInterval()
-	if hi < 0 {
-		return 0 // 显式禁用
-	}
-	if hi > 0 {
-		return hi
-	}
-	// 默认 VisibilityTimeout/3，至少 1s
-	vt := q.opts.GetVisibilityTimeout()
-	if vt <= 0 {
-		return 0
-	}
-	d := vt / 3
-	if d < time.Second {
-		d = time.Second
-	}
-	return d
+	return heartbeatIntervalFor(q.opts)
 }
 
 // startHeartbeat 启动 heartbeat goroutine，返回 stop 函数。
 // 每 interval 调用 heartbeatLua（ZADD XX）刷新 doing 集中该 item 的 score。
 // 若 ZSCORE 不再存在（业务已 ack），心跳自动退出。
+// 启用 WorkerPool 时不启动 goroutine，改为登记到 heartbeatAll 统一续期。
 func (q *redisQueue) startHeartbeat(item *Item) func() {
 	interval := q.heartbeatInterval()
 	if interval <= 0 {
 		return nil
 	}
+	if q.poolSize > 0 {
+		return q.registerHeartbeat(item)
+	}
 	stopCh := make(chan struct{})
 	doneCh := make(chan struct{})
-	value := item.GetValue()
 
 	go func() {
 		defer close(doneCh)
@@ -251,23 +367,9 @@ func (q *redisQueue) startHeartbeat(item *Item) func() {
 				return
 			case <-t.C:
 			}
-			vt := int64(q.opts.GetVisibilityTimeout() / time.Second)
-			if vt <= 0 {
-				vt = 60
-			}
-			newScore := unix() + vt
-			res, err := q.runScript(q.opCtx(), q.heartbeatScript,
-				[]string{q.doingSetKey}, value, newScore)
-			if err != nil {
-				q.monitorCount(MetricHeartbeatError)
-				q.log.Warnf("topic=%s heartbeat error: %v", q.topic, err)
-				continue
-			}
-			// 返回 {0} 表示 doing 集中已不存在该 item（被 ack 或 cancel），结束心跳
-			if len(res) > 0 && parseInt64(res[0]) == 0 {
+			if !q.heartbeat(item) {
 				return
 			}
-			q.monitorCount(MetricHeartbeat)
 		}
 	}()
 	return func() {
@@ -276,6 +378,64 @@ func (q *redisQueue) startHeartbeat(item *Item) func() {
 	}
 }
 
+// heartbeat 刷新一次 item 在 doing 集中的 score，返回 false 表示 item 已不在 doing 集（被 ack 或 cancel）。
+// 出错时记录 MetricHeartbeatError 并返回 true，等待下次重试。
+func (q *redisQueue) heartbeat(item *Item) bool {
+	value := item.GetValue()
+	vt := int64(q.opts.GetVisibilityTimeout() / time.Second)
+	if vt <= 0 {
+		vt = 60
+	}
+	newScore := unix() + vt
+	res, err := q.runScript(q.opCtx(), q.heartbeatScript,
+		[]string{q.shardOf(value).doingSetKey}, value, newScore)
+	if err != nil {
+		q.monitorCount(MetricHeartbeatError)
+		q.log.Warnf("topic=%s heartbeat error: %v", q.topic, err)
+		return true
+	}
+	// 返回 {0} 表示 doing 集中已不存在该 item，结束心跳
+	if len(res) > 0 && parseInt64(res[0]) == 0 {
+		return false
+	}
+	q.monitorCount(MetricHeartbeat)
+	return true
+}
+
+// registerHeartbeat 把执行中的 item 登记到共享心跳集合，返回注销函数
+func (q *redisQueue) registerHeartbeat(item *Item) func() {
+	q.hbMu.Lock()
+	if q.hbItems == nil {
+		q.hbItems = make(map[*Item]struct{})
+	}
+	q.hbItems[item] = struct{}{}
+	q.hbMu.Unlock()
+	return func() {
+		q.hbMu.Lock()
+		delete(q.hbItems, item)
+		q.hbMu.Unlock()
+	}
+}
+
+// heartbeatAll WorkerPool 模式下的心跳 ticker：为所有登记中的 item 续期，
+// 已不在 doing 集的 item 移出集合。注销与续期并发时 ZADD XX 保证不会把已 ack 的 item 写回。
+func (q *redisQueue) heartbeatAll() error {
+	q.hbMu.Lock()
+	items := make([]*Item, 0, len(q.hbItems))
+	for it := range q.hbItems {
+		items = append(items, it)
+	}
+	q.hbMu.Unlock()
+	for _, it := range items {
+		if !q.heartbeat(it) {
+			q.hbMu.Lock()
+			delete(q.hbItems, it)
+			q.hbMu.Unlock()
+		}
+	}
+	return nil
+}
+
 // opCtx 返回基于 q.ctx 的操作上下文，保证 Close/ctx 取消时 Redis 调用可被及时中断
 func (q *redisQueue) opCtx() context.Context {
 	if q.ctx != nil {
@@ -284,7 +444,10 @@ func (q *redisQueue) opCtx() context.Context {
 	return context.Background()
 }
 
-// Push 将 item 加入延迟队列，DelaySecond 为相对秒数；item.Priority 用于同时间内排序
+// Push 将 item 加入延迟队列，DelaySecond 为相对秒数；item.Priority 用于同时间内排序。
+// 启用 SpoolSize 时，Redis 不可用（连接 / 超时错误或熔断打开）导致写入失败的 item 进入本地缓冲并返回 nil，
+// 脚本错误等确定性错误直接返回；
+// 缓冲非空期间新 item 直接追加到缓冲尾部，保证补写顺序与 Push 顺序一致。
 func (q *redisQueue) Push(item *Item) error {
 	if err := q.prepareItem(item); err != nil {
 		return err
@@ -293,13 +456,14 @@ func (q *redisQueue) Push(item *Item) error {
 	if delay < 0 {
 		delay = 0
 	}
-	score := itemScore(unix()+delay, item.GetPriority())
-	_, err := q.runScript(q.opCtx(), q.addScript, []string{q.delaySetKey}, item.GetValue(), score)
-	return err
+	items, execAts := []*Item{item}, []int64{unix() + delay}
+	return q.addOrSpool(items, execAts)
 }
 
-// PushBatch 批量推送，原子地通过单个 Lua 脚本完成所有 ZADD。
+// PushBatch 批量推送，每个分片通过单个 Lua 脚本原子地完成所有 ZADD；
+// 分片数 >1 时批次按分片拆分，仅保证单分片内原子。
 // 限流时整批一次性扣 len(items) 个 token，不足直接拒绝整批。
+// 启用 SpoolSize 时写入失败的整批进入本地缓冲（已写入的分片补写时重复 ZADD，结果不变）。
 func (q *redisQueue) PushBatch(items []*Item) error {
 	if len(items) == 0 {
 		return nil
@@ -311,9 +475,9 @@ func (q *redisQueue) PushBatch(items []*Item) error {
 		q.monitorCount(MetricRateLimited, len(items))
 		return ErrRateLimited
 	}
-	args := make([]interface{}, 0, len(items)*2)
+	execAts := make([]int64, len(items))
 	now := unix()
-	for _, it := range items {
+	for i, it := range items {
 		if err := q.prepareItemNoRate(it); err != nil {
 			return err
 		}
@@ -321,29 +485,66 @@ func (q *redisQueue) PushBatch(items []*Item) error {
 		if delay < 0 {
 			delay = 0
 		}
-		args = append(args, it.GetValue(), itemScore(now+delay, it.GetPriority()))
+		execAts[i] = now + delay
 	}
-	_, err := q.runScript(q.opCtx(), q.addScript, []string{q.delaySetKey}, args...)
-	return err
+	return q.addOrSpool(items, execAts)
 }
 
-// Length 返回 delay 集中等待执行的 item 数
-func (q *redisQueue) Length() int64 {
-	res, err := q.runScript(q.opCtx(), q.lengthScript, []string{q.delaySetKey, q.doingSetKey})
+// addOrSpool 写入 Redis；启用 SpoolSize 且缓冲非空或写入失败时转入本地缓冲。成功（含进入缓冲）后回调 OnPushed
+func (q *redisQueue) addOrSpool(items []*Item, execAts []int64) error {
+	var err error
+	if q.spool != nil && q.spool.len() > 0 {
+		err = q.spoolItems(items, execAts, nil)
+	} else if err = q.addItems(items, execAts); err != nil && isBackendUnavailable(err) {
+		err = q.spoolItems(items, execAts, err)
+	}
 	if err != nil {
-		q.log.Errorf("topic=%s length error: %v", q.topic, err)
-		return 0
+		return err
 	}
-	if len(res) == 0 {
-		return 0
+	q.notifyPushed(items...)
+	return nil
+}
+
+// addItems 按分片分组，每个分片一次 addScript 写入；execAts 为绝对执行时间戳
+func (q *redisQueue) addItems(items []*Item, execAts []int64) error {
+	args := make([][]interface{}, len(q.shards))
+	for i, it := range items {
+		idx := shardIndex(it.GetValue(), len(q.shards))
+		args[idx] = append(args[idx], it.GetValue(), itemScore(execAts[i], it.GetPriority()))
 	}
-	v, _ := res[0].(int64)
-	return v
+	for i, a := range args {
+		if len(a) == 0 {
+			continue
+		}
+		if _, err := q.runScript(q.opCtx(), q.addScript, []string{q.shards[i].delaySetKey, q.shards[i].seqHashKey}, a...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Length 返回 delay 集中等待执行的 item 数（所有分片之和）
+func (q *redisQueue) Length() int64 {
+	var total int64
+	for _, sh := range q.shards {
+		res, err := q.runScript(q.opCtx(), q.lengthScript, []string{sh.delaySetKey, sh.doingSetKey})
+		if err != nil {
+			q.log.Errorf("topic=%s length error: %v", q.topic, err)
+			continue
+		}
+		if len(res) == 0 {
+			continue
+		}
+		v, _ := res[0].(int64)
+		total += v
+	}
+	return total
 }
 
 // Get 查询 value 是否存在于队列中（delay 或 doing），返回剩余延迟（doing 中返回 0）
 func (q *redisQueue) Get(value []byte) (remaining time.Duration, exists bool, err error) {
-	res, err := q.runScript(q.opCtx(), q.getScript, []string{q.delaySetKey, q.doingSetKey}, value)
+	sh := q.shardOf(value)
+	res, err := q.runScript(q.opCtx(), q.getScript, []string{sh.delaySetKey, sh.doingSetKey}, value)
 	if err != nil {
 		return 0, false, err
 	}
@@ -368,8 +569,9 @@ func (q *redisQueue) Get(value []byte) (remaining time.Duration, exists bool, er
 
 // Cancel 从 delay/doing 集与 failed Hash 中移除 value，返回是否移除成功
 func (q *redisQueue) Cancel(value []byte) (bool, error) {
+	sh := q.shardOf(value)
 	res, err := q.runScript(q.opCtx(), q.cancelScript,
-		[]string{q.delaySetKey, q.doingSetKey, q.failedHashKey},
+		q.withOwnedSetKeys(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey),
 		value)
 	if err != nil {
 		return false, err
@@ -380,7 +582,21 @@ func (q *redisQueue) Cancel(value []byte) (bool, error) {
 	return parseInt64(res[0]) > 0, nil
 }
 
-func (q *redisQueue) Close() error { return q.close() }
+// Close 关闭队列；启用 SpoolSize 时尽力补写本地缓冲中剩余的 item（未 Start 的只生产队列同样适用）；
+// 启用 ConsumerID 时同时把自身租约置为过期，让其他实例的 reclaim 立即接手本实例尚未 ack 的 item。
+func (q *redisQueue) Close() error {
+	err := q.close()
+	if q.spool != nil {
+		q.closeSpool()
+	}
+	if err != nil {
+		return err
+	}
+	if q.consumerID != "" {
+		q.releaseLease()
+	}
+	return nil
+}
 
 // Drain 进入 drain 状态：拒绝新 Push，等待所有现有 item 处理完毕。
 // 等待条件：delay 集 + doing 集 + inFlight 全部为 0。
@@ -388,142 +604,255 @@ func (q *redisQueue) Drain(ctx context.Context) error {
 	return q.drain(ctx, q.lengthAll)
 }
 
-// lengthAll 返回 delay 集 + doing 集长度之和（用于 Drain 判定）
+// lengthAll 返回所有分片 delay 集 + doing 集长度与本地缓冲深度之和（用于 Drain 判定）
 func (q *redisQueue) lengthAll() int64 {
-	res, err := q.runScript(q.opCtx(), q.lengthScript, []string{q.delaySetKey, q.doingSetKey})
-	if err != nil || len(res) < 2 {
-		return 0
+	var total int64
+	if q.spool != nil {
+		total += int64(q.spool.len())
+	}
+	for _, sh := range q.shards {
+		res, err := q.runScript(q.opCtx(), q.lengthScript, []string{sh.delaySetKey, sh.doingSetKey})
+		if err != nil || len(res) < 2 {
+			continue
+		}
+		d, _ := res[0].(int64)
+		dn, _ := res[1].(int64)
+		total += d + dn
 	}
-	d, _ := res[0].(int64)
-	dn, _ := res[1].(int64)
-	return d + dn
+	return total
 }
 
 // pollInterval 返回 poll 轮询间隔；<=0 时回退到 1s
 func (q *redisQueue) pollInterval() time.Duration {
-	if d := q.opts.GetPollInterval(); d > 0 {
-		return d
-	}
-	return 1 * time.Second
+	return pollIntervalFor(q.opts)
 }
 
 // reclaimInterval 返回 reclaim 轮询间隔；<=0 时回退到 1s
 func (q *redisQueue) reclaimInterval() time.Duration {
-	if d := q.opts.GetReclaimInterval(); d > 0 {
-		return d
+	return reclaimIntervalFor(q.opts)
+}
+
+// tickers 返回 Redis 队列的后台任务：poll、reclaim，启用 ConsumerID 时追加租约续约，
+// 启用 SpoolSize 时追加本地缓冲补写（与 poll 同间隔），启用 WorkerPool 时追加共享心跳
+func (q *redisQueue) tickers() []ticker {
+	ts := []ticker{
+		{d: q.pollInterval(), f: q.poll},
+		{d: q.reclaimInterval(), f: q.reclaim},
+	}
+	if q.consumerID != "" {
+		ts = append(ts, ticker{d: q.leaseRenewInterval(), f: q.renewLease})
 	}
-	return 1 * time.Second
+	if q.spool != nil {
+		ts = append(ts, ticker{d: q.pollInterval(), f: q.flushSpool})
+	}
+	if d := q.heartbeatInterval(); d > 0 && q.poolSize > 0 {
+		ts = append(ts, ticker{d: d, f: q.heartbeatAll})
+	}
+	return ts
 }
 
 func (q *redisQueue) Start(f func(item *Item) error) error {
-	return q.start(f,
-		ticker{d: q.pollInterval(), f: q.poll},
-		ticker{d: q.reclaimInterval(), f: q.reclaim})
+	return q.start(f, q.tickers()...)
 }
 
 // StartManualAck 启动手动 ack 模式
 func (q *redisQueue) StartManualAck(f func(item *Item, ack Acker)) error {
 	q.manualHandler = f
-	return q.start(func(*Item) error { return nil },
-		ticker{d: q.pollInterval(), f: q.poll},
-		ticker{d: q.reclaimInterval(), f: q.reclaim})
+	return q.start(func(*Item) error { return nil }, q.tickers()...)
 }
 
+// runScript 执行 Lua 脚本，NOSCRIPT 时回退到 Eval。
+// 启用熔断时，熔断打开期间直接返回 ErrBackendUnavailable，不访问 Redis。
 func (q *redisQueue) runScript(ctx context.Context, s RedisScript, keys []string, args ...interface{}) ([]interface{}, error) {
+	var gen uint64
+	if q.breaker != nil {
+		var ok, changed bool
+		var to breakerState
+		gen, ok, to, changed = q.breaker.allow()
+		if changed {
+			q.breakerChanged(to)
+		}
+		if !ok {
+			return nil, ErrBackendUnavailable
+		}
+	}
+	start := time.Now()
 	ret, err := s.EvalSha(ctx, keys, args...)
 	if err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ") {
 		ret, err = s.Eval(ctx, keys, args...)
 	}
+	q.observeScript(s, time.Since(start))
+	if q.breaker != nil {
+		if to, changed := q.breaker.done(gen, isBackendFailure(err)); changed {
+			q.breakerChanged(to)
+		}
+	}
 	return ret, err
 }
 
+// namedScript 带名称的 RedisScript，名称用作脚本耗时指标的 script 标签
+type namedScript struct {
+	RedisScript
+	name string
+}
+
+func buildScript(builder RedisScriptBuilder, name, src string) RedisScript {
+	return namedScript{RedisScript: builder.Build(src), name: name}
+}
+
+// observeScript 上报一次 Redis 脚本耗时
+func (q *redisQueue) observeScript(s RedisScript, d time.Duration) {
+	monitorObserve(MetricRedisScriptMs, q.topic, q.opts, d.Milliseconds())
+	if m := q.metrics.Load(); m != nil {
+		name := "unknown"
+		if ns, ok := s.(namedScript); ok {
+			name = ns.name
+		}
+		m.observeScript(q.topic, name, d)
+	}
+}
+
 // move 把 source 中 score<=maxScore 的项搬到 target，target 的 score 设为 toScore
-func (q *redisQueue) move(from, to string, maxScore, toScore int64) ([]interface{}, error) {
-	return q.runScript(q.opCtx(), q.moveScript, []string{from, to}, maxScore, toScore)
+func (q *redisQueue) move(keys []string, maxScore, toScore int64) ([]interface{}, error) {
+	return q.runScript(q.opCtx(), q.moveScript, keys, maxScore, toScore)
 }
 
-// poll 把 delay 集中到期的 item 搬到 doing 集，doing 集 score 设为 now+VisibilityTimeout，
-// 然后批量派发给业务 handler
+// poll 依次处理每个分片：把 delay 集中到期的 item 搬到 doing 集，
+// doing 集 score 设为 now+VisibilityTimeout，然后批量派发给业务 handler。
+// 单个分片失败不影响其他分片，返回第一个错误用于 ticker 退避。
 func (q *redisQueue) poll() error {
+	var firstErr error
+	for _, sh := range q.shards {
+		if err := q.pollShard(sh); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (q *redisQueue) pollShard(sh *redisShard) error {
 	now := unix()
 	visTimeout := int64(q.opts.GetVisibilityTimeout() / time.Second)
 	if visTimeout <= 0 {
 		visTimeout = 1
 	}
-	res, err := q.move(q.delaySetKey, q.doingSetKey, now, now+visTimeout)
+	items, scores, err := q.claimShard(sh, now, now+visTimeout)
 	if err != nil {
-		q.monitorCount(MetricPollError)
 		return err
 	}
-	// 收集 values 用于批量查询失败计数
-	type pending struct {
-		item  *Item
-		value string
+	if len(items) > 0 {
+		q.monitorObserve(MetricPollBatchSize, int64(len(items)))
+		// score 为计划执行秒数减去 priority*1e-6 秒，偏移可达毫秒级以上，四舍五入到秒去掉偏移
+		dispatchAt := nowFunc()
+		for _, score := range scores {
+			q.observeLateness(dispatchAt, time.Unix(scoreToExecTs(score), 0))
+		}
 	}
-	var pendings []pending
-	for i := 0; i+1 < len(res); i += 2 {
+	q.execute(items...)
+	return nil
+}
+
+// claimShard 执行 pollScript：把分片 delay 集中 score <= maxScore 的 item 搬到 doing 集（score=toScore），
+// 已达重试上限的 item 由服务端移入死信并在此回调 OnDeadLetter。
+// 返回认领到的 item 及其原始 score，item.DelaySecond 以负值编码已失败次数。
+func (q *redisQueue) claimShard(sh *redisShard, maxScore, toScore int64) ([]*Item, []float64, error) {
+	// RetryTimes 语义（与 memq 完全一致）：表示允许的"额外"重试次数（不含首次执行）。
+	// 总执行 = 1 + RetryTimes 次（RetryTimes>=0 时）。
+	//   >0 : 当历史失败次数已经超过 RetryTimes 时，此次不再派发，直接死信
+	//   ==0: 历史失败次数 > 0 即死信（不重试）
+	//   <0 : 永不进入死信（无限重试）
+	rt := q.opts.GetRetryTimes()
+	if rt < 0 {
+		rt = -1
+	}
+	res, err := q.runScript(q.opCtx(), q.pollScript,
+		q.withOwnSetKey(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.deadSetKey, sh.seqHashKey),
+		maxScore, toScore, rt, q.consumerID, q.deadLetterRetentionSec())
+	if err != nil {
+		q.monitorCount(MetricPollError)
+		return nil, nil, err
+	}
+	var items []*Item
+	var scores []float64
+	for i := 0; i+3 < len(res); i += 4 {
 		val, ok := res[i].(string)
 		if !ok {
 			continue
 		}
-		pendings = append(pendings, pending{
-			item:  &Item{Value: []byte(val)},
-			value: val,
-		})
-	}
-	if len(pendings) == 0 {
-		return nil
-	}
-	// 查失败计数
-	values := make([]interface{}, len(pendings))
-	for i, p := range pendings {
-		values[i] = p.value
-	}
-	counts, cerr := q.runScript(q.opCtx(), q.failedCountScript, []string{q.failedHashKey}, values...)
-	if cerr != nil {
-		q.log.Errorf("topic=%s failed count query error: %v", q.topic, cerr)
-		// 即使查询失败也要派发，按 0 失败计数处理
-		counts = make([]interface{}, len(pendings))
-	}
-	for i, p := range pendings {
-		var failed int64
-		if i < len(counts) {
-			failed = parseInt64(counts[i])
-		}
+		item := &Item{Value: []byte(val)}
 		// item.DelaySecond 编码失败次数（负值），便于 onFailed 正确累加
-		if failed > 0 {
-			p.item.DelaySecond = -failed
+		if failed := parseInt64(res[i+2]); failed > 0 {
+			item.DelaySecond = -failed
 		}
-		// 已达重试上限，直接死信
-		// RetryTimes 语义（与 memq 完全一致）：表示允许的"额外"重试次数（不含首次执行）。
-		// 总执行 = 1 + RetryTimes 次（RetryTimes>=0 时）。
-		//   >0 : 当历史失败次数已经超过 RetryTimes 时，此次不再派发，直接死信
-		//   ==0: 历史失败次数 > 0 即死信（不重试）
-		//   <0 : 永不进入死信（无限重试）
-		if rt := q.opts.GetRetryTimes(); rt >= 0 && int(failed) > rt {
-			q.invokeDeadLetter(p.item)
-			if aerr := q.onSuccess(p.item); aerr != nil {
-				q.log.Errorf("topic=%s ack dead letter error: %v", q.topic, aerr)
-			}
+		// 已达重试上限：服务端已从 delay 集移除并写入 dead 集，这里只负责回调
+		if parseInt64(res[i+3]) == 1 {
+			q.invokeDeadLetter(item)
 			continue
 		}
-		q.execute(p.item)
+		items = append(items, item)
+		scores = append(scores, parseFloat64(res[i+1]))
 	}
-	return nil
+	return items, scores, nil
+}
+
+// deadLetterRetentionSec 返回 dead 集保留秒数；<=0 表示不写入 dead 集
+func (q *redisQueue) deadLetterRetentionSec() int64 {
+	d := q.opts.GetDeadLetterRetention()
+	if d <= 0 {
+		return 0
+	}
+	if sec := int64(d / time.Second); sec > 0 {
+		return sec
+	}
+	return 1
 }
 
-// reclaim 把 doing 集中已过 visibility 的 item 搬回 delay 集（重新等待 poll）
+// reclaim 依次处理每个分片：把 doing 集中已过 visibility 的 item 搬回 delay 集（重新等待 poll）。
+// 启用 ConsumerID 时先把租约已过期的消费者持有的 item 立即搬回，无需等待 visibility 超时。
 func (q *redisQueue) reclaim() error {
+	var firstErr error
+	for _, sh := range q.shards {
+		if err := q.reclaimShard(sh); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (q *redisQueue) reclaimShard(sh *redisShard) error {
 	now := unix()
-	items, err := q.move(q.doingSetKey, q.delaySetKey, now, now)
+	var leaseErr error
+	if q.consumerID != "" {
+		leaseErr = q.reclaimExpiredConsumers(sh, now)
+	}
+	items, err := q.move(q.withOwnedSetKeys(sh, sh.doingSetKey, sh.delaySetKey, sh.ownerHashKey), now, now)
 	if err != nil {
 		q.monitorCount(MetricReclaimError)
 	} else {
 		q.monitorCount(MetricReclaim, len(items)/2)
+		q.notifyReclaimed(q.reclaimedValues(items, 2))
+	}
+	if err == nil {
+		err = leaseErr
 	}
 	return err
 }
 
+// reclaimedValues 从脚本返回中按 step 间隔取出 value：move 返回 [value, score, ...]（step=2），
+// leaseReclaim 返回 [value, ...]（step=1）；OnReclaimed 与历史均未配置时返回 nil
+func (q *redisQueue) reclaimedValues(res []interface{}, step int) [][]byte {
+	if q.opts.GetOnReclaimed() == nil && q.history == nil {
+		return nil
+	}
+	var values [][]byte
+	for i := 0; i < len(res); i += step {
+		if v, ok := res[i].(string); ok {
+			values = append(values, []byte(v))
+		}
+	}
+	return values
+}
+
 // onFailed 业务处理失败：从 doing 删除，重新加入 delay，并累加失败计数
 // 重试间隔由 computeRetryDelay 决定
 func (q *redisQueue) onFailed(item *Item) error {
@@ -538,16 +867,21 @@ func (q *redisQueue) onFailed(item *Item) error {
 		delaySec = 0
 	}
 	nextScore := itemScore(unix()+delaySec, item.GetPriority())
-	_, err := q.runScript(q.opCtx(), q.ackFailedScript,
-		[]string{q.delaySetKey, q.doingSetKey, q.failedHashKey},
-		item.GetValue(), nextScore)
-	return err
+	sh := q.shardOf(item.GetValue())
+	if _, err := q.runScript(q.opCtx(), q.ackFailedScript,
+		q.withOwnSetKey(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey),
+		item.GetValue(), nextScore); err != nil {
+		return err
+	}
+	q.notifyRetryScheduled(item, time.Duration(delaySec)*time.Second)
+	return nil
 }
 
 // onSuccess 业务处理成功：清除 doing 与失败计数
 func (q *redisQueue) onSuccess(item *Item) error {
+	sh := q.shardOf(item.GetValue())
 	_, err := q.runScript(q.opCtx(), q.ackSuccessScript,
-		[]string{q.delaySetKey, q.doingSetKey, q.failedHashKey},
+		q.withOwnSetKey(sh, sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.seqHashKey),
 		item.GetValue())
 	return err
 }
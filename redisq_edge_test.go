@@ -114,11 +114,13 @@ func TestRedisQueue_Poll_Error(t *testing.T) {
 	b := &fakeScriptBuilder{}
 	tp := NewRedisTopicQueue(context.Background(), "poll-err", WithRedisScriptBuilder(b))
 	rq := tp.(*redisQueue)
-	// moveScript 两路径都返回错误
-	b.scripts[0].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return nil, fmt.Errorf("network")
+	// pollScript / moveScript 两路径都返回错误
+	for _, idx := range []int{idxMove, idxPoll} {
+		b.scripts[idx].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+			return nil, fmt.Errorf("network")
+		}
+		b.scripts[idx].evalFn = b.scripts[idx].evalShaFn
 	}
-	b.scripts[0].evalFn = b.scripts[0].evalShaFn
 
 	if err := rq.poll(); err == nil {
 		t.Fatal("want error")
@@ -135,19 +137,22 @@ func TestRedisQueue_Poll_MalformedResponse(t *testing.T) {
 	rq := tp.(*redisQueue)
 
 	var pollInvoked int32
-	// move 只在第一次调用返回带坏数据的响应；后续返回空，防止 ticker 多次放大
-	b.scripts[0].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		if atomic.AddInt32(&pollInvoked, 1) == 1 {
-			return []interface{}{123, "0", "hello", "0"}, nil
-		}
-		return []interface{}{}, nil
-	}
 	// ack 等其他脚本 no-op
-	for i := 1; i < len(b.scripts); i++ {
+	for i := 0; i < len(b.scripts); i++ {
 		b.scripts[i].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
 			return []interface{}{true}, nil
 		}
 	}
+	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	// poll 只在第一次调用返回带坏数据的响应；后续返回空，防止 ticker 多次放大
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		if atomic.AddInt32(&pollInvoked, 1) == 1 {
+			return []interface{}{123, "0", int64(0), int64(0), "hello", "0", int64(0), int64(0)}, nil
+		}
+		return []interface{}{}, nil
+	}
 
 	var mu sync.Mutex
 	var got []string
@@ -184,12 +189,12 @@ func TestRedisQueue_Poll_MalformedResponse(t *testing.T) {
 
 // scriptIdx 脚本顺序与 newRedisTopicQueue 中 builder.Build 调用顺序保持一致
 const (
-	idxMove        = 0
-	idxAdd         = 1
-	idxLength      = 2
-	idxAckSuccess  = 3
-	idxAckFailed   = 4
-	idxFailedCount = 5
+	idxMove       = 0
+	idxAdd        = 1
+	idxLength     = 2
+	idxAckSuccess = 3
+	idxAckFailed  = 4
+	idxPoll       = 5
 )
 
 // stubAllScriptsOK 让所有脚本返回成功，避免空 stub 触发 NOSCRIPT
@@ -206,7 +211,7 @@ func stubAllScriptsOK(b *fakeScriptBuilder) {
 // TestRedisQueue_Poll_DeadLetterBranch 覆盖 poll 中失败计数已超过 RetryTimes 的死信分支
 //
 // RetryTimes=2 表示允许 2 次额外重试（共执行 3 次）。当历史失败次数 > 2（即 3 次）时，
-// 不再派发，直接进入死信。
+// 不再派发，pollScript 在服务端直接投递死信，客户端只回调 OnDeadLetter、不再额外 ack。
 func TestRedisQueue_Poll_DeadLetterBranch(t *testing.T) {
 	b := &fakeScriptBuilder{}
 	var deadCh = make(chan *Item, 1)
@@ -217,15 +222,13 @@ func TestRedisQueue_Poll_DeadLetterBranch(t *testing.T) {
 	)
 	rq := tp.(*redisQueue)
 
-	// moveScript 返回到期的 item
-	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return []interface{}{"bad", "0"}, nil
+	// pollScript 返回失败次数 3（> RetryTimes=2）且已在服务端投递死信的 item
+	var retryTimesArg int64
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		retryTimesArg = int64(args[2].(int))
+		return []interface{}{"bad", "0", int64(3), int64(1)}, nil
 	}
-	// failedCountScript 返回失败次数 3（> RetryTimes=2 触发死信）
-	b.scripts[idxFailedCount].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return []interface{}{int64(3)}, nil
-	}
-	// 其它脚本（包括 ackSuccess）返回成功
+	// 其它脚本返回成功
 	for _, idx := range []int{idxAdd, idxLength, idxAckSuccess, idxAckFailed} {
 		b.scripts[idx].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
 			return []interface{}{true}, nil
@@ -235,6 +238,12 @@ func TestRedisQueue_Poll_DeadLetterBranch(t *testing.T) {
 	if err := rq.poll(); err != nil {
 		t.Fatal(err)
 	}
+	if retryTimesArg != 2 {
+		t.Fatalf("poll should pass RetryTimes=2, got %d", retryTimesArg)
+	}
+	if c := b.scripts[idxAckSuccess].evalShaCalls; c != 0 {
+		t.Fatalf("dead letter should be handled server side, ackSuccess calls=%d", c)
+	}
 	select {
 	case it := <-deadCh:
 		if string(it.GetValue()) != "bad" {
@@ -257,12 +266,9 @@ func TestRedisQueue_Poll_FailedButUnderRetry(t *testing.T) {
 	)
 	rq := tp.(*redisQueue)
 
-	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return []interface{}{"retry-me", "0"}, nil
-	}
 	// failed count = 2, 仍小于 RetryTimes=10
-	b.scripts[idxFailedCount].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return []interface{}{int64(2)}, nil
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{"retry-me", "0", int64(2), int64(0)}, nil
 	}
 	for _, idx := range []int{idxAdd, idxLength, idxAckSuccess, idxAckFailed} {
 		b.scripts[idx].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
@@ -334,9 +340,11 @@ func TestRedisQueue_StartWithTwoTickers(t *testing.T) {
 	rq := tp.(*redisQueue)
 
 	var moveCalls int32
-	b.scripts[0].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		atomic.AddInt32(&moveCalls, 1)
-		return []interface{}{}, nil
+	for _, idx := range []int{idxMove, idxPoll} {
+		b.scripts[idx].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+			atomic.AddInt32(&moveCalls, 1)
+			return []interface{}{}, nil
+		}
 	}
 	if err := rq.Start(func(item *Item) error { return nil }); err != nil {
 		t.Fatal(err)
@@ -164,7 +164,7 @@ func TestIntegration_Redis_VisibilityReclaim(t *testing.T) {
 	// 直接放一个过期 item 到 doing 集，模拟"曾被 poll 但未 ack"
 	expiredScore := unix() - 10
 	if _, err := rq.runScript(context.Background(), rq.addScript,
-		[]string{rq.doingSetKey}, []byte("ghost"), expiredScore); err != nil {
+		[]string{rq.shards[0].doingSetKey, rq.shards[0].seqHashKey}, []byte("ghost"), expiredScore); err != nil {
 		t.Fatal(err)
 	}
 
@@ -221,6 +221,443 @@ func TestIntegration_Redis_PushBatch(t *testing.T) {
 	}
 }
 
+// TestIntegration_Redis_FIFOWithinPriority 同一秒同 priority 的 item 按入队顺序被 poll 认领，不受 value 字典序影响
+func TestIntegration_Redis_FIFOWithinPriority(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	values, priorities := fifoInput(30)
+	items := make([]*Item, len(values))
+	for i, v := range values {
+		items[i] = &Item{Value: []byte(v), Priority: priorities[i]}
+	}
+	// 单个分片一次 addScript 写入，execAt 相同
+	if err := rq.PushBatch(items); err != nil {
+		t.Fatal(err)
+	}
+	now := unix()
+	claimed, _, err := rq.claimShard(rq.shards[0], now+1, now+60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, it := range claimed {
+		got = append(got, string(it.GetValue()))
+	}
+	if want := fifoExpected(values, priorities); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("claim order\n got %v\nwant %v", got, want)
+	}
+}
+
+// TestIntegration_Redis_History 历史 LIST 按上限裁剪，ack 后过期时间缩短为 HistoryRetention
+func TestIntegration_Redis_History(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+		WithHistorySize(3),
+		WithHistoryRetention(time.Minute),
+	).(*redisQueue)
+	defer rq.Close()
+
+	item := &Item{Value: []byte("h1"), DelaySecond: 3600}
+	if err := rq.Push(item); err != nil {
+		t.Fatal(err)
+	}
+	rq.notifyDispatched(item)
+	rq.notifyFailed(item, fmt.Errorf("timeout"))
+	rq.notifyRetryScheduled(item, 2*time.Second)
+	events, err := rq.itemHistory(item.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Type != HistoryDispatched || events[1].Error != "timeout" || events[2].Delay != 2*time.Second {
+		t.Fatalf("unexpected history %+v", events)
+	}
+	rq.notifyAcked(item)
+	if events, err = rq.itemHistory(item.Value); err != nil || len(events) != 3 || events[2].Type != HistoryAcked {
+		t.Fatalf("unexpected history after ack %+v err=%v", events, err)
+	}
+}
+
+// TestIntegration_Redis_StatusDetail status 脚本统计已到期数、最早 score 与下一个未到期 score
+func TestIntegration_Redis_StatusDetail(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"late", now-30, "due", now, "future", now+60); err != nil {
+		t.Fatal(err)
+	}
+	d, err := rq.statusDetail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.overdue != 2 || d.doing != 0 || d.dead != 0 {
+		t.Fatalf("unexpected detail %+v", d)
+	}
+	if d.oldestDue.Unix() != now-30 || d.nextDue.Unix() != now+60 {
+		t.Fatalf("oldest=%v next=%v", d.oldestDue, d.nextDue)
+	}
+}
+
+// TestIntegration_Redis_Forecast forecast 脚本逐区间 ZCOUNT，区间互不重叠，不含已到期成员
+func TestIntegration_Redis_Forecast(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"due", now-1, "soon", now+30, "later", now+1800); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := rq.forecast([]time.Duration{time.Minute, time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 1 {
+		t.Fatalf("unexpected forecast %v", counts)
+	}
+}
+
+// TestIntegration_Redis_ConsumerOwnership 持有集随 poll/cancel/lease reclaim 维护，consumers 与 leaseReclaim 只读持有集
+func TestIntegration_Redis_ConsumerOwnership(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+		WithConsumerID("pod-a"),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"o1", now-1, "o2", now-1, "o3", now-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.renewLease(); err != nil {
+		t.Fatal(err)
+	}
+	items, _, err := rq.claimShard(sh, now, now+60)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("claim items=%d err=%v", len(items), err)
+	}
+	if cs := rq.consumerInFlight(); cs["pod-a"] != 3 {
+		t.Fatalf("want 3 owned got %v", cs)
+	}
+	if _, err = rq.Cancel([]byte("o1")); err != nil {
+		t.Fatal(err)
+	}
+	if cs := rq.consumerInFlight(); cs["pod-a"] != 2 {
+		t.Fatalf("cancel should release ownership, got %v", cs)
+	}
+
+	rq.releaseLease()
+	res, err := rq.runScript(context.Background(), rq.leaseReclaimScript,
+		[]string{sh.doingSetKey, sh.delaySetKey, sh.ownerHashKey, sh.consumerSetKey, sh.ownedSetKey("pod-a")}, unix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(toStrings(res)); got != "[o2 o3]" && got != "[o3 o2]" {
+		t.Fatalf("unexpected reclaimed %v", got)
+	}
+	if l := rq.Length(); l != 2 {
+		t.Fatalf("reclaimed items should be back in delay, len=%d", l)
+	}
+	if err = rq.renewLease(); err != nil {
+		t.Fatal(err)
+	}
+	if cs := rq.consumerInFlight(); cs["pod-a"] != 0 {
+		t.Fatalf("lease reclaim should drop the owned set, got %v", cs)
+	}
+}
+
+// TestIntegration_Redis_ReclaimReleasesOwner visibility reclaim 搬回 delay 集时清除归属
+func TestIntegration_Redis_ReclaimReleasesOwner(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+		WithConsumerID("pod-b"),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"r1", now-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.renewLease(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rq.claimShard(sh, now, now-1); err != nil {
+		t.Fatal(err)
+	}
+	if cs := rq.consumerInFlight(); cs["pod-b"] != 1 {
+		t.Fatalf("want 1 owned got %v", cs)
+	}
+	if err := rq.reclaimShard(sh); err != nil {
+		t.Fatal(err)
+	}
+	if cs := rq.consumerInFlight(); cs["pod-b"] != 0 {
+		t.Fatalf("reclaim should release ownership, got %v", cs)
+	}
+}
+
+// TestIntegration_Redis_ReclaimKeepsExecuteTime reclaim 把 delay 集 score 改写为 now 后，
+// poll 与 export 仍返回入队时记录的计划执行 score，ack 后清除该记录
+func TestIntegration_Redis_ReclaimKeepsExecuteTime(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	orig := itemScore(now-100, 5)
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"k1", orig); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rq.claimShard(sh, now, now-1); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.reclaimShard(sh); err != nil {
+		t.Fatal(err)
+	}
+	var recs []*ExportRecord
+	if err := rq.exportRecords(func(rec *ExportRecord) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 1 || recs[0].ExecuteAt != (now-100)*1000 || recs[0].Priority != 5 {
+		t.Fatalf("export should keep original execute time and priority, got %+v", recs)
+	}
+	items, scores, err := rq.claimShard(sh, now, now+60)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("want reclaimed item polled again, items=%v err=%v", items, err)
+	}
+	if scores[0] != orig {
+		t.Fatalf("want original score %v got %v", orig, scores[0])
+	}
+	if err = rq.onSuccess(items[0]); err != nil {
+		t.Fatal(err)
+	}
+	res := rawScript(t, "return {redis.call('HEXISTS', KEYS[1], 'e:' .. ARGV[1])}", []string{sh.seqHashKey}, "k1")
+	if parseInt64(res[0]) != 0 {
+		t.Fatal("ack should clear the recorded execute score")
+	}
+}
+
+// rawScript 直接执行一段 Lua，用于读写脚本维护的内部 key
+func rawScript(t *testing.T, src string, keys []string, args ...interface{}) []interface{} {
+	t.Helper()
+	res, err := realRedisBuilder(t).Build(src).Eval(context.Background(), keys, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// seqFieldExists 返回 value 在 seq hash 中是否仍有 'v:' 序号字段
+func seqFieldExists(t *testing.T, sh *redisShard, value string) bool {
+	t.Helper()
+	res := rawScript(t, "return {redis.call('HEXISTS', KEYS[1], 'v:' .. ARGV[1])}", []string{sh.seqHashKey}, value)
+	return parseInt64(res[0]) == 1
+}
+
+// TestIntegration_Redis_CancelBatch cancelBatch 脚本返回实际删除数，并清除 'v:' 序号字段
+func TestIntegration_Redis_CancelBatch(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"a", now+60, "b", now+60, "c", now+60); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rq.cancelBatch([][]byte{[]byte("a"), []byte("b"), []byte("missing")})
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 canceled got %d err=%v", n, err)
+	}
+	if l := rq.Length(); l != 1 {
+		t.Fatalf("want 1 left got %d", l)
+	}
+	if seqFieldExists(t, sh, "a") || seqFieldExists(t, sh, "b") || !seqFieldExists(t, sh, "c") {
+		t.Fatal("cancelBatch should only drop the seq fields of canceled values")
+	}
+}
+
+// TestIntegration_Redis_CancelByPrefixGlobEscape 前缀中的 glob 特殊字符被转义，ZSCAN MATCH 按字面匹配
+func TestIntegration_Redis_CancelByPrefixGlobEscape(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	// 未转义时 MATCH "a[b]*?*" 会匹配 "ab..." 而漏掉字面前缀为 "a[b]*?" 的 value
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"a[b]*?1", now+60, "a[b]*?2", now-1, "ab3", now+60, `a\[b]*?4`, now+60); err != nil {
+		t.Fatal(err)
+	}
+	// 一个放进 doing 集，覆盖对 doing 集的扫描
+	if _, _, err := rq.claimShard(sh, now, now+60); err != nil {
+		t.Fatal(err)
+	}
+	n, err := rq.cancelByPrefix([]byte("a[b]*?"))
+	if err != nil || n != 2 {
+		t.Fatalf("want 2 canceled got %d err=%v", n, err)
+	}
+	for _, v := range []string{"ab3", `a\[b]*?4`} {
+		if _, exists, err := rq.Get([]byte(v)); err != nil || !exists {
+			t.Fatalf("%s should be kept, exists=%v err=%v", v, exists, err)
+		}
+	}
+	if seqFieldExists(t, sh, "a[b]*?1") || !seqFieldExists(t, sh, "ab3") {
+		t.Fatal("cancelPrefix should only drop the seq fields of canceled values")
+	}
+}
+
+// TestIntegration_Redis_Purge purge 返回 delay 与 doing 集的 item 数，删除 seq hash 与已登记消费者的持有集，保留 dead 集
+func TestIntegration_Redis_Purge(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+		WithConsumerID("pod-p"),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"p1", now-1, "p2", now+60, "p3", now+60); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.renewLease(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rq.claimShard(sh, now, now+60); err != nil {
+		t.Fatal(err)
+	}
+	rawScript(t, "return {redis.call('ZADD', KEYS[1], ARGV[1], 'gone')}", []string{sh.deadSetKey}, now)
+	n, err := rq.purge()
+	if err != nil || n != 3 {
+		t.Fatalf("want 3 purged got %d err=%v", n, err)
+	}
+	res := rawScript(t, "return {redis.call('EXISTS', KEYS[1], KEYS[2], KEYS[3], KEYS[4]), redis.call('ZCARD', KEYS[5])}",
+		[]string{sh.delaySetKey, sh.doingSetKey, sh.seqHashKey, sh.ownedSetKey("pod-p"), sh.deadSetKey})
+	if parseInt64(res[0]) != 0 || parseInt64(res[1]) != 1 {
+		t.Fatalf("purge should delete delay/doing/seq/owned and keep dead, got %v", res)
+	}
+}
+
+// TestIntegration_Redis_PollDeadLetterSet 重试耗尽的 item 由 poll 写入 dead 集，超过保留时长的旧死信被裁剪
+func TestIntegration_Redis_PollDeadLetterSet(t *testing.T) {
+	topic := uniqueTopic(t)
+	var dead int32
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+		WithRetryTimes(0),
+		WithDeadLetterRetention(time.Minute),
+		WithOnDeadLetter(func(*Item) { atomic.AddInt32(&dead, 1) }),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"d1", now-1, "ok", now-1); err != nil {
+		t.Fatal(err)
+	}
+	rawScript(t, "redis.call('HSET', KEYS[1], 'd1', 1); redis.call('ZADD', KEYS[2], ARGV[1], 'old'); return {true}",
+		[]string{sh.failedHashKey, sh.deadSetKey}, now-120)
+	items, _, err := rq.claimShard(sh, now, now+60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || string(items[0].Value) != "ok" || atomic.LoadInt32(&dead) != 1 {
+		t.Fatalf("want ok dispatched and d1 dead, got %d items dead=%d", len(items), atomic.LoadInt32(&dead))
+	}
+	res := rawScript(t, "return {redis.call('ZSCORE', KEYS[1], 'd1') or '', redis.call('ZSCORE', KEYS[1], 'old') or '', redis.call('HEXISTS', KEYS[2], 'd1')}",
+		[]string{sh.deadSetKey, sh.failedHashKey})
+	if ts := parseInt64(res[0]); ts != now {
+		t.Fatalf("d1 should be in dead set with score now, got %v", res[0])
+	}
+	if res[1] != "" || parseInt64(res[2]) != 0 {
+		t.Fatalf("old dead letter should be trimmed and failed count cleared, got %v", res)
+	}
+	if seqFieldExists(t, sh, "d1") {
+		t.Fatal("poll should drop the seq field of claimed values")
+	}
+	page, err := rq.peek(PeekOptions{State: ItemStateDead}.normalize())
+	if err != nil || len(page.Items) != 1 || string(page.Items[0].Item.Value) != "d1" {
+		t.Fatalf("peek dead %+v err=%v", page, err)
+	}
+}
+
+// TestIntegration_Redis_Peek peek 脚本按时间区间分页，返回失败计数与优先级
+func TestIntegration_Redis_Peek(t *testing.T) {
+	topic := uniqueTopic(t)
+	rq := NewRedisTopicQueue(context.Background(), topic,
+		WithRedisScriptBuilder(realRedisBuilder(t)),
+		WithLogger(NopLogger()),
+	).(*redisQueue)
+	defer rq.Close()
+
+	sh := rq.shards[0]
+	now := unix()
+	if _, err := rq.runScript(context.Background(), rq.addScript, []string{sh.delaySetKey, sh.seqHashKey},
+		"k1", now+10, "k2", itemScore(now+20, 5), "k3", now+30, "k4", now+3600); err != nil {
+		t.Fatal(err)
+	}
+	rawScript(t, "return {redis.call('HSET', KEYS[1], 'k2', 2)}", []string{sh.failedHashKey})
+	opts := PeekOptions{From: time.Unix(now+10, 0), To: time.Unix(now+30, 0), Limit: 2}.normalize()
+	page, err := rq.peek(opts)
+	if err != nil || len(page.Items) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page %+v err=%v", page, err)
+	}
+	k2 := page.Items[1]
+	if string(k2.Item.Value) != "k2" || k2.Attempts != 2 || k2.Item.Priority != 5 || k2.ScheduledAt.Unix() != now+20 {
+		t.Fatalf("unexpected k2 %+v item=%+v", k2, k2.Item)
+	}
+	opts.Cursor = page.NextCursor
+	if page, err = rq.peek(opts); err != nil || len(page.Items) != 1 || string(page.Items[0].Item.Value) != "k3" || page.NextCursor != "" {
+		t.Fatalf("second page %+v err=%v", page, err)
+	}
+}
+
 // TestIntegration_Redis_Cancel 取消未到期的 item
 func TestIntegration_Redis_Cancel(t *testing.T) {
 	topic := uniqueTopic(t)
@@ -23,7 +23,7 @@ func TestRedisQueue_VisibilityTimeout_Used(t *testing.T) {
 		args  []interface{}
 		count int
 	}
-	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
 		captured.mu.Lock()
 		captured.args = args
 		captured.count++
@@ -36,7 +36,7 @@ func TestRedisQueue_VisibilityTimeout_Used(t *testing.T) {
 	}
 	captured.mu.Lock()
 	defer captured.mu.Unlock()
-	if captured.count != 1 || len(captured.args) != 2 {
+	if captured.count != 1 || len(captured.args) != 5 {
 		t.Fatalf("unexpected captured args: %+v", captured.args)
 	}
 	now := captured.args[0].(int64)
@@ -109,45 +109,64 @@ func TestRedisQueue_OnFailed_BackoffByFailedCount(t *testing.T) {
 	}
 }
 
-// TestRedisQueue_FailedCountQueryError_Tolerated 失败计数查询出错时仍按 0 派发
-func TestRedisQueue_FailedCountQueryError_Tolerated(t *testing.T) {
+// TestRedisQueue_Poll_SingleRoundTrip poll 只调用一次 pollScript，失败计数随结果一并返回
+func TestRedisQueue_Poll_SingleRoundTrip(t *testing.T) {
 	b := &fakeScriptBuilder{}
-	tp := NewRedisTopicQueue(context.Background(), "fc-err",
+	tp := NewRedisTopicQueue(context.Background(), "poll-one",
 		WithRedisScriptBuilder(b),
-		WithRetryTimes(5),
+		WithRetryTimes(-5),
+		WithDeadLetterRetention(time.Hour),
 	)
 	rq := tp.(*redisQueue)
 
 	stubAllScriptsOK(b)
-	// move 返回到期 item；failedCount 故意失败
-	b.scripts[idxMove].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return []interface{}{"v1", "0"}, nil
-	}
-	b.scripts[idxFailedCount].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
-		return nil, errBoom
+	var keys []string
+	var args []interface{}
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, k []string, a ...interface{}) ([]interface{}, error) {
+		keys, args = k, a
+		return []interface{}{"v1", "0", int64(2), int64(0), "v2", "0", int64(0), int64(0)}, nil
 	}
 
-	var handled int32
-	var wg sync.WaitGroup
-	wg.Add(1)
-	if err := rq.Start(func(item *Item) error {
-		if atomic.AddInt32(&handled, 1) == 1 {
-			wg.Done()
+	if err := rq.poll(); err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range b.scripts {
+		want := 0
+		if i == idxPoll {
+			want = 1
 		}
-		// 既然查询失败按 0 处理，DelaySecond 应为 0
-		if item.GetDelaySecond() != 0 {
-			t.Errorf("want DelaySecond=0 got=%d", item.GetDelaySecond())
+		if s.evalShaCalls != want {
+			t.Fatalf("script %d: want %d calls got %d", i, want, s.evalShaCalls)
 		}
-		return nil
-	}); err != nil {
-		t.Fatal(err)
 	}
-	defer rq.Close()
+	if len(keys) != 6 || keys[4] != "__dq:dead:{poll-one}" || keys[5] != "__dq:seq:{poll-one}" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	// RetryTimes<0 统一传 -1；未配置 ConsumerID 传空串；保留时长按秒
+	if args[2].(int) != -1 || args[3].(string) != "" || args[4].(int64) != 3600 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
 
+// TestRedisQueue_Poll_NoDeadLetterSet DeadLetterRetention<=0 时传 0，不写 dead 集
+func TestRedisQueue_Poll_NoDeadLetterSet(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "poll-nodead",
+		WithRedisScriptBuilder(b),
+		WithDeadLetterRetention(0),
+	)
+	rq := tp.(*redisQueue)
+	var retention int64 = -1
+	b.scripts[idxPoll].evalShaFn = func(ctx context.Context, k []string, a ...interface{}) ([]interface{}, error) {
+		retention = a[4].(int64)
+		return []interface{}{}, nil
+	}
 	if err := rq.poll(); err != nil {
 		t.Fatal(err)
 	}
-	waitGroupTimeout(t, &wg, 3*time.Second)
+	if retention != 0 {
+		t.Fatalf("want retention 0 got %d", retention)
+	}
 }
 
 // TestRedisQueue_PoolReclaimUsesNow 验证 reclaim 现在使用 now 作为 max_priority（不再依赖 visibility）
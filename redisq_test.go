@@ -166,7 +166,7 @@ func TestRedisQueue_Reclaim(t *testing.T) {
 	// 直接往 doing 集放一个 score 为过去时间的 item，模拟崩溃残留
 	// 借用 addScript 把 value 写入 doing 集（addScript 语义就是 ZADD）
 	expiredScore := unix() - 10
-	if _, err := rq.runScript(ctx, rq.addScript, []string{rq.doingSetKey}, []byte("recl"), expiredScore); err != nil {
+	if _, err := rq.runScript(ctx, rq.addScript, []string{rq.shards[0].doingSetKey, rq.shards[0].seqHashKey}, []byte("recl"), expiredScore); err != nil {
 		t.Fatal(err)
 	}
 
@@ -221,6 +221,81 @@ func TestMemq_SubSecondRetry(t *testing.T) {
 	}
 }
 
+// TestMemq_SubSecondRetryGetCancel 验证等待中的亚秒重试可被 Get 查到、被 Cancel 停止，且不再阻塞 Drain
+func TestMemq_SubSecondRetryGetCancel(t *testing.T) {
+	var calls int32
+	q := newMemoryTopicQueue(context.Background(), "subsec-cancel", newConfig(
+		WithLogger(NopLogger()), WithRetryTimes(3), WithRetryInterval(300*time.Millisecond),
+	)).(*memQueue)
+	if err := q.Start(func(*Item) error { atomic.AddInt32(&calls, 1); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.onFailed(&Item{Value: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	remain, ok, err := q.Get([]byte("x"))
+	if err != nil || !ok || remain <= 0 || remain > 300*time.Millisecond {
+		t.Fatalf("pending retry should be visible: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	canceled, err := q.Cancel([]byte("x"))
+	if err != nil || !canceled {
+		t.Fatalf("pending retry should be cancelable: canceled=%v err=%v", canceled, err)
+	}
+	if _, ok, _ = q.Get([]byte("x")); ok {
+		t.Fatal("canceled retry should not be visible")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err = q.Drain(ctx); err != nil {
+		t.Fatalf("drain should not wait for a canceled retry: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("canceled retry should not run, calls=%d", n)
+	}
+}
+
+// TestMemq_SubSecondRetryIndexCleared 验证亚秒重试派发后移出索引，前缀取消与 Purge 同样覆盖等待中的重试
+func TestMemq_SubSecondRetryIndexCleared(t *testing.T) {
+	done := make(chan struct{}, 1)
+	q := newMemoryTopicQueue(context.Background(), "subsec-index", newConfig(
+		WithLogger(NopLogger()), WithRetryTimes(3), WithRetryInterval(100*time.Millisecond),
+	)).(*memQueue)
+	if err := q.Start(func(*Item) error { done <- struct{}{}; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.onFailed(&Item{Value: []byte("fired")}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("retry did not fire")
+	}
+	waitUntil(t, 1000, func() bool {
+		_, ok, _ := q.Get([]byte("fired"))
+		return !ok
+	})
+
+	q.opts.RetryInterval = 900 * time.Millisecond
+	for _, v := range []string{"job:1", "job:2", "other"} {
+		if err := q.onFailed(&Item{Value: []byte(v)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := q.cancelByPrefix([]byte("job:")); err != nil || n != 2 {
+		t.Fatalf("prefix cancel: n=%d err=%v", n, err)
+	}
+	if n, _ := q.purge(); n != 1 {
+		t.Fatalf("purge should stop the remaining retry, n=%d", n)
+	}
+	if len(q.shards[0].retries) != 0 || q.pendingExec.Get() != 0 {
+		t.Fatalf("retries=%d pendingExec=%d", len(q.shards[0].retries), q.pendingExec.Get())
+	}
+}
+
 // errBoom 共享的失败 error
 var errBoom = simpleErr("boom")
 
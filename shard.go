@@ -0,0 +1,82 @@
+package delayq
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// redisShard 单个分片的一组 key。
+// 同一分片的 key 共享同一 hash tag，保证 Lua 脚本可在 Redis Cluster 中原子地操作它们。
+type redisShard struct {
+	delaySetKey   string
+	doingSetKey   string
+	failedHashKey string
+	// ownerHashKey 归属记录 value -> consumer；每个消费者另有持有集 ownedSetKey(consumer)
+	ownerHashKey   string
+	consumerSetKey string
+	deadSetKey     string
+	// seqHashKey 入队序号：字段 "v:<value>" 为 delay 集成员的序号，字段 "n" 为分片计数器；
+	// 字段 "e:<value>" 为 item 的计划执行 score，从入队保留到 ack/cancel/死信
+	seqHashKey string
+	// historyKeyPrefix item 历史 LIST 的 key 前缀，完整 key 为前缀 + value
+	historyKeyPrefix string
+}
+
+// newRedisShards 构造 topic 的分片 key 列表。
+// n<=1 时仅一个分片，hash tag 为 {<topic>}，与未分片时的 key 完全一致；
+// n>1 时第 i 个分片的 hash tag 为 {<topic>:<i>}，各分片可落在不同 slot。
+func newRedisShards(prefix, topic string, n int) []*redisShard {
+	if n <= 1 {
+		return []*redisShard{newRedisShard(prefix, topic)}
+	}
+	shards := make([]*redisShard, n)
+	for i := range shards {
+		shards[i] = newRedisShard(prefix, fmt.Sprintf("%s:%d", topic, i))
+	}
+	return shards
+}
+
+func newRedisShard(prefix, tag string) *redisShard {
+	s := &redisShard{
+		delaySetKey:      fmt.Sprintf("do:{%s}", tag),
+		doingSetKey:      fmt.Sprintf("doing:{%s}", tag),
+		failedHashKey:    fmt.Sprintf("failed:{%s}", tag),
+		ownerHashKey:     fmt.Sprintf("owner:{%s}", tag),
+		consumerSetKey:   fmt.Sprintf("consumers:{%s}", tag),
+		deadSetKey:       fmt.Sprintf("dead:{%s}", tag),
+		seqHashKey:       fmt.Sprintf("seq:{%s}", tag),
+		historyKeyPrefix: fmt.Sprintf("history:{%s}:", tag),
+	}
+	if len(prefix) > 0 {
+		s.delaySetKey = fmt.Sprintf("%s:%s", prefix, s.delaySetKey)
+		s.doingSetKey = fmt.Sprintf("%s:%s", prefix, s.doingSetKey)
+		s.failedHashKey = fmt.Sprintf("%s:%s", prefix, s.failedHashKey)
+		s.ownerHashKey = fmt.Sprintf("%s:%s", prefix, s.ownerHashKey)
+		s.consumerSetKey = fmt.Sprintf("%s:%s", prefix, s.consumerSetKey)
+		s.deadSetKey = fmt.Sprintf("%s:%s", prefix, s.deadSetKey)
+		s.seqHashKey = fmt.Sprintf("%s:%s", prefix, s.seqHashKey)
+		s.historyKeyPrefix = fmt.Sprintf("%s:%s", prefix, s.historyKeyPrefix)
+	}
+	return s
+}
+
+// shardIndex 按 value 的 FNV-1a 哈希计算分片下标；跨进程稳定，保证同一 value 总是路由到同一分片
+func shardIndex(value []byte, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(value)
+	return int(h.Sum32() % uint32(n))
+}
+
+// shardOf 返回 value 所在的分片
+func (q *redisQueue) shardOf(value []byte) *redisShard {
+	return q.shards[shardIndex(value, len(q.shards))]
+}
+
+// ownedSetKey 返回消费者在本分片的持有集 key：owner hash key + ":" + consumer。
+// 与 owner hash 共用 hash tag，脚本通过 KEYS 声明后访问，并按同样的拼接规则从 key 还原消费者名
+func (s *redisShard) ownedSetKey(consumer string) string {
+	return s.ownerHashKey + ":" + consumer
+}
@@ -0,0 +1,138 @@
+package delayq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestRedisShards_Keys 未分片时 key 与原格式一致；分片时 hash tag 带分片下标
+func TestRedisShards_Keys(t *testing.T) {
+	for _, n := range []int{-1, 0, 1} {
+		shards := newRedisShards("__dq", "orders", n)
+		if len(shards) != 1 {
+			t.Fatalf("n=%d want 1 shard got %d", n, len(shards))
+		}
+		if shards[0].delaySetKey != "__dq:do:{orders}" || shards[0].doingSetKey != "__dq:doing:{orders}" ||
+			shards[0].failedHashKey != "__dq:failed:{orders}" {
+			t.Fatalf("n=%d unexpected keys %+v", n, shards[0])
+		}
+	}
+	shards := newRedisShards("", "orders", 4)
+	if len(shards) != 4 {
+		t.Fatalf("want 4 shards got %d", len(shards))
+	}
+	for i, sh := range shards {
+		tag := fmt.Sprintf("{orders:%d}", i)
+		for _, k := range []string{sh.delaySetKey, sh.doingSetKey, sh.failedHashKey, sh.ownerHashKey, sh.consumerSetKey} {
+			if want := tag; len(k) < len(want) || k[len(k)-len(want):] != want {
+				t.Fatalf("shard %d key %q should end with %q", i, k, want)
+			}
+		}
+	}
+}
+
+// TestRedisShards_IndexStable 同一 value 总是路由到同一分片，且各分片都能被命中
+func TestRedisShards_IndexStable(t *testing.T) {
+	hit := make(map[int]int)
+	for i := 0; i < 1000; i++ {
+		v := []byte(fmt.Sprintf("v-%d", i))
+		idx := shardIndex(v, 8)
+		if idx < 0 || idx >= 8 {
+			t.Fatalf("index out of range: %d", idx)
+		}
+		if again := shardIndex(v, 8); again != idx {
+			t.Fatalf("unstable index for %s: %d vs %d", v, idx, again)
+		}
+		hit[idx]++
+	}
+	if len(hit) != 8 {
+		t.Fatalf("want all 8 shards hit, got %v", hit)
+	}
+	if shardIndex([]byte("x"), 1) != 0 || shardIndex([]byte("x"), 0) != 0 {
+		t.Fatal("single shard should always be 0")
+	}
+}
+
+// TestRedisShards_PushRoutesByValue Push/PushBatch 按 value 哈希写入对应分片
+func TestRedisShards_PushRoutesByValue(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "sharded",
+		WithRedisScriptBuilder(b),
+		WithRedisShards(4),
+	)
+	rq := tp.(*redisQueue)
+
+	var mu sync.Mutex
+	got := make(map[string][]string) // key -> values
+	b.scripts[idxAdd].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i < len(args); i += 2 {
+			got[keys[0]] = append(got[keys[0]], string(args[i].([]byte)))
+		}
+		return []interface{}{true}, nil
+	}
+	if err := rq.Push(&Item{Value: []byte("single")}); err != nil {
+		t.Fatal(err)
+	}
+	items := make([]*Item, 0, 32)
+	for i := 0; i < 32; i++ {
+		items = append(items, &Item{Value: []byte(fmt.Sprintf("b-%d", i))})
+	}
+	if err := rq.PushBatch(items); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	total := 0
+	for key, values := range got {
+		for _, v := range values {
+			if want := rq.shardOf([]byte(v)).delaySetKey; want != key {
+				t.Fatalf("value %s written to %s, want %s", v, key, want)
+			}
+		}
+		total += len(values)
+	}
+	if total != 33 {
+		t.Fatalf("want 33 values written got %d", total)
+	}
+	if len(got) < 2 {
+		t.Fatalf("batch should spread over shards, got %v", got)
+	}
+}
+
+// TestRedisShards_PollAndReclaimEveryShard poll/reclaim 逐个分片执行
+func TestRedisShards_PollAndReclaimEveryShard(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	tp := NewRedisTopicQueue(context.Background(), "sharded-poll",
+		WithRedisScriptBuilder(b),
+		WithRedisShards(3),
+	)
+	rq := tp.(*redisQueue)
+
+	var mu sync.Mutex
+	sources := make(map[string]int)
+	for _, idx := range []int{idxMove, idxPoll} {
+		b.scripts[idx].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+			mu.Lock()
+			sources[keys[0]]++
+			mu.Unlock()
+			return []interface{}{}, nil
+		}
+	}
+	if err := rq.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, sh := range rq.shards {
+		if sources[sh.delaySetKey] != 1 || sources[sh.doingSetKey] != 1 {
+			t.Fatalf("shard %s not polled/reclaimed exactly once: %v", sh.delaySetKey, sources)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package delayq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// spoolFlushBatch 每次补写从缓冲头部取出的最大 item 数
+const spoolFlushBatch = 256
+
+// spool Redis 不可用时的本地 Push 缓冲（FIFO，有界）。
+// 缓冲中 Item.DelaySecond 保存绝对执行时间戳，补写时换算回 score，保证停留在缓冲中的时间计入延迟。
+//
+// 配置 path 时每条记录以 uvarint 长度前缀 + Item protobuf 追加写入文件，构造时从文件恢复。
+// 补写成功后只把文件头部已补写的记录数写入 path+".head"，已补写记录多于剩余记录时才压缩重写文件，
+// 大量积压时补写的磁盘写入量与积压量成线性关系。
+type spool struct {
+	mu    sync.Mutex
+	items []*Item
+	size  int
+	path  string
+	// head 文件头部已补写、等待压缩时丢弃的记录数
+	head int
+
+	// flushMu 串行化补写，补写 ticker 与 flusher goroutine 不会重复提交同一批 item
+	flushMu sync.Mutex
+	// flusher 1 表示 flusher goroutine 正在运行
+	flusher atomicInt32
+	stopped atomicInt32
+	stopC   chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newSpool 构造本地缓冲；path 中的 {topic} 替换为 topic。加载文件失败时返回已加载部分及错误。
+func newSpool(topic string, size int, path string) (*spool, error) {
+	s := &spool{size: size, path: strings.ReplaceAll(path, "{topic}", topic), stopC: make(chan struct{})}
+	if s.path == "" {
+		return s, nil
+	}
+	return s, s.load()
+}
+
+// load 从文件恢复缓冲内容，跳过 head 文件记录的已补写记录；末尾不完整的记录（写入时进程崩溃）被丢弃
+func (s *spool) load() error {
+	if b, err := os.ReadFile(s.headPath()); err == nil {
+		if s.head, err = strconv.Atoi(strings.TrimSpace(string(b))); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	skipped := 0
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		buf := make([]byte, n)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if skipped < s.head {
+			skipped++
+			continue
+		}
+		item := &Item{}
+		if err = proto.Unmarshal(buf, item); err != nil {
+			return err
+		}
+		s.items = append(s.items, item)
+	}
+}
+
+// headPath 返回记录已补写记录数的文件路径
+func (s *spool) headPath() string {
+	return s.path + ".head"
+}
+
+// len 返回缓冲中的 item 数
+func (s *spool) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// add 把 items 整体追加到缓冲尾部；execAts 为对应的绝对执行时间戳。
+// 剩余容量不足以容纳整批时不写入任何 item，返回 ErrSpoolFull。
+func (s *spool) add(items []*Item, execAts []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items)+len(items) > s.size {
+		return ErrSpoolFull
+	}
+	spooled := make([]*Item, 0, len(items))
+	for i, it := range items {
+		spooled = append(spooled, &Item{
+			Topic:       it.GetTopic(),
+			DelaySecond: execAts[i],
+			Value:       append([]byte(nil), it.GetValue()...),
+			Priority:    it.GetPriority(),
+		})
+	}
+	if s.path != "" {
+		if err := s.appendFile(spooled); err != nil {
+			return err
+		}
+	}
+	s.items = append(s.items, spooled...)
+	return nil
+}
+
+// peek 返回缓冲头部至多 n 个 item（不移除）
+func (s *spool) peek(n int) []*Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.items) {
+		n = len(s.items)
+	}
+	return append([]*Item(nil), s.items[:n]...)
+}
+
+// commit 移除缓冲头部 n 个已补写成功的 item，返回剩余数量。
+// 配置 path 时只推进 head，已补写记录不少于剩余记录（或缓冲清空）时才压缩文件。
+func (s *spool) commit(n int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.items[i] = nil
+	}
+	s.items = s.items[n:]
+	if s.path == "" {
+		return len(s.items), nil
+	}
+	s.head += n
+	if s.head >= len(s.items) {
+		return len(s.items), s.rewriteFile()
+	}
+	return len(s.items), writeFileAtomic(s.headPath(), []byte(strconv.Itoa(s.head)))
+}
+
+// remove 移除缓冲中所有满足 match 的 item，返回移除数量
+func (s *spool) remove(match func(*Item) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.items[:0:0]
+	for _, it := range s.items {
+		if !match(it) {
+			kept = append(kept, it)
+		}
+	}
+	n := len(s.items) - len(kept)
+	if n == 0 {
+		return 0, nil
+	}
+	s.items = kept
+	if s.path == "" {
+		return n, nil
+	}
+	return n, s.rewriteFile()
+}
+
+func (s *spool) appendFile(items []*Item) error {
+	buf, err := encodeSpoolRecords(items)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rewriteFile 用剩余 item 重写文件并清零 head。先删除 head 文件再替换数据文件：
+// 两步之间崩溃只会让已补写的 item 在重启后重复补写（ZADD 幂等），不会丢失 item。
+func (s *spool) rewriteFile() error {
+	if err := os.Remove(s.headPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.head = 0
+	if len(s.items) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	buf, err := encodeSpoolRecords(s.items)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, buf)
+}
+
+// writeFileAtomic 写入临时文件后 rename 覆盖 path
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// encodeSpoolRecords 编码为 uvarint 长度前缀 + Item protobuf 的连续记录
+func encodeSpoolRecords(items []*Item) ([]byte, error) {
+	var buf []byte
+	for _, it := range items {
+		b, err := proto.Marshal(it)
+		if err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(b)))
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
+// isBackendUnavailable 判断写入错误是否由 Redis 不可用引起，只有这类错误值得缓冲后重试；
+// 脚本错误、WRONGTYPE 等确定性错误重试也不会成功
+func isBackendUnavailable(err error) bool {
+	return isBackendFailure(err) || errors.Is(err, ErrBackendUnavailable)
+}
+
+// spoolItems 把无法写入 Redis 的 items 放入本地缓冲；未启用缓冲时原样返回 cause
+func (q *redisQueue) spoolItems(items []*Item, execAts []int64, cause error) error {
+	if q.spool == nil {
+		return cause
+	}
+	if err := q.spool.add(items, execAts); err != nil {
+		if cause != nil {
+			q.log.Warnf("topic=%s spool %d items error: %v (redis error: %v)", q.topic, len(items), err, cause)
+		}
+		return err
+	}
+	q.monitorCount(MetricSpooled, len(items))
+	q.monitorObserve(MetricSpoolDepth, int64(q.spool.len()))
+	q.startSpoolFlusher()
+	return nil
+}
+
+// startSpoolFlusher 队列未 Start（只生产不消费）时补写 ticker 不会运行，
+// 由缓冲在收到 item 时自行启动 flusher goroutine，缓冲清空后退出
+func (q *redisQueue) startSpoolFlusher() {
+	sp := q.spool
+	if q.started.Get() == 1 || sp.stopped.Get() == 1 || !sp.flusher.CompareAndSwap(0, 1) {
+		return
+	}
+	sp.wg.Add(1)
+	go q.runSpoolFlusher()
+}
+
+// runSpoolFlusher 以 poll 间隔补写缓冲，失败时与 ticker 一致地指数退避；缓冲清空、Close 或 ctx 取消时退出
+func (q *redisQueue) runSpoolFlusher() {
+	sp := q.spool
+	defer sp.wg.Done()
+	d := q.pollInterval()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	failures := 0
+	for {
+		select {
+		case <-t.C:
+		case <-sp.stopC:
+			return
+		case <-q.ctx.Done():
+			return
+		}
+		next := d
+		if err := q.flushSpool(); err != nil {
+			failures++
+			next = backoffDuration(d, failures, tickerErrorBackoffMax)
+			if q.tickerRetryAfter != nil {
+				if ra := q.tickerRetryAfter(err); ra > next {
+					next = ra
+				}
+			}
+		} else {
+			failures = 0
+		}
+		if sp.len() == 0 {
+			sp.flusher.Set(0)
+			// 清除标志后可能有新 item 进入缓冲而未能启动新的 flusher，由本 goroutine 继续处理
+			if sp.len() == 0 || !sp.flusher.CompareAndSwap(0, 1) {
+				return
+			}
+		}
+		t.Reset(next)
+	}
+}
+
+// closeSpool 停止 flusher goroutine，并尽力把缓冲中剩余的 item 补写到 Redis。
+// 仍未写入的 item 在配置 SpoolPath 时保留在文件中，下次启动时补写；
+// 否则记录错误日志、计入 MetricSpoolDropped 并从缓冲中移除。
+func (q *redisQueue) closeSpool() {
+	sp := q.spool
+	if sp.stopped.CompareAndSwap(0, 1) {
+		close(sp.stopC)
+	}
+	sp.wg.Wait()
+	for sp.len() > 0 {
+		if err := q.flushSpool(); err != nil {
+			break
+		}
+	}
+	n := sp.len()
+	if n == 0 {
+		return
+	}
+	if sp.path != "" {
+		q.log.Warnf("topic=%s %d spooled items kept in %s until next start", q.topic, n, sp.path)
+		return
+	}
+	q.log.Errorf("topic=%s dropped %d spooled items on close: redis unavailable and SpoolPath not set", q.topic, n)
+	q.monitorCount(MetricSpoolDropped, n)
+	_, _ = sp.commit(n)
+	q.monitorObserve(MetricSpoolDepth, 0)
+}
+
+// flushSpool 把缓冲头部的 item 通过批量 ZADD 补写到 Redis，由 ticker 或 flusher goroutine 周期调用。
+// Redis 不可用时返回错误触发退避，缓冲内容保持不变；批量写入因其他错误失败时逐个补写，
+// 仍然失败的 item 记录错误日志、计入 MetricSpoolDropped 并移出缓冲，避免阻塞后续 item。
+func (q *redisQueue) flushSpool() error {
+	q.spool.flushMu.Lock()
+	defer q.spool.flushMu.Unlock()
+	items := q.spool.peek(spoolFlushBatch)
+	if len(items) == 0 {
+		return nil
+	}
+	execAts := make([]int64, len(items))
+	for i, it := range items {
+		execAts[i] = it.GetDelaySecond()
+	}
+	n, err := len(items), q.addItems(items, execAts)
+	if err != nil {
+		if isBackendUnavailable(err) {
+			return err
+		}
+		n, err = q.flushSpoolOneByOne(items, execAts)
+	}
+	if n > 0 {
+		left, cerr := q.spool.commit(n)
+		if cerr != nil {
+			q.log.Errorf("topic=%s commit spool file error: %v", q.topic, cerr)
+		}
+		q.monitorObserve(MetricSpoolDepth, int64(left))
+		q.log.Infof("topic=%s flushed %d spooled items, %d left", q.topic, n, left)
+	}
+	return err
+}
+
+// flushSpoolOneByOne 逐个补写 items，丢弃因确定性错误无法写入的 item；
+// 返回已处理（写入或丢弃）的头部 item 数，遇到 Redis 不可用时停止并返回该错误
+func (q *redisQueue) flushSpoolOneByOne(items []*Item, execAts []int64) (int, error) {
+	for i, it := range items {
+		err := q.addItems(items[i:i+1], execAts[i:i+1])
+		if err == nil {
+			continue
+		}
+		if isBackendUnavailable(err) {
+			return i, err
+		}
+		q.log.Errorf("topic=%s drop spooled item %s: %v", q.topic, it.GetValue(), err)
+		q.monitorCount(MetricSpoolDropped)
+	}
+	return len(items), nil
+}
+
+// spoolDepth 返回本地缓冲中等待补写的 item 数；未启用缓冲时返回 -1
+func (q *redisQueue) spoolDepth() int64 {
+	if q.spool == nil {
+		return -1
+	}
+	return int64(q.spool.len())
+}
@@ -0,0 +1,404 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// redisDown 让 addScript 的 EvalSha/Eval 都返回连接错误
+func redisDown(b *fakeScriptBuilder) {
+	fail := func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	b.scripts[idxAdd].evalShaFn = fail
+	b.scripts[idxAdd].evalFn = fail
+}
+
+// recordAdds 让 addScript 成功并按调用顺序记录写入的 value 与 score
+func recordAdds(b *fakeScriptBuilder) func() ([]string, []float64) {
+	var mu sync.Mutex
+	var values []string
+	var scores []float64
+	b.scripts[idxAdd].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i+1 < len(args); i += 2 {
+			values = append(values, string(args[i].([]byte)))
+			scores = append(scores, args[i+1].(float64))
+		}
+		return []interface{}{true}, nil
+	}
+	return func() ([]string, []float64) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), values...), append([]float64(nil), scores...)
+	}
+}
+
+// TestSpool_DisabledReturnsRedisError 未配置 SpoolSize 时 Push 直接返回 Redis 错误
+func TestSpool_DisabledReturnsRedisError(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-off", WithRedisScriptBuilder(b)).(*redisQueue)
+	redisDown(b)
+	if err := rq.Push(&Item{Value: []byte("a")}); err == nil || errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("want redis error got %v", err)
+	}
+	if d := rq.spoolDepth(); d != -1 {
+		t.Fatalf("want -1 depth when disabled got %d", d)
+	}
+}
+
+// TestSpool_ScriptErrorNotSpooled 脚本错误等与可用性无关的写入错误直接返回给调用方，不进入缓冲
+func TestSpool_ScriptErrorNotSpooled(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-script-err",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithPollInterval(time.Hour),
+	).(*redisQueue)
+	wrongType := func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return nil, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	b.scripts[idxAdd].evalShaFn = wrongType
+	b.scripts[idxAdd].evalFn = wrongType
+	if err := rq.Push(&Item{Value: []byte("a")}); err == nil {
+		t.Fatal("push should fail on script error")
+	}
+	if err := rq.PushBatch([]*Item{{Value: []byte("b")}, {Value: []byte("c")}}); err == nil {
+		t.Fatal("push batch should fail on script error")
+	}
+	if d := rq.spoolDepth(); d != 0 {
+		t.Fatalf("script error should not be spooled, depth=%d", d)
+	}
+}
+
+// TestSpool_FlushDropsPoisonItem 补写遇到与可用性无关的错误时逐个写入，丢弃无法写入的 item 并继续补写后续 item
+func TestSpool_FlushDropsPoisonItem(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	var dropped int64
+	rq := NewRedisTopicQueue(context.Background(), "spool-poison",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithPollInterval(time.Hour),
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			if metric == MetricSpoolDropped {
+				atomic.AddInt64(&dropped, value)
+			}
+		}),
+	).(*redisQueue)
+	redisDown(b)
+	if err := rq.PushBatch([]*Item{{Value: []byte("a")}, {Value: []byte("bad")}, {Value: []byte("c")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var values []string
+	b.scripts[idxAdd].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		for i := 0; i < len(args); i += 2 {
+			if string(args[i].([]byte)) == "bad" {
+				return nil, errors.New("ERR value is not a valid float")
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i < len(args); i += 2 {
+			values = append(values, string(args[i].([]byte)))
+		}
+		return []interface{}{true}, nil
+	}
+	if err := rq.flushSpool(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	got := fmt.Sprint(values)
+	mu.Unlock()
+	if got != "[a c]" {
+		t.Fatalf("want [a c] flushed got %s", got)
+	}
+	if n := atomic.LoadInt64(&dropped); n != 1 {
+		t.Fatalf("want 1 dropped got %d", n)
+	}
+	if d := rq.spoolDepth(); d != 0 {
+		t.Fatalf("want empty spool got %d", d)
+	}
+}
+
+// TestSpool_BufferAndFlushInOrder Redis 故障期间 Push 进入缓冲，恢复后按 Push 顺序补写并保留原执行时间
+func TestSpool_BufferAndFlushInOrder(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-flush",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		// 本测试手动调用 flushSpool，避免 flusher goroutine 介入
+		WithPollInterval(time.Hour),
+	).(*redisQueue)
+	redisDown(b)
+
+	now := unix()
+	if err := rq.Push(&Item{Value: []byte("a"), DelaySecond: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.PushBatch([]*Item{{Value: []byte("b")}, {Value: []byte("c"), Priority: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if d := rq.spoolDepth(); d != 3 {
+		t.Fatalf("want depth 3 got %d", d)
+	}
+	// Redis 故障期间 flush 失败，缓冲保持不变
+	if err := rq.flushSpool(); err == nil {
+		t.Fatal("flush should fail while redis is down")
+	}
+
+	got := recordAdds(b)
+	// 缓冲非空时新 Push 追加到尾部而不是直接写 Redis，保证顺序
+	if err := rq.Push(&Item{Value: []byte("d")}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := got(); len(values) != 0 {
+		t.Fatalf("push should be spooled while spool is non-empty, got %v", values)
+	}
+	if err := rq.flushSpool(); err != nil {
+		t.Fatal(err)
+	}
+	values, scores := got()
+	if want := []string{"a", "b", "c", "d"}; len(values) != 4 || values[0] != want[0] || values[1] != want[1] ||
+		values[2] != want[2] || values[3] != want[3] {
+		t.Fatalf("want %v got %v", want, values)
+	}
+	if ts := scoreToExecTs(scores[0]); ts < now+99 || ts > now+101 {
+		t.Fatalf("spooled item should keep execute time now+100, got %d (now=%d)", ts, now)
+	}
+	if want := itemScore(scoreToExecTs(scores[2]), 3); scores[2] != want {
+		t.Fatalf("priority lost: want score %v got %v", want, scores[2])
+	}
+	if d := rq.spoolDepth(); d != 0 {
+		t.Fatalf("want empty spool got %d", d)
+	}
+	// 缓冲清空后 Push 直接写 Redis
+	if err := rq.Push(&Item{Value: []byte("e")}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ = got(); len(values) != 5 || values[4] != "e" {
+		t.Fatalf("want direct write after flush, got %v", values)
+	}
+}
+
+// TestSpool_Full 缓冲容量不足以容纳整批时返回 ErrSpoolFull，且不写入任何 item
+func TestSpool_Full(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-full",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(2),
+	).(*redisQueue)
+	redisDown(b)
+	if err := rq.Push(&Item{Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.PushBatch([]*Item{{Value: []byte("b")}, {Value: []byte("c")}}); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("want ErrSpoolFull got %v", err)
+	}
+	if d := rq.spoolDepth(); d != 1 {
+		t.Fatalf("want depth 1 got %d", d)
+	}
+}
+
+// TestSpool_FilePersistence 配置 SpoolPath 时缓冲写入文件，重建队列后恢复并在补写完成后删除文件
+func TestSpool_FilePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "{topic}.spool")
+	file := filepath.Join(filepath.Dir(path), "spool-file.spool")
+
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-file",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithSpoolPath(path),
+	).(*redisQueue)
+	redisDown(b)
+	for _, v := range []string{"x", "y"} {
+		if err := rq.Push(&Item{Value: []byte(v), DelaySecond: 30}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("spool file should exist: %v", err)
+	}
+
+	// 模拟进程重启：新队列从文件恢复
+	b2 := &fakeScriptBuilder{}
+	rq2 := NewRedisTopicQueue(context.Background(), "spool-file",
+		WithRedisScriptBuilder(b2),
+		WithSpoolSize(10),
+		WithSpoolPath(path),
+	).(*redisQueue)
+	if d := rq2.spoolDepth(); d != 2 {
+		t.Fatalf("want 2 items restored got %d", d)
+	}
+	got := recordAdds(b2)
+	if err := rq2.flushSpool(); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := got(); len(values) != 2 || values[0] != "x" || values[1] != "y" {
+		t.Fatalf("unexpected restored values %v", values)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("spool file should be removed after flush, stat err=%v", err)
+	}
+}
+
+// TestSpool_StatusAndTicker Status 报告缓冲深度，启用缓冲时追加补写 ticker
+func TestSpool_StatusAndTicker(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	q := New(WithRedisScriptBuilder(b), WithSpoolSize(5)).(*queue)
+	tq := q.newTopicQueue("spool-status")
+	rq := tq.(*redisQueue)
+	if n := len(rq.tickers()); n != 3 {
+		t.Fatalf("want 3 tickers got %d", n)
+	}
+	q.topicQueues.Store(tq.Topic(), tq)
+	redisDown(b)
+	b.scripts[idxLength].evalShaFn = func(ctx context.Context, keys []string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{int64(0), int64(0)}, nil
+	}
+	if err := q.Push(&Item{Topic: "spool-status", Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if s := q.Status(); s.Spooled["spool-status"] != 1 {
+		t.Fatalf("want spooled=1 got %v", s.Spooled)
+	}
+	if n := rq.lengthAll(); n != 1 {
+		t.Fatalf("drain should wait for spooled items, lengthAll=%d", n)
+	}
+}
+
+// TestSpool_ProducerOnlyFlushes 未 Start 的只生产队列在缓冲收到 item 后自行补写，清空后恢复直接写 Redis
+func TestSpool_ProducerOnlyFlushes(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-producer",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithPollInterval(20*time.Millisecond),
+	).(*redisQueue)
+	defer rq.Close()
+	redisDown(b)
+	if err := rq.Push(&Item{Value: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	got := recordAdds(b)
+	waitUntil(t, 2000, func() bool { return rq.spoolDepth() == 0 })
+	waitUntil(t, 2000, func() bool { return rq.spool.flusher.Get() == 0 })
+	if err := rq.Push(&Item{Value: []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := got(); len(values) != 2 || values[0] != "a" || values[1] != "b" {
+		t.Fatalf("unexpected values %v", values)
+	}
+}
+
+// TestSpool_CloseFlushes Close 时补写缓冲中剩余的 item
+func TestSpool_CloseFlushes(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "spool-close-flush",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithPollInterval(time.Hour),
+	).(*redisQueue)
+	redisDown(b)
+	if err := rq.PushBatch([]*Item{{Value: []byte("a")}, {Value: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	got := recordAdds(b)
+	_ = rq.Close()
+	if values, _ := got(); len(values) != 2 {
+		t.Fatalf("close should flush spooled items, got %v", values)
+	}
+	if d := rq.spoolDepth(); d != 0 {
+		t.Fatalf("want empty spool got %d", d)
+	}
+}
+
+// TestSpool_CloseDropsInMemory Close 时 Redis 仍不可用且未配置 SpoolPath，丢弃的 item 计入 MetricSpoolDropped
+func TestSpool_CloseDropsInMemory(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	var dropped int64
+	rq := NewRedisTopicQueue(context.Background(), "spool-close-drop",
+		WithRedisScriptBuilder(b),
+		WithSpoolSize(10),
+		WithPollInterval(time.Hour),
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			if metric == MetricSpoolDropped {
+				atomic.AddInt64(&dropped, value)
+			}
+		}),
+	).(*redisQueue)
+	redisDown(b)
+	if err := rq.PushBatch([]*Item{{Value: []byte("a")}, {Value: []byte("b")}, {Value: []byte("c")}}); err != nil {
+		t.Fatal(err)
+	}
+	_ = rq.Close()
+	if n := atomic.LoadInt64(&dropped); n != 3 {
+		t.Fatalf("want 3 dropped got %d", n)
+	}
+	if d := rq.spoolDepth(); d != 0 {
+		t.Fatalf("want empty spool got %d", d)
+	}
+}
+
+// TestSpool_FileHeadOffset 补写只推进 head 文件，已补写记录不少于剩余记录时才压缩数据文件
+func TestSpool_FileHeadOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "head.spool")
+	sp, err := newSpool("head", 100, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]*Item, 10)
+	execAts := make([]int64, 10)
+	for i := range items {
+		items[i] = &Item{Value: []byte(strconv.Itoa(i))}
+	}
+	if err = sp.add(items, execAts); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(path)
+	if left, err := sp.commit(3); err != nil || left != 7 {
+		t.Fatalf("left=%d err=%v", left, err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() != before.Size() {
+		t.Fatalf("commit below threshold should not rewrite data file, size %d -> %d", before.Size(), after.Size())
+	}
+	if b, err := os.ReadFile(path + ".head"); err != nil || string(b) != "3" {
+		t.Fatalf("head file %q err=%v", b, err)
+	}
+
+	reloaded, err := newSpool("head", 100, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.peek(100); len(got) != 7 || string(got[0].GetValue()) != "3" {
+		t.Fatalf("reload should skip committed records, got %d items", len(got))
+	}
+
+	if _, err = sp.commit(3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path + ".head"); !os.IsNotExist(err) {
+		t.Fatalf("compaction should remove head file, stat err=%v", err)
+	}
+	reloaded, err = newSpool("head", 100, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.peek(100); len(got) != 4 || string(got[0].GetValue()) != "6" {
+		t.Fatalf("unexpected items after compaction: %d", len(got))
+	}
+}
@@ -0,0 +1,478 @@
+package delayq
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLDialect SQL 后端方言，决定占位符、DDL 与是否使用 SKIP LOCKED 认领
+type SQLDialect string
+
+const (
+	// SQLDialectPostgres PostgreSQL（9.5+），占位符 $n，认领使用 FOR UPDATE SKIP LOCKED
+	SQLDialectPostgres SQLDialect = "postgres"
+	// SQLDialectMySQL MySQL（8.0+），占位符 ?，认领使用 FOR UPDATE SKIP LOCKED
+	SQLDialectMySQL SQLDialect = "mysql"
+	// SQLDialectSQLite SQLite，占位符 ?；写事务天然串行，认领不加锁后缀
+	SQLDialectSQLite SQLDialect = "sqlite"
+)
+
+// item 在表中的状态
+const (
+	sqlStateDelayed = 0
+	sqlStateDoing   = 1
+)
+
+// sqlPollBatch 每次 poll 最多认领的 item 数
+const sqlPollBatch = 256
+
+// rebind 把 ? 占位符替换为方言对应的形式
+func (d SQLDialect) rebind(query string) string {
+	if d != SQLDialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(query[i])
+	}
+	return b.String()
+}
+
+// lockSuffix 返回认领 SELECT 的行锁后缀
+func (d SQLDialect) lockSuffix() string {
+	if d == SQLDialectPostgres || d == SQLDialectMySQL {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
+
+// SQLSchema 返回创建 delayq 表与索引的 DDL 语句，便于接入已有的迁移工具。
+// 表结构：id, topic, execute_at（unix 秒）, priority, payload（Item.Value）, state（0 delayed / 1 doing）,
+// lease_until（doing 状态的租约到期 unix 秒）, attempts（已失败次数）。
+func SQLSchema(dialect SQLDialect, table string) ([]string, error) {
+	idx := table + "_poll_idx"
+	switch dialect {
+	case SQLDialectPostgres:
+		return []string{
+			"CREATE TABLE IF NOT EXISTS " + table + " (" +
+				"id BIGSERIAL PRIMARY KEY, topic VARCHAR(255) NOT NULL, execute_at BIGINT NOT NULL, " +
+				"priority INTEGER NOT NULL DEFAULT 0, payload BYTEA NOT NULL, state SMALLINT NOT NULL DEFAULT 0, " +
+				"lease_until BIGINT NOT NULL DEFAULT 0, attempts INTEGER NOT NULL DEFAULT 0)",
+			"CREATE INDEX IF NOT EXISTS " + idx + " ON " + table + " (topic, state, execute_at)",
+		}, nil
+	case SQLDialectMySQL:
+		return []string{
+			"CREATE TABLE IF NOT EXISTS " + table + " (" +
+				"id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY, topic VARCHAR(255) NOT NULL, execute_at BIGINT NOT NULL, " +
+				"priority INT NOT NULL DEFAULT 0, payload BLOB NOT NULL, state TINYINT NOT NULL DEFAULT 0, " +
+				"lease_until BIGINT NOT NULL DEFAULT 0, attempts INT NOT NULL DEFAULT 0, " +
+				"KEY " + idx + " (topic, state, execute_at))",
+		}, nil
+	case SQLDialectSQLite:
+		return []string{
+			"CREATE TABLE IF NOT EXISTS " + table + " (" +
+				"id INTEGER PRIMARY KEY AUTOINCREMENT, topic TEXT NOT NULL, execute_at INTEGER NOT NULL, " +
+				"priority INTEGER NOT NULL DEFAULT 0, payload BLOB NOT NULL, state INTEGER NOT NULL DEFAULT 0, " +
+				"lease_until INTEGER NOT NULL DEFAULT 0, attempts INTEGER NOT NULL DEFAULT 0)",
+			"CREATE INDEX IF NOT EXISTS " + idx + " ON " + table + " (topic, state, execute_at)",
+		}, nil
+	}
+	return nil, fmt.Errorf("delayq: unsupported sql dialect %q", dialect)
+}
+
+// MigrateSQLSchema 在 db 中创建 delayq 表与索引（已存在时跳过），表名取 WithSQLTableName
+func MigrateSQLSchema(ctx context.Context, db *sql.DB, dialect SQLDialect, opts ...Option) error {
+	stmts, err := SQLSchema(dialect, newConfig(opts...).GetSQLTableName())
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		if _, err = db.ExecContext(ctx, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type sqlQueue struct {
+	*baseQueue
+
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+
+	// ids 已认领（doing）item 到行 id 的映射，用于 ack
+	idsMu sync.Mutex
+	ids   map[*Item]int64
+}
+
+// NewSQLTopicQueue 构造一个以关系数据库为后端的 TopicQueue，语义与 Redis 后端一致：
+// 到期 item 以行锁认领（Postgres/MySQL 使用 SELECT ... FOR UPDATE SKIP LOCKED，多实例互不阻塞），
+// 认领后进入 doing 状态并设置 VisibilityTimeout 租约，超时未 ack 的 item 由 reclaim 放回。
+// 表需预先通过 MigrateSQLSchema 创建。
+func NewSQLTopicQueue(db *sql.DB, dialect SQLDialect, topic string, opts ...Option) TopicQueue {
+	return newSQLTopicQueue(context.Background(), db, dialect, topic, newConfig(opts...))
+}
+
+func newSQLTopicQueue(ctx context.Context, db *sql.DB, dialect SQLDialect, topic string, opts *Options) *sqlQueue {
+	q := &sqlQueue{
+		db:      db,
+		dialect: dialect,
+		table:   opts.GetSQLTableName(),
+		ids:     make(map[*Item]int64),
+	}
+	q.baseQueue = newBaseQueue(ctx, topic, opts)
+	q.success = q.onSuccess
+	q.failed = q.onFailed
+	if heartbeatIntervalFor(opts) > 0 {
+		q.onItemStart = q.startHeartbeat
+	}
+	return q
+}
+
+func (q *sqlQueue) opCtx() context.Context {
+	if q.ctx != nil {
+		return q.ctx
+	}
+	return context.Background()
+}
+
+func (q *sqlQueue) exec(ctx context.Context, e interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}, query string, args ...interface{}) (sql.Result, error) {
+	return e.ExecContext(ctx, q.dialect.rebind(query), args...)
+}
+
+// Push 插入一行 delayed 状态的记录，execute_at = now + DelaySecond
+func (q *sqlQueue) Push(item *Item) error {
+	if err := q.prepareItem(item); err != nil {
+		return err
+	}
+	return q.insert([]*Item{item})
+}
+
+// PushBatch 在同一事务中插入所有 item。
+// 限流时整批一次性扣 len(items) 个 token，不足直接拒绝整批。
+func (q *sqlQueue) PushBatch(items []*Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if q.draining.Get() == 1 {
+		return ErrDraining
+	}
+	if q.limiter != nil && !q.limiter.AllowN(len(items)) {
+		q.monitorCount(MetricRateLimited, len(items))
+		return ErrRateLimited
+	}
+	for _, it := range items {
+		if err := q.prepareItemNoRate(it); err != nil {
+			return err
+		}
+	}
+	return q.insert(items)
+}
+
+func (q *sqlQueue) insert(items []*Item) error {
+	ctx := q.opCtx()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	now := unix()
+	query := "INSERT INTO " + q.table + " (topic, execute_at, priority, payload, state, lease_until, attempts) VALUES (?, ?, ?, ?, 0, 0, 0)"
+	for _, it := range items {
+		delay := it.GetDelaySecond()
+		if delay < 0 {
+			delay = 0
+		}
+		if _, err = q.exec(ctx, tx, query, q.topic, now+delay, it.GetPriority(), it.GetValue()); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	q.notifyPushed(items...)
+	return nil
+}
+
+// Length 返回 delayed 状态的 item 数
+func (q *sqlQueue) Length() int64 {
+	n, err := q.count("SELECT COUNT(*) FROM "+q.table+" WHERE topic = ? AND state = ?", q.topic, sqlStateDelayed)
+	if err != nil {
+		q.log.Errorf("topic=%s length error: %v", q.topic, err)
+	}
+	return n
+}
+
+// lengthAll 返回 delayed + doing 状态的 item 数（用于 Drain 判定）
+func (q *sqlQueue) lengthAll() int64 {
+	n, _ := q.count("SELECT COUNT(*) FROM "+q.table+" WHERE topic = ?", q.topic)
+	return n
+}
+
+func (q *sqlQueue) count(query string, args ...interface{}) (int64, error) {
+	var n int64
+	err := q.db.QueryRowContext(q.opCtx(), q.dialect.rebind(query), args...).Scan(&n)
+	return n, err
+}
+
+// Get 查询 value 是否存在（delayed 或 doing），返回剩余延迟（doing 中返回 0）
+func (q *sqlQueue) Get(value []byte) (remaining time.Duration, exists bool, err error) {
+	var state, executeAt int64
+	err = q.db.QueryRowContext(q.opCtx(), q.dialect.rebind(
+		"SELECT state, execute_at FROM "+q.table+" WHERE topic = ? AND payload = ? ORDER BY state DESC, execute_at ASC LIMIT 1"),
+		q.topic, value).Scan(&state, &executeAt)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if state == sqlStateDoing {
+		return 0, true, nil
+	}
+	if now := unix(); executeAt > now {
+		return time.Duration(executeAt-now) * time.Second, true, nil
+	}
+	return 0, true, nil
+}
+
+// Cancel 删除所有匹配 value 的行（含 doing 中的），返回是否至少删除了一行
+func (q *sqlQueue) Cancel(value []byte) (bool, error) {
+	res, err := q.exec(q.opCtx(), q.db, "DELETE FROM "+q.table+" WHERE topic = ? AND payload = ?", q.topic, value)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (q *sqlQueue) Close() error { return q.close() }
+
+// Drain 进入 drain 状态：拒绝新 Push，等待 delayed + doing + inFlight 全部为 0
+func (q *sqlQueue) Drain(ctx context.Context) error {
+	return q.drain(ctx, q.lengthAll)
+}
+
+func (q *sqlQueue) tickers() []ticker {
+	return []ticker{
+		{d: pollIntervalFor(q.opts), f: q.poll},
+		{d: reclaimIntervalFor(q.opts), f: q.reclaim},
+	}
+}
+
+func (q *sqlQueue) Start(f func(item *Item) error) error {
+	return q.start(f, q.tickers()...)
+}
+
+// StartManualAck 启动手动 ack 模式
+func (q *sqlQueue) StartManualAck(f func(item *Item, ack Acker)) error {
+	q.manualHandler = f
+	return q.start(func(*Item) error { return nil }, q.tickers()...)
+}
+
+// visibilityTimeoutSec 返回 doing 租约时长（秒），至少 1
+func (q *sqlQueue) visibilityTimeoutSec() int64 {
+	if vt := int64(q.opts.GetVisibilityTimeout() / time.Second); vt > 0 {
+		return vt
+	}
+	return 1
+}
+
+// poll 在一个事务中认领到期的 delayed 行并置为 doing（lease_until = now + VisibilityTimeout），
+// 提交后派发给 handler。
+func (q *sqlQueue) poll() error {
+	items, err := q.claim()
+	if err != nil {
+		q.monitorCount(MetricPollError)
+		return err
+	}
+	if len(items) > 0 {
+		q.monitorObserve(MetricPollBatchSize, int64(len(items)))
+	}
+	for _, it := range items {
+		q.execute(it)
+	}
+	return nil
+}
+
+func (q *sqlQueue) claim() ([]*Item, error) {
+	ctx := q.opCtx()
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := unix()
+	rows, err := tx.QueryContext(ctx, q.dialect.rebind(
+		"SELECT id, payload, priority, attempts FROM "+q.table+
+			" WHERE topic = ? AND state = ? AND execute_at <= ?"+
+			" ORDER BY execute_at ASC, priority DESC, id ASC LIMIT "+strconv.Itoa(sqlPollBatch)+q.dialect.lockSuffix()),
+		q.topic, sqlStateDelayed, now)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	var items []*Item
+	for rows.Next() {
+		var id, attempts int64
+		var priority int32
+		var payload []byte
+		if err = rows.Scan(&id, &payload, &priority, &attempts); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		item := &Item{Topic: q.topic, Value: payload, Priority: priority}
+		// item.DelaySecond 编码已失败次数（负值），与其他后端一致
+		if attempts > 0 {
+			item.DelaySecond = -attempts
+		}
+		ids = append(ids, id)
+		items = append(items, item)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(ids)+2)
+	args = append(args, sqlStateDoing, now+q.visibilityTimeoutSec())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err = q.exec(ctx, tx, "UPDATE "+q.table+" SET state = ?, lease_until = ? WHERE id IN ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")+")", args...); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	q.idsMu.Lock()
+	for i, it := range items {
+		q.ids[it] = ids[i]
+	}
+	q.idsMu.Unlock()
+	return items, nil
+}
+
+// reclaim 把租约已过期的 doing 行放回 delayed，立即可被再次认领
+func (q *sqlQueue) reclaim() error {
+	now := unix()
+	res, err := q.exec(q.opCtx(), q.db,
+		"UPDATE "+q.table+" SET state = ?, execute_at = ?, lease_until = 0 WHERE topic = ? AND state = ? AND lease_until < ?",
+		sqlStateDelayed, now, q.topic, sqlStateDoing, now)
+	if err != nil {
+		q.monitorCount(MetricReclaimError)
+		return err
+	}
+	n, _ := res.RowsAffected()
+	q.monitorCount(MetricReclaim, int(n))
+	return nil
+}
+
+// takeID 取出并移除 item 对应的行 id
+func (q *sqlQueue) takeID(item *Item) (int64, bool) {
+	q.idsMu.Lock()
+	defer q.idsMu.Unlock()
+	id, ok := q.ids[item]
+	delete(q.ids, item)
+	return id, ok
+}
+
+// onSuccess 删除已处理成功的行
+func (q *sqlQueue) onSuccess(item *Item) error {
+	id, ok := q.takeID(item)
+	if !ok {
+		return nil
+	}
+	_, err := q.exec(q.opCtx(), q.db, "DELETE FROM "+q.table+" WHERE id = ?", id)
+	return err
+}
+
+// onFailed 累加失败次数并按重试策略放回 delayed；达到 RetryTimes 时回调死信并删除该行。
+// RetryTimes 语义与其他后端一致：>0 失败次数超过该值投递死信；==0 首次失败即死信；<0 永不死信。
+func (q *sqlQueue) onFailed(item *Item) error {
+	id, ok := q.takeID(item)
+	if !ok {
+		return nil
+	}
+	failedCount := 1
+	if item.GetDelaySecond() < 0 {
+		failedCount = int(-item.GetDelaySecond()) + 1
+	}
+	if rt := q.opts.GetRetryTimes(); rt >= 0 && failedCount > rt {
+		item.DelaySecond = int64(-failedCount)
+		q.invokeDeadLetter(item)
+		_, err := q.exec(q.opCtx(), q.db, "DELETE FROM "+q.table+" WHERE id = ?", id)
+		return err
+	}
+	delaySec := int64(computeRetryDelay(q.opts, failedCount) / time.Second)
+	if delaySec < 0 {
+		delaySec = 0
+	}
+	if _, err := q.exec(q.opCtx(), q.db,
+		"UPDATE "+q.table+" SET state = ?, execute_at = ?, lease_until = 0, attempts = ? WHERE id = ?",
+		sqlStateDelayed, unix()+delaySec, failedCount, id); err != nil {
+		return err
+	}
+	q.notifyRetryScheduled(item, time.Duration(delaySec)*time.Second)
+	return nil
+}
+
+// startHeartbeat handler 执行期间定期延长 doing 行的 lease_until，避免长任务被 reclaim
+func (q *sqlQueue) startHeartbeat(item *Item) func() {
+	interval := heartbeatIntervalFor(q.opts)
+	q.idsMu.Lock()
+	id, ok := q.ids[item]
+	q.idsMu.Unlock()
+	if interval <= 0 || !ok {
+		return nil
+	}
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-q.exitC:
+				return
+			case <-t.C:
+			}
+			if _, err := q.exec(q.opCtx(), q.db,
+				"UPDATE "+q.table+" SET lease_until = ? WHERE id = ? AND state = ?",
+				unix()+q.visibilityTimeoutSec(), id, sqlStateDoing); err != nil {
+				q.monitorCount(MetricHeartbeatError)
+				q.log.Warnf("topic=%s heartbeat error: %v", q.topic, err)
+				continue
+			}
+			q.monitorCount(MetricHeartbeat)
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-doneCh
+	}
+}
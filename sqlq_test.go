@@ -0,0 +1,334 @@
+package delayq
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeSQL 一个按语句回调的假 database/sql 驱动，用于精准控制 SQL 后端的返回并记录执行过的语句
+type fakeSQL struct {
+	mu        sync.Mutex
+	calls     []fakeSQLCall
+	commits   int
+	rollbacks int
+	// handle 返回查询结果列与行，或 Exec 的影响行数
+	handle func(query string, args []driver.Value) (cols []string, rows [][]driver.Value, affected int64, err error)
+}
+
+type fakeSQLCall struct {
+	query string
+	args  []driver.Value
+}
+
+func newFakeSQL() (*fakeSQL, *sql.DB) {
+	f := &fakeSQL{}
+	return f, sql.OpenDB(f)
+}
+
+func (f *fakeSQL) Connect(context.Context) (driver.Conn, error) { return &fakeSQLConn{f: f}, nil }
+func (f *fakeSQL) Driver() driver.Driver                        { return fakeSQLDriver{f: f} }
+
+// callsMatching 返回包含 substr 的已执行语句
+func (f *fakeSQL) callsMatching(substr string) []fakeSQLCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []fakeSQLCall
+	for _, c := range f.calls {
+		if strings.Contains(c.query, substr) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (f *fakeSQL) run(query string, named []driver.NamedValue) ([]string, [][]driver.Value, int64, error) {
+	args := make([]driver.Value, len(named))
+	for i, nv := range named {
+		args[i] = nv.Value
+	}
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeSQLCall{query: query, args: args})
+	h := f.handle
+	f.mu.Unlock()
+	if h == nil {
+		return nil, nil, 0, nil
+	}
+	return h(query, args)
+}
+
+type fakeSQLDriver struct{ f *fakeSQL }
+
+func (d fakeSQLDriver) Open(string) (driver.Conn, error) { return &fakeSQLConn{f: d.f}, nil }
+
+type fakeSQLConn struct{ f *fakeSQL }
+
+func (c *fakeSQLConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeSQLConn) Close() error                        { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error)           { return fakeSQLTx{f: c.f}, nil }
+
+func (c *fakeSQLConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, _, affected, err := c.f.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+func (c *fakeSQLConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	cols, rows, _, err := c.f.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeSQLRows{cols: cols, rows: rows}, nil
+}
+
+type fakeSQLTx struct{ f *fakeSQL }
+
+func (t fakeSQLTx) Commit() error {
+	t.f.mu.Lock()
+	t.f.commits++
+	t.f.mu.Unlock()
+	return nil
+}
+
+func (t fakeSQLTx) Rollback() error {
+	t.f.mu.Lock()
+	t.f.rollbacks++
+	t.f.mu.Unlock()
+	return nil
+}
+
+type fakeSQLRows struct {
+	cols []string
+	rows [][]driver.Value
+	i    int
+}
+
+func (r *fakeSQLRows) Columns() []string { return r.cols }
+func (r *fakeSQLRows) Close() error      { return nil }
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.i])
+	r.i++
+	return nil
+}
+
+// TestSQLSchema_Dialects 各方言生成对应 DDL，MigrateSQLSchema 依次执行
+func TestSQLSchema_Dialects(t *testing.T) {
+	for dialect, want := range map[SQLDialect]string{
+		SQLDialectPostgres: "BIGSERIAL",
+		SQLDialectMySQL:    "AUTO_INCREMENT",
+		SQLDialectSQLite:   "AUTOINCREMENT",
+	} {
+		stmts, err := SQLSchema(dialect, "jobs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(stmts[0], "CREATE TABLE IF NOT EXISTS jobs") || !strings.Contains(stmts[0], want) {
+			t.Fatalf("%s: unexpected ddl %q", dialect, stmts[0])
+		}
+		for _, col := range []string{"topic", "execute_at", "payload", "state", "lease_until", "attempts"} {
+			if !strings.Contains(stmts[0], col) {
+				t.Fatalf("%s: ddl missing column %s", dialect, col)
+			}
+		}
+	}
+	if _, err := SQLSchema("oracle", "jobs"); err == nil {
+		t.Fatal("unsupported dialect should error")
+	}
+
+	f, db := newFakeSQL()
+	if err := MigrateSQLSchema(context.Background(), db, SQLDialectPostgres, WithSQLTableName("jobs")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.callsMatching("jobs")); n != 2 {
+		t.Fatalf("want 2 ddl statements executed got %d", n)
+	}
+}
+
+// TestSQLDialect_Rebind Postgres 使用 $n 占位符
+func TestSQLDialect_Rebind(t *testing.T) {
+	if got := SQLDialectPostgres.rebind("a = ? AND b IN (?, ?)"); got != "a = $1 AND b IN ($2, $3)" {
+		t.Fatalf("unexpected rebind %q", got)
+	}
+	if got := SQLDialectMySQL.rebind("a = ?"); got != "a = ?" {
+		t.Fatalf("mysql should keep ?, got %q", got)
+	}
+}
+
+// TestSQLQueue_PushBatchInOneTx PushBatch 在同一事务中插入所有行
+func TestSQLQueue_PushBatchInOneTx(t *testing.T) {
+	f, db := newFakeSQL()
+	q := NewSQLTopicQueue(db, SQLDialectMySQL, "sql-push")
+	now := unix()
+	if err := q.PushBatch([]*Item{{Value: []byte("a"), DelaySecond: 10, Priority: 2}, {Value: []byte("b")}}); err != nil {
+		t.Fatal(err)
+	}
+	inserts := f.callsMatching("INSERT INTO delayq_items")
+	if len(inserts) != 2 || f.commits != 1 {
+		t.Fatalf("want 2 inserts in 1 tx, got inserts=%d commits=%d", len(inserts), f.commits)
+	}
+	args := inserts[0].args
+	if args[0] != "sql-push" || args[2] != int64(2) || string(args[3].([]byte)) != "a" {
+		t.Fatalf("unexpected insert args %v", args)
+	}
+	if ts := args[1].(int64); ts < now+9 || ts > now+11 {
+		t.Fatalf("execute_at should be now+10, got %d (now=%d)", ts, now)
+	}
+}
+
+// TestSQLQueue_ClaimDispatchAck poll 以 SKIP LOCKED 认领到期行、置为 doing，处理成功后删除
+func TestSQLQueue_ClaimDispatchAck(t *testing.T) {
+	f, db := newFakeSQL()
+	var claimed int32
+	f.handle = func(query string, args []driver.Value) ([]string, [][]driver.Value, int64, error) {
+		if strings.HasPrefix(query, "SELECT id, payload") && atomic.CompareAndSwapInt32(&claimed, 0, 1) {
+			return []string{"id", "payload", "priority", "attempts"},
+				[][]driver.Value{{int64(7), []byte("job"), int64(1), int64(2)}}, 0, nil
+		}
+		return []string{"id", "payload", "priority", "attempts"}, nil, 1, nil
+	}
+	q := NewSQLTopicQueue(db, SQLDialectPostgres, "sql-claim", WithRetryTimes(5))
+	got := make(chan *Item, 1)
+	if err := q.Start(func(item *Item) error { got <- item; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	var item *Item
+	select {
+	case item = <-got:
+	case <-time.After(3 * time.Second):
+		t.Fatal("item not dispatched")
+	}
+	if string(item.GetValue()) != "job" || item.GetDelaySecond() != -2 || item.GetPriority() != 1 || item.GetTopic() != "sql-claim" {
+		t.Fatalf("unexpected item %v", item)
+	}
+	sel := f.callsMatching("SELECT id, payload")[0].query
+	if !strings.HasSuffix(sel, "FOR UPDATE SKIP LOCKED") || !strings.Contains(sel, "$3") {
+		t.Fatalf("postgres claim should use SKIP LOCKED and $n placeholders: %q", sel)
+	}
+	upd := f.callsMatching("SET state = $1, lease_until = $2 WHERE id IN")
+	if len(upd) == 0 || upd[0].args[0] != int64(sqlStateDoing) || upd[0].args[2] != int64(7) {
+		t.Fatalf("claimed rows should be set to doing: %v", upd)
+	}
+	waitUntil(t, 2000, func() bool { return len(f.callsMatching("DELETE FROM delayq_items WHERE id")) == 1 })
+	if del := f.callsMatching("DELETE FROM delayq_items WHERE id")[0]; del.args[0] != int64(7) {
+		t.Fatalf("ack should delete row 7, got %v", del.args)
+	}
+}
+
+// TestSQLQueue_SQLiteNoLockSuffix SQLite 不支持 SKIP LOCKED，认领语句不加锁后缀
+func TestSQLQueue_SQLiteNoLockSuffix(t *testing.T) {
+	f, db := newFakeSQL()
+	q := newSQLTopicQueue(context.Background(), db, SQLDialectSQLite, "sql-lite", newConfig())
+	if _, err := q.claim(); err != nil {
+		t.Fatal(err)
+	}
+	if sel := f.callsMatching("SELECT id, payload")[0].query; strings.Contains(sel, "SKIP LOCKED") {
+		t.Fatalf("sqlite claim should not lock: %q", sel)
+	}
+}
+
+// TestSQLQueue_FailedRetryAndDeadLetter 失败累加 attempts 并按重试间隔放回；超过 RetryTimes 回调死信并删除
+func TestSQLQueue_FailedRetryAndDeadLetter(t *testing.T) {
+	f, db := newFakeSQL()
+	f.handle = func(string, []driver.Value) ([]string, [][]driver.Value, int64, error) { return nil, nil, 1, nil }
+	var dead []*Item
+	q := newSQLTopicQueue(context.Background(), db, SQLDialectMySQL, "sql-fail", newConfig(
+		WithRetryTimes(1),
+		WithRetryInterval(30*time.Second),
+		WithOnDeadLetter(func(item *Item) { dead = append(dead, item) }),
+	))
+
+	first := &Item{Value: []byte("x")}
+	q.ids[first] = 11
+	now := unix()
+	if err := q.onFailed(first); err != nil {
+		t.Fatal(err)
+	}
+	upd := f.callsMatching("SET state = ?, execute_at = ?, lease_until = 0, attempts = ?")
+	if len(upd) != 1 || upd[0].args[2] != int64(1) || upd[0].args[3] != int64(11) {
+		t.Fatalf("unexpected retry update %v", upd)
+	}
+	if ts := upd[0].args[1].(int64); ts < now+29 || ts > now+31 {
+		t.Fatalf("retry should be scheduled at now+30, got %d", ts)
+	}
+
+	second := &Item{Value: []byte("x"), DelaySecond: -1}
+	q.ids[second] = 11
+	if err := q.onFailed(second); err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].GetDelaySecond() != -2 {
+		t.Fatalf("want dead letter with 2 failures, got %v", dead)
+	}
+	if del := f.callsMatching("DELETE FROM delayq_items WHERE id"); len(del) != 1 || del[0].args[0] != int64(11) {
+		t.Fatalf("dead row should be deleted, got %v", del)
+	}
+}
+
+// TestSQLQueue_GetCancelLengthReclaim 查询、取消、计数与 reclaim 语句
+func TestSQLQueue_GetCancelLengthReclaim(t *testing.T) {
+	f, db := newFakeSQL()
+	var reclaimed int64
+	now := unix()
+	f.handle = func(query string, args []driver.Value) ([]string, [][]driver.Value, int64, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT COUNT(*)"):
+			return []string{"n"}, [][]driver.Value{{int64(4)}}, 0, nil
+		case strings.HasPrefix(query, "SELECT state, execute_at"):
+			if string(args[1].([]byte)) == "missing" {
+				return []string{"state", "execute_at"}, nil, 0, nil
+			}
+			return []string{"state", "execute_at"}, [][]driver.Value{{int64(sqlStateDelayed), now + 60}}, 0, nil
+		case strings.HasPrefix(query, "DELETE"):
+			return nil, nil, 2, nil
+		case strings.HasPrefix(query, "UPDATE"):
+			return nil, nil, 3, nil
+		}
+		return nil, nil, 0, nil
+	}
+	q := newSQLTopicQueue(context.Background(), db, SQLDialectMySQL, "sql-misc", newConfig(
+		WithMonitorCounter(func(metric string, value int64, _ prometheus.Labels) {
+			if metric == MetricReclaim {
+				atomic.AddInt64(&reclaimed, value)
+			}
+		}),
+	))
+	if n := q.Length(); n != 4 {
+		t.Fatalf("want length 4 got %d", n)
+	}
+	remain, ok, err := q.Get([]byte("v"))
+	if err != nil || !ok || remain < 59*time.Second || remain > 60*time.Second {
+		t.Fatalf("unexpected get: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	if _, ok, err = q.Get([]byte("missing")); err != nil || ok {
+		t.Fatalf("missing value: ok=%v err=%v", ok, err)
+	}
+	if canceled, err := q.Cancel([]byte("v")); err != nil || !canceled {
+		t.Fatalf("cancel: %v %v", canceled, err)
+	}
+	if err = q.reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt64(&reclaimed) != 3 {
+		t.Fatalf("want 3 reclaimed got %d", reclaimed)
+	}
+	rc := f.callsMatching("WHERE topic = ? AND state = ? AND lease_until < ?")
+	if len(rc) != 1 || rc[0].args[3] != int64(sqlStateDoing) {
+		t.Fatalf("unexpected reclaim %v", rc)
+	}
+}
@@ -0,0 +1,190 @@
+package delayq
+
+import (
+	"database/sql"
+	"time"
+)
+
+// statusLua 返回分片的详细状态：{doing 集长度, dead 集长度, 已到期数, 最早成员 score, 下一个未到期成员 score}。
+// KEYS: delay 集, doing 集, dead 集；ARGV[1]: 当前时间（秒，可带小数）
+var statusLua = `
+local delay_set, doing_set, dead_set = KEYS[1], KEYS[2], KEYS[3]
+local now = ARGV[1]
+local overdue = redis.call('ZCOUNT', delay_set, '-inf', now)
+local oldest = redis.call('ZRANGE', delay_set, 0, 0, 'WITHSCORES')
+local nxt = redis.call('ZRANGEBYSCORE', delay_set, '(' .. now, '+inf', 'WITHSCORES', 'LIMIT', 0, 1)
+return {redis.call('ZCARD', doing_set), redis.call('ZCARD', dead_set), overdue, oldest[2] or false, nxt[2] or false}
+`
+
+// topicDetail 单个 topic 的详细状态，由支持的后端在 Status 时提供
+type topicDetail struct {
+	// doing / dead 仅在对应后端存在 doing 集 / 死信集时有效
+	doing, dead       int64
+	hasDoing, hasDead bool
+	// overdue 已到计划执行时间但仍在等待派发的 item 数
+	overdue int64
+	// oldestDue 最早的已到期 item 的计划执行时间；零值表示没有到期 item
+	oldestDue time.Time
+	// nextDue 下一个未到期 item 的计划执行时间；零值表示没有
+	nextDue time.Time
+}
+
+// merge 合并分片 / 分层的状态
+func (d *topicDetail) merge(o topicDetail) {
+	d.doing += o.doing
+	d.dead += o.dead
+	d.hasDoing = d.hasDoing || o.hasDoing
+	d.hasDead = d.hasDead || o.hasDead
+	d.overdue += o.overdue
+	if !o.oldestDue.IsZero() && (d.oldestDue.IsZero() || o.oldestDue.Before(d.oldestDue)) {
+		d.oldestDue = o.oldestDue
+	}
+	if !o.nextDue.IsZero() && (d.nextDue.IsZero() || o.nextDue.Before(d.nextDue)) {
+		d.nextDue = o.nextDue
+	}
+}
+
+// statusDetailer 支持详细状态的 TopicQueue 实现
+type statusDetailer interface {
+	statusDetail() (topicDetail, error)
+}
+
+// fillDetail 把 topic 的详细状态写入 Status
+func (s *Status) fillDetail(topic string, d topicDetail, now time.Time) {
+	if d.hasDoing {
+		s.Doing[topic] = d.doing
+	}
+	if d.hasDead {
+		s.Dead[topic] = d.dead
+	}
+	s.Overdue[topic] = d.overdue
+	var age time.Duration
+	if !d.oldestDue.IsZero() && d.overdue > 0 {
+		if age = now.Sub(d.oldestDue); age < 0 {
+			age = 0
+		}
+	}
+	s.OldestOverdue[topic] = age
+	if !d.nextDue.IsZero() {
+		s.NextDue[topic] = d.nextDue
+	}
+}
+
+// statusDetail 遍历各分片时间轮：已到期未派发的节点与下一个到期节点
+func (q *memQueue) statusDetail() (topicDetail, error) {
+	nowMs := nowFunc().UnixMilli()
+	var d topicDetail
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		overdue, oldestMs, nextMs := sh.statusLocked(nowMs)
+		sh.mx.Unlock()
+		part := topicDetail{overdue: overdue}
+		if oldestMs > 0 {
+			part.oldestDue = time.UnixMilli(oldestMs)
+		}
+		if nextMs > 0 {
+			part.nextDue = time.UnixMilli(nextMs)
+		}
+		d.merge(part)
+	}
+	return d, nil
+}
+
+// statusLocked 返回本分片已到期未派发的节点数、其中最早的计划执行时间与下一个未到期节点的计划执行时间
+// （unix 毫秒，0 表示没有）。第 0 层从当前 tick 起按槽位顺序扫描，扫完第一个含未到期节点的槽位即停止；
+// 高层节点只参与下一个到期时间的比较，开销与槽位数及已到期节点数成正比
+func (sh *memShard) statusLocked(nowMs int64) (overdue, oldestMs, nextMs int64) {
+	w := &sh.wheel
+	for k := int64(0); k < wheelSize && nextMs == 0; k++ {
+		for p := w.levels[0][w.slot(0, w.tick+k)]; p != nil; p = p.next {
+			switch {
+			case p.canceled:
+			case p.execAt <= nowMs:
+				overdue++
+				if oldestMs == 0 || p.execAt < oldestMs {
+					oldestMs = p.execAt
+				}
+			case nextMs == 0 || p.execAt < nextMs:
+				nextMs = p.execAt
+			}
+		}
+	}
+	for l := 1; l < wheelLevels; l++ {
+		if n := w.earliest(l); n != nil && (nextMs == 0 || n.execAt < nextMs) {
+			nextMs = n.execAt
+		}
+	}
+	return overdue, oldestMs, nextMs
+}
+
+// statusDetail 对每个分片执行 statusScript 并汇总
+func (q *redisQueue) statusDetail() (topicDetail, error) {
+	nowArg := scoreArg(nowFunc())
+	d := topicDetail{hasDoing: true, hasDead: true}
+	for _, sh := range q.shards {
+		res, err := q.runScript(q.opCtx(), q.statusScript, []string{sh.delaySetKey, sh.doingSetKey, sh.deadSetKey}, nowArg)
+		if err != nil {
+			return topicDetail{}, err
+		}
+		if len(res) < 5 {
+			continue
+		}
+		part := topicDetail{doing: parseInt64(res[0]), dead: parseInt64(res[1]), overdue: parseInt64(res[2])}
+		if res[3] != nil {
+			part.oldestDue = scoreTime(parseFloat64(res[3]))
+		}
+		if res[4] != nil {
+			part.nextDue = scoreTime(parseFloat64(res[4]))
+		}
+		d.merge(part)
+	}
+	return d, nil
+}
+
+// scoreTime 把 delay 集 score 转换为时间；score 为计划执行秒数减去 priority*1e-6 秒，
+// 结果中保留该优先级偏移（priority 每 1000 提前 1ms）
+func scoreTime(score float64) time.Time {
+	return time.UnixMilli(int64(score*1000 + 0.5))
+}
+
+// statusDetail 内存层与 Redis 层合并；doing / dead 来自 Redis
+func (q *tieredQueue) statusDetail() (topicDetail, error) {
+	d, err := q.memQueue.statusDetail()
+	if err != nil {
+		return d, err
+	}
+	rd, err := q.redis.statusDetail()
+	if err != nil {
+		return topicDetail{}, err
+	}
+	d.merge(rd)
+	return d, nil
+}
+
+// statusDetail 按 state 统计 doing 数、已到期数与最早 / 下一个计划执行时间
+func (q *sqlQueue) statusDetail() (topicDetail, error) {
+	now := unix()
+	d := topicDetail{hasDoing: true}
+	var err error
+	if d.doing, err = q.count("SELECT COUNT(*) FROM "+q.table+" WHERE topic = ? AND state = ?", q.topic, sqlStateDoing); err != nil {
+		return topicDetail{}, err
+	}
+	var oldest, next sql.NullInt64
+	if err = q.db.QueryRowContext(q.opCtx(), q.dialect.rebind(
+		"SELECT COUNT(*), MIN(execute_at) FROM "+q.table+" WHERE topic = ? AND state = ? AND execute_at <= ?"),
+		q.topic, sqlStateDelayed, now).Scan(&d.overdue, &oldest); err != nil {
+		return topicDetail{}, err
+	}
+	if err = q.db.QueryRowContext(q.opCtx(), q.dialect.rebind(
+		"SELECT MIN(execute_at) FROM "+q.table+" WHERE topic = ? AND state = ? AND execute_at > ?"),
+		q.topic, sqlStateDelayed, now).Scan(&next); err != nil {
+		return topicDetail{}, err
+	}
+	if oldest.Valid {
+		d.oldestDue = time.Unix(oldest.Int64, 0)
+	}
+	if next.Valid {
+		d.nextDue = time.Unix(next.Int64, 0)
+	}
+	return d, nil
+}
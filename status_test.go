@@ -0,0 +1,111 @@
+package delayq
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+const idxStatus = 20
+
+// TestStatus_MemoryDetail 内存队列报告已到期未派发数、最早到期时长与下一个到期时间（含高层时间轮节点），
+// 没有 doing / 死信集时不出现在 Doing / Dead 中
+func TestStatus_MemoryDetail(t *testing.T) {
+	q := New(WithLogger(NopLogger())).(*queue)
+	defer q.Close()
+	tq := q.newTopicQueue("detail")
+	q.topicQueues.Store(tq.Topic(), tq)
+	mq := tq.(*memQueue)
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	base := time.UnixMilli(time.Now().UnixMilli())
+	nowFunc = func() time.Time { return base }
+	mq.insertOne(&Item{Value: []byte("a")}, 0)
+	mq.insertOne(&Item{Value: []byte("b")}, 1)
+	mq.insertOne(&Item{Value: []byte("c")}, 10)
+	mq.insertOne(&Item{Value: []byte("d")}, 2*wheelSize)
+	nowFunc = func() time.Time { return base.Add(2 * time.Second) }
+
+	s := q.Status()
+	if s.Overdue["detail"] != 2 || s.OldestOverdue["detail"] != 2*time.Second {
+		t.Fatalf("want 2 overdue, oldest 2s, got %d / %v", s.Overdue["detail"], s.OldestOverdue["detail"])
+	}
+	if !s.NextDue["detail"].Equal(base.Add(10 * time.Second)) {
+		t.Fatalf("unexpected next due %v", s.NextDue["detail"])
+	}
+	if _, ok := s.Doing["detail"]; ok {
+		t.Fatal("memory queue has no doing set")
+	}
+	if _, err := mq.Cancel([]byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	if next := q.Status().NextDue["detail"]; !next.Equal(base.Add(2 * wheelSize * time.Second)) {
+		t.Fatalf("next due should fall back to higher wheel level, got %v", next)
+	}
+}
+
+// TestStatus_RedisDetail 每个分片执行 status 脚本，汇总 doing / dead / 已到期数，取最早与最近的 score
+func TestStatus_RedisDetail(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	q := New(WithLogger(NopLogger()), WithRedisScriptBuilder(b), WithRedisShards(2)).(*queue)
+	defer q.Close()
+	tq := q.newTopicQueue("detail-redis")
+	q.topicQueues.Store(tq.Topic(), tq)
+	stubAllScriptsOK(b)
+
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	nowFunc = func() time.Time { return time.Unix(150, 0) }
+	var keys [][]string
+	replies := [][]interface{}{
+		{int64(1), int64(0), int64(2), "100.5", nil},
+		{int64(2), int64(3), int64(1), "99.999999", "200"},
+	}
+	b.scripts[idxStatus].evalShaFn = func(_ context.Context, k []string, args ...interface{}) ([]interface{}, error) {
+		if args[0] != "150" {
+			t.Errorf("unexpected now arg %v", args)
+		}
+		keys = append(keys, k)
+		return replies[len(keys)-1], nil
+	}
+	s := q.Status()
+	topic := "detail-redis"
+	if s.Doing[topic] != 3 || s.Dead[topic] != 3 || s.Overdue[topic] != 3 {
+		t.Fatalf("doing=%d dead=%d overdue=%d", s.Doing[topic], s.Dead[topic], s.Overdue[topic])
+	}
+	if s.OldestOverdue[topic] != 50*time.Second || !s.NextDue[topic].Equal(time.Unix(200, 0)) {
+		t.Fatalf("oldest=%v next=%v", s.OldestOverdue[topic], s.NextDue[topic])
+	}
+	if len(keys) != 2 || !strings.HasPrefix(keys[1][2], "__dq:dead:{detail-redis") {
+		t.Fatalf("unexpected status keys %v", keys)
+	}
+}
+
+// TestStatus_SQLDetail SQL 后端按 state 与 execute_at 统计
+func TestStatus_SQLDetail(t *testing.T) {
+	f, db := newFakeSQL()
+	f.handle = func(query string, _ []driver.Value) ([]string, [][]driver.Value, int64, error) {
+		switch {
+		case strings.Contains(query, "execute_at <="):
+			return []string{"n", "min"}, [][]driver.Value{{int64(2), int64(90)}}, 0, nil
+		case strings.Contains(query, "execute_at >"):
+			return []string{"min"}, [][]driver.Value{{nil}}, 0, nil
+		default:
+			return []string{"n"}, [][]driver.Value{{int64(4)}}, 0, nil
+		}
+	}
+	q := NewSQLTopicQueue(db, SQLDialectSQLite, "detail-sql").(*sqlQueue)
+	original := nowFunc
+	defer func() { nowFunc = original }()
+	nowFunc = func() time.Time { return time.Unix(100, 0) }
+	d, err := q.statusDetail()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.hasDoing || d.doing != 4 || d.overdue != 2 || !d.oldestDue.Equal(time.Unix(90, 0)) || !d.nextDue.IsZero() {
+		t.Fatalf("unexpected detail %+v", d)
+	}
+}
@@ -0,0 +1,350 @@
+package delayq
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTieredThreshold TieredThreshold<=0 时 NewTieredTopicQueue 使用的路由阈值
+	defaultTieredThreshold = time.Minute
+	// defaultTieredPromoteAhead TieredPromoteAhead<=0 时的默认提前拉取时长
+	defaultTieredPromoteAhead = 5 * time.Second
+)
+
+// tieredQueue 分层延迟队列：延迟小于阈值的 item 直接进入进程内时间轮，省去 Redis 往返；
+// 其余 item 写入 Redis 保证持久，并在到期前 TieredPromoteAhead 由 promote ticker
+// 通过 pollScript 认领（搬入 doing 集）后插入时间轮，统一由时间轮派发。
+//
+// 拉入内存的 item 在 Redis 中处于 doing 状态：处理成功后从 Redis 清除；失败时按 Redis 语义
+// 累加失败计数并放回 delay 集；进程退出未处理的由 reclaim 回收。内存层 item 的重试留在内存。
+type tieredQueue struct {
+	*memQueue
+	redis *redisQueue
+
+	threshold    time.Duration
+	promoteAhead time.Duration
+
+	// promoted 从 Redis 拉入内存、尚未 ack 的 item
+	promotedMu sync.Mutex
+	promoted   map[*Item]struct{}
+}
+
+// NewTieredTopicQueue 构造一个内存 + Redis 的分层延迟队列：DelaySecond 小于 TieredThreshold 的 item
+// 保存在进程内，其余写入 Redis，并在即将到期时拉入内存派发。Length/Get/Cancel 覆盖两层。
+// 必须通过 WithRedisScriptBuilder 注入 Redis 客户端适配器。
+func NewTieredTopicQueue(ctx context.Context, topic string, opts ...Option) TopicQueue {
+	return newTieredTopicQueue(ctx, topic, newConfig(opts...))
+}
+
+func newTieredTopicQueue(ctx context.Context, topic string, opts *Options) *tieredQueue {
+	q := &tieredQueue{
+		memQueue:     newMemoryTopicQueue(ctx, topic, opts).(*memQueue),
+		redis:        newRedisTopicQueue(ctx, topic, opts).(*redisQueue),
+		threshold:    opts.GetTieredThreshold(),
+		promoteAhead: opts.GetTieredPromoteAhead(),
+		promoted:     make(map[*Item]struct{}),
+	}
+	if q.threshold <= 0 {
+		q.threshold = defaultTieredThreshold
+	}
+	if q.promoteAhead <= 0 {
+		q.promoteAhead = defaultTieredPromoteAhead
+	}
+	// 限流与 drain 统一在分层入口检查，Redis 层不再重复扣 token
+	q.redis.limiter = nil
+	q.failed = q.onFailed
+	q.success = q.onSuccess
+	q.tickerRetryAfter = q.redis.tickerRetryAfter
+	// 两层共享 Redis 中的历史，item 在内存层与 Redis 层之间移动时历史保持连续
+	q.history = q.redis.history
+	if q.redis.heartbeatInterval() > 0 {
+		q.onItemStart = q.startHeartbeat
+	}
+	return q
+}
+
+// inMemory 判断延迟 delaySecond 秒的 item 是否留在内存层
+func (q *tieredQueue) inMemory(delaySecond int64) bool {
+	return time.Duration(delaySecond)*time.Second < q.threshold
+}
+
+// Push 按 DelaySecond 路由：小于阈值进入时间轮，否则写入 Redis
+func (q *tieredQueue) Push(item *Item) error {
+	if q.isClosed() {
+		return ErrTopicQueueHasClosed
+	}
+	if err := q.prepareItem(item); err != nil {
+		return err
+	}
+	delaySecond := item.GetDelaySecond()
+	if delaySecond < 0 {
+		delaySecond = 0
+	}
+	if !q.inMemory(delaySecond) {
+		// item 已在分层入口完成 normalize，直接写入 Redis 层，避免 PushInterceptor 重复执行
+		return q.redis.addOrSpool([]*Item{item}, []int64{unix() + delaySecond})
+	}
+	q.insertOne(item, delaySecond)
+	q.notifyPushed(item)
+	return nil
+}
+
+// PushBatch 批量推送：先整体校验与扣 token，再按阈值拆分为内存批次与 Redis 批次。
+// 先写入 Redis 批次，失败时返回错误且内存批次不写入，调用方重试整批不会在内存中产生重复 item。
+func (q *tieredQueue) PushBatch(items []*Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if q.isClosed() {
+		return ErrTopicQueueHasClosed
+	}
+	if q.draining.Get() == 1 {
+		return ErrDraining
+	}
+	if q.limiter != nil && !q.limiter.AllowN(len(items)) {
+		q.monitorCount(MetricRateLimited, len(items))
+		return ErrRateLimited
+	}
+	var mem, remote []*Item
+	var delays, execAts []int64
+	now := unix()
+	for _, it := range items {
+		if err := q.prepareItemNoRate(it); err != nil {
+			return err
+		}
+		d := it.GetDelaySecond()
+		if d < 0 {
+			d = 0
+		}
+		if q.inMemory(d) {
+			mem = append(mem, it)
+			delays = append(delays, d)
+		} else {
+			remote = append(remote, it)
+			execAts = append(execAts, now+d)
+		}
+	}
+	if len(remote) > 0 {
+		if err := q.redis.addOrSpool(remote, execAts); err != nil {
+			return err
+		}
+	}
+	if len(mem) > 0 {
+		q.insert(mem, delays)
+		q.notifyPushed(mem...)
+	}
+	return nil
+}
+
+// Length 返回两层中等待执行的 item 数之和；已拉入内存的 item 只在内存层计数
+func (q *tieredQueue) Length() int64 {
+	return q.memQueue.Length() + q.redis.Length()
+}
+
+// Get 先查内存层（含已拉入内存的 item），未命中再查 Redis
+func (q *tieredQueue) Get(value []byte) (remaining time.Duration, exists bool, err error) {
+	if remaining, exists, err = q.memQueue.Get(value); err != nil || exists {
+		return remaining, exists, err
+	}
+	return q.redis.Get(value)
+}
+
+// Cancel 同时取消两层中匹配 value 的 item；已拉入内存的 item 一并从 Redis doing 集删除
+func (q *tieredQueue) Cancel(value []byte) (bool, error) {
+	memCanceled, err := q.memQueue.Cancel(value)
+	if err != nil {
+		return false, err
+	}
+	q.promotedMu.Lock()
+	for it := range q.promoted {
+		if bytes.Equal(it.GetValue(), value) {
+			delete(q.promoted, it)
+		}
+	}
+	q.promotedMu.Unlock()
+	redisCanceled, err := q.redis.Cancel(value)
+	return memCanceled || redisCanceled, err
+}
+
+// setMetrics 内存层与 Redis 层共享外观层注入的原生指标
+func (q *tieredQueue) setMetrics(m *nativeMetrics) {
+	q.memQueue.setMetrics(m)
+	q.redis.setMetrics(m)
+}
+
+// promote 把各分片中 TieredPromoteAhead 内到期的 item 认领到 doing 集并插入时间轮。
+// doing 集 score 覆盖提前量与 VisibilityTimeout，避免尚未派发就被 reclaim。
+func (q *tieredQueue) promote() error {
+	now := unix()
+	ahead := int64((q.promoteAhead + time.Second - 1) / time.Second)
+	visTimeout := int64(q.opts.GetVisibilityTimeout() / time.Second)
+	if visTimeout <= 0 {
+		visTimeout = 1
+	}
+	var firstErr error
+	for _, sh := range q.redis.shards {
+		items, scores, err := q.redis.claimShard(sh, now+ahead, now+ahead+visTimeout)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		q.promotedMu.Lock()
+		for _, it := range items {
+			q.promoted[it] = struct{}{}
+		}
+		q.promotedMu.Unlock()
+		delays := make([]int64, len(items))
+		execAts := make([]int64, len(items))
+		for i, it := range items {
+			execTs := scoreToExecTs(scores[i])
+			it.Topic = q.topic
+			it.Priority = priorityFromScore(scores[i], execTs)
+			if d := execTs - now; d > 0 {
+				delays[i] = d
+			}
+			execAts[i] = execTs * 1000
+		}
+		// 保留 Redis 中记录的计划执行时间，被 reclaim 放回的 item 派发延迟仍从原时间起算
+		q.insertAt(items, delays, execAts)
+		q.monitorCount(MetricTieredPromote, len(items))
+	}
+	return firstErr
+}
+
+// isPromoted 判断 item 是否来自 Redis 层
+func (q *tieredQueue) isPromoted(item *Item) bool {
+	q.promotedMu.Lock()
+	defer q.promotedMu.Unlock()
+	_, ok := q.promoted[item]
+	return ok
+}
+
+// takePromoted 判断 item 是否来自 Redis 层，是则移出 promoted
+func (q *tieredQueue) takePromoted(item *Item) bool {
+	q.promotedMu.Lock()
+	defer q.promotedMu.Unlock()
+	if _, ok := q.promoted[item]; !ok {
+		return false
+	}
+	delete(q.promoted, item)
+	return true
+}
+
+// onSuccess 来自 Redis 层的 item 从 doing 集与失败计数中清除
+func (q *tieredQueue) onSuccess(item *Item) error {
+	if q.takePromoted(item) {
+		return q.redis.onSuccess(item)
+	}
+	return q.memQueue.onSuccess(item)
+}
+
+// onFailed 来自 Redis 层的 item 按 Redis 语义放回 delay 集，内存层 item 在内存中重试
+func (q *tieredQueue) onFailed(item *Item) error {
+	if q.takePromoted(item) {
+		return q.redis.onFailed(item)
+	}
+	return q.memQueue.onFailed(item)
+}
+
+// startHeartbeat 仅为来自 Redis 层的 item 启动 doing 集心跳
+func (q *tieredQueue) startHeartbeat(item *Item) func() {
+	if !q.isPromoted(item) {
+		return nil
+	}
+	return q.redis.startHeartbeat(item)
+}
+
+// tickers 时间轮推进、promote、reclaim，按 Redis 配置追加租约续约、本地缓冲补写与共享心跳
+func (q *tieredQueue) tickers() []ticker {
+	ts := []ticker{
+		{d: q.redis.pollInterval(), f: q.promote},
+		{d: q.redis.reclaimInterval(), f: q.redis.reclaim},
+	}
+	ts = append(ts, q.wheelTickers()...)
+	if q.redis.consumerID != "" {
+		ts = append(ts, ticker{d: q.redis.leaseRenewInterval(), f: q.redis.renewLease})
+	}
+	if q.redis.spool != nil {
+		ts = append(ts, ticker{d: q.redis.pollInterval(), f: q.redis.flushSpool})
+	}
+	if d := q.redis.heartbeatInterval(); d > 0 && q.redis.poolSize > 0 {
+		ts = append(ts, ticker{d: d, f: q.redis.heartbeatAll})
+	}
+	return ts
+}
+
+func (q *tieredQueue) Start(f func(item *Item) error) error {
+	return q.start(f, q.tickers()...)
+}
+
+// StartManualAck 启动手动 ack 模式
+func (q *tieredQueue) StartManualAck(f func(item *Item, ack Acker)) error {
+	q.manualHandler = f
+	return q.start(func(*Item) error { return nil }, q.tickers()...)
+}
+
+// Drain 等待两层全部消化：时间轮、Redis delay/doing 集、本地缓冲与在途 handler
+func (q *tieredQueue) Drain(ctx context.Context) error {
+	return q.drain(ctx, func() int64 { return q.memQueue.Length() + q.redis.lengthAll() })
+}
+
+// Close 关闭队列并等待在途 handler 返回；已拉入内存但尚未派发的 item 从时间轮摘除，
+// 其 doing 集 score 置为当前时间，由 reclaim 立即放回 delay 集（保留失败计数）。
+// Redis 层本地缓冲的处理与 redisQueue.Close 一致。
+func (q *tieredQueue) Close() error {
+	err := q.close()
+	if q.redis.spool != nil {
+		q.redis.closeSpool()
+	}
+	if err != nil {
+		return err
+	}
+	q.releasePromoted()
+	if q.redis.consumerID != "" {
+		q.redis.releaseLease()
+	}
+	return nil
+}
+
+func (q *tieredQueue) releasePromoted() {
+	q.promotedMu.Lock()
+	pending := q.promoted
+	q.promoted = make(map[*Item]struct{})
+	q.promotedMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	for _, sh := range q.shards {
+		sh.mx.Lock()
+		sh.wheel.removeIf(func(p *wheelNode) bool {
+			if _, ok := pending[p.item]; ok {
+				sh.unlinkedLocked(p)
+				return true
+			}
+			return false
+		})
+		sh.mx.Unlock()
+	}
+	now := unix()
+	for it := range pending {
+		value := it.GetValue()
+		if _, err := q.redis.runScript(q.redis.opCtx(), q.redis.heartbeatScript,
+			[]string{q.redis.shardOf(value).doingSetKey}, value, now); err != nil {
+			q.log.Warnf("topic=%s release promoted item error: %v", q.topic, err)
+		}
+	}
+}
+
+// spoolDepth 返回 Redis 层本地缓冲深度，供 Status 使用
+func (q *tieredQueue) spoolDepth() int64 { return q.redis.spoolDepth() }
+
+// consumerInFlight 返回 Redis 层各消费者持有的 doing 集 item 数，供 Status 使用
+func (q *tieredQueue) consumerInFlight() map[string]int64 { return q.redis.consumerInFlight() }
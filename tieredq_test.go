@@ -0,0 +1,243 @@
+package delayq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	idxGet    = 6
+	idxCancel = 7
+)
+
+// newTestTieredQueue 构造所有脚本默认成功的分层队列，返回脚本工厂便于按需覆盖
+func newTestTieredQueue(t *testing.T, opts ...Option) (*tieredQueue, *fakeScriptBuilder) {
+	t.Helper()
+	b := &fakeScriptBuilder{}
+	opts = append([]Option{WithRedisScriptBuilder(b), WithLogger(NopLogger()), WithTieredThreshold(time.Minute)}, opts...)
+	q := newTieredTopicQueue(context.Background(), "tiered", newConfig(opts...))
+	stubAllScriptsOK(b)
+	b.scripts[idxPoll].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{}, nil
+	}
+	return q, b
+}
+
+// stubPollOnce 让 pollScript 第一次调用返回 res，并记录调用参数
+func stubPollOnce(b *fakeScriptBuilder, res []interface{}) func() []interface{} {
+	var mu sync.Mutex
+	var first []interface{}
+	b.scripts[idxPoll].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first != nil {
+			return []interface{}{}, nil
+		}
+		first = args
+		return res, nil
+	}
+	return func() []interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return first
+	}
+}
+
+// TestTieredQueue_RoutesByThreshold 短延迟进入时间轮，长延迟写入 Redis；PushBatch 按阈值拆分
+func TestTieredQueue_RoutesByThreshold(t *testing.T) {
+	q, b := newTestTieredQueue(t)
+	adds := recordAdds(b)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	now := unix()
+	if err := q.Push(&Item{Value: []byte("short"), DelaySecond: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Push(&Item{Value: []byte("long"), DelaySecond: 120}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.PushBatch([]*Item{{Value: []byte("s2"), DelaySecond: 59}, {Value: []byte("l2"), DelaySecond: 60}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.memQueue.Length(); n != 2 {
+		t.Fatalf("want 2 items in memory got %d", n)
+	}
+	values, scores := adds()
+	if len(values) != 2 || values[0] != "long" || values[1] != "l2" {
+		t.Fatalf("want long items written to redis, got %v", values)
+	}
+	if ts := scoreToExecTs(scores[0]); ts < now+119 || ts > now+121 {
+		t.Fatalf("redis score should be now+120, got %d", ts)
+	}
+}
+
+// TestTieredQueue_PushBatchRedisFailure Redis 批次写入失败时整批返回错误，内存批次不写入，重试不会重复
+func TestTieredQueue_PushBatchRedisFailure(t *testing.T) {
+	q, b := newTestTieredQueue(t)
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	redisDown(b)
+	batch := []*Item{{Value: []byte("s"), DelaySecond: 5}, {Value: []byte("l"), DelaySecond: 600}}
+	if err := q.PushBatch(batch); err == nil {
+		t.Fatal("want redis error")
+	}
+	if n := q.memQueue.Length(); n != 0 {
+		t.Fatalf("memory half should not be inserted on redis failure, got %d", n)
+	}
+	recordAdds(b)
+	if err := q.PushBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.memQueue.Length(); n != 1 {
+		t.Fatalf("retry should insert the memory half once, got %d", n)
+	}
+}
+
+// TestTieredQueue_PromoteBeforeDue Redis 中即将到期的 item 被认领到 doing 集并插入时间轮，保留优先级与失败次数
+func TestTieredQueue_PromoteBeforeDue(t *testing.T) {
+	q, b := newTestTieredQueue(t, WithTieredPromoteAhead(5*time.Second), WithVisibilityTimeout(30*time.Second))
+	now := unix()
+	args := stubPollOnce(b, []interface{}{"p", itemScore(now+3, 7), int64(1), int64(0)})
+	if err := q.promote(); err != nil {
+		t.Fatal(err)
+	}
+	got := args()
+	if got[0] != now+5 || got[1] != now+5+30 {
+		t.Fatalf("want claim up to now+5 with doing score now+35, got %v (now=%d)", got, now)
+	}
+	remain, ok, err := q.Get([]byte("p"))
+	if err != nil || !ok || remain < 2*time.Second || remain > 3*time.Second {
+		t.Fatalf("promoted item should be in memory: remain=%v ok=%v err=%v", remain, ok, err)
+	}
+	var item *Item
+	for it := range q.promoted {
+		item = it
+	}
+	if item == nil || item.GetPriority() != 7 || item.GetDelaySecond() != -1 || item.GetTopic() != "tiered" {
+		t.Fatalf("unexpected promoted item %v", item)
+	}
+	if n := q.Length(); n != 1 {
+		t.Fatalf("promoted item should be counted once, got %d", n)
+	}
+}
+
+// TestTieredQueue_AckRoutesToOrigin 来自 Redis 的 item 成功后 ack 到 Redis、失败后按 Redis 语义重试；内存 item 不访问 Redis
+func TestTieredQueue_AckRoutesToOrigin(t *testing.T) {
+	q, b := newTestTieredQueue(t, WithRetryTimes(3))
+	var acked, failed int32
+	b.scripts[idxAckSuccess].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		atomic.AddInt32(&acked, 1)
+		return []interface{}{true}, nil
+	}
+	b.scripts[idxAckFailed].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		atomic.AddInt32(&failed, 1)
+		return []interface{}{int64(1)}, nil
+	}
+	now := unix()
+	stubPollOnce(b, []interface{}{"ok", itemScore(now, 0), int64(0), int64(0), "bad", itemScore(now, 0), int64(0), int64(0)})
+
+	var handled int32
+	if err := q.Start(func(item *Item) error {
+		atomic.AddInt32(&handled, 1)
+		if string(item.GetValue()) == "bad" {
+			return errors.New("boom")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push(&Item{Value: []byte("mem")}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 3000, func() bool { return atomic.LoadInt32(&handled) == 3 })
+	waitUntil(t, 1000, func() bool { return atomic.LoadInt32(&acked) == 1 && atomic.LoadInt32(&failed) == 1 })
+	if n := q.memQueue.Length(); n != 0 {
+		t.Fatalf("redis item retry should not stay in memory, length=%d", n)
+	}
+	q.promotedMu.Lock()
+	defer q.promotedMu.Unlock()
+	if len(q.promoted) != 0 {
+		t.Fatalf("promoted should be cleared after ack, got %d", len(q.promoted))
+	}
+}
+
+// TestTieredQueue_CancelBothTiers Cancel 同时作用于时间轮与 Redis
+func TestTieredQueue_CancelBothTiers(t *testing.T) {
+	q, b := newTestTieredQueue(t)
+	var redisCancels int32
+	b.scripts[idxCancel].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		atomic.AddInt32(&redisCancels, 1)
+		return []interface{}{int64(0)}, nil
+	}
+	b.scripts[idxGet].evalShaFn = func(context.Context, []string, ...interface{}) ([]interface{}, error) {
+		return []interface{}{int64(0), int64(0)}, nil
+	}
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if err := q.Push(&Item{Value: []byte("c"), DelaySecond: 10}); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := q.Cancel([]byte("c"))
+	if err != nil || !canceled {
+		t.Fatalf("cancel: %v %v", canceled, err)
+	}
+	if atomic.LoadInt32(&redisCancels) != 1 {
+		t.Fatal("cancel should also reach redis")
+	}
+	if _, ok, _ := q.Get([]byte("c")); ok {
+		t.Fatal("canceled item should not be found")
+	}
+}
+
+// TestTieredQueue_CloseReleasesPromoted Close 把未派发的已拉取 item 从时间轮摘除，并把 doing 集 score 置为当前时间
+func TestTieredQueue_CloseReleasesPromoted(t *testing.T) {
+	q, b := newTestTieredQueue(t)
+	now := unix()
+	stubPollOnce(b, []interface{}{"later", itemScore(now+4, 0), int64(0), int64(0)})
+	var released []interface{}
+	b.scripts[idxHeartbeat].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		released = args
+		return []interface{}{int64(1)}, nil
+	}
+	if err := q.Start(func(*Item) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 2000, func() bool { return q.memQueue.Length() == 1 })
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := q.memQueue.Length(); n != 0 {
+		t.Fatalf("promoted item should be removed from wheel, length=%d", n)
+	}
+	if len(released) != 2 || string(released[0].([]byte)) != "later" || released[1].(int64) > unix() {
+		t.Fatalf("doing score should be reset to now, got %v", released)
+	}
+}
+
+// TestTieredQueue_NewWithThreshold New 同时配置 RedisScriptBuilder 与 TieredThreshold 时使用分层实现
+func TestTieredQueue_NewWithThreshold(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	q := New(WithRedisScriptBuilder(b), WithTieredThreshold(time.Minute), WithBreakerFailureThreshold(1)).(*queue)
+	tq, ok := q.newTopicQueue("tiered-new").(*tieredQueue)
+	if !ok {
+		t.Fatal("want tiered queue")
+	}
+	if tq.redis.breaker != q.breaker || tq.tickerRetryAfter == nil {
+		t.Fatal("tiered queue should share the queue breaker")
+	}
+	if _, ok = New(WithRedisScriptBuilder(b)).(*queue).newTopicQueue("plain").(*redisQueue); !ok {
+		t.Fatal("without threshold New should keep the redis backend")
+	}
+}
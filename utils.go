@@ -10,6 +10,43 @@ var nowFunc = time.Now
 
 func unix() int64 { return nowFunc().Unix() }
 
+// heartbeatIntervalFor 返回 doing 租约心跳间隔；0 表示禁用。
+// HeartbeatInterval<0 显式禁用；>0 使用配置值；0 时默认 VisibilityTimeout/3，至少 1s
+func heartbeatIntervalFor(opts *Options) time.Duration {
+	hi := opts.GetHeartbeatInterval()
+	if hi < 0 {
+		return 0 // 显式禁用
+	}
+	if hi > 0 {
+		return hi
+	}
+	vt := opts.GetVisibilityTimeout()
+	if vt <= 0 {
+		return 0
+	}
+	d := vt / 3
+	if d < time.Second {
+		d = time.Second
+	}
+	return d
+}
+
+// pollIntervalFor 返回 poll 轮询间隔；<=0 时回退到 1s
+func pollIntervalFor(opts *Options) time.Duration {
+	if d := opts.GetPollInterval(); d > 0 {
+		return d
+	}
+	return 1 * time.Second
+}
+
+// reclaimIntervalFor 返回 reclaim 轮询间隔；<=0 时回退到 1s
+func reclaimIntervalFor(opts *Options) time.Duration {
+	if d := opts.GetReclaimInterval(); d > 0 {
+		return d
+	}
+	return 1 * time.Second
+}
+
 // computeRetryDelay 根据失败次数和配置计算下次重试延迟
 // failedCount 从 1 开始（即第 1 次失败后的延迟）
 // 优先使用 opts.RetryIntervalFunc；否则根据 RetryInterval * RetryBackoff^(failedCount-1) 计算，
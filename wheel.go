@@ -0,0 +1,183 @@
+package delayq
+
+// wheelSize 每层时间轮的槽位数
+const wheelSize = 3600
+
+// wheelLevels 分层时间轮层数。第 i 层每个槽位跨度为 wheelSize^i 秒：
+// 第 0 层 1 秒 × 3600，第 1 层 1 小时 × 3600（约 150 天），第 2 层 150 天 × 3600。
+const wheelLevels = 3
+
+// wheelSpans 各层单个槽位的跨度（tick 数）
+var wheelSpans = [wheelLevels]int64{1, wheelSize, wheelSize * wheelSize}
+
+type wheelNode struct {
+	// expire 到期的绝对 tick
+	expire   int64
+	priority int32
+	// seq 入队序号，同 priority 时小者先派发
+	seq int64
+	// execAt 计划执行时间（unix 毫秒），派发时用于计算延迟
+	execAt   int64
+	canceled bool // Cancel 标记，ticker 时跳过，compactCanceled 时摘除
+	item     *Item
+	next     *wheelNode
+}
+
+// timingWheel 分层时间轮。节点按绝对到期 tick 放入能容纳其剩余延迟的最低一层；
+// 高层槽位轮到时整体下沉（cascade）到低层，每个节点至多下沉 wheelLevels-1 次。
+// 因此 add 为 O(1)（第 0 层按 (priority 降序, seq 升序) 有序插入），advance 的开销与到期及下沉的节点数成正比，
+// 不再像单层轮那样每秒遍历槽位中所有远期节点。调用方负责加锁。
+type timingWheel struct {
+	// tick 下一个待处理的 tick（秒）
+	tick   int64
+	levels [wheelLevels][wheelSize]*wheelNode
+	// tails 各槽位链表的尾节点，使按 seq 递增的追加为 O(1)
+	tails [wheelLevels][wheelSize]*wheelNode
+}
+
+// before 判断 a 是否应排在 b 之前：priority 高者优先，同 priority 时 seq 小者（先入队）优先
+func (a *wheelNode) before(b *wheelNode) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.seq < b.seq
+}
+
+// slot 返回 expire 在第 level 层的槽位
+func (w *timingWheel) slot(level int, expire int64) int {
+	return int((expire / wheelSpans[level]) % wheelSize)
+}
+
+// add 按 n.expire 把节点挂到对应层的槽位。第 0 层按 (priority 降序, seq 升序) 插入，
+// 同 priority 的节点先进先出；常见的 seq 递增插入直接追加到队尾，O(1)。高层直接追加，下沉时再排序。
+func (w *timingWheel) add(n *wheelNode) {
+	if n.expire < w.tick {
+		n.expire = w.tick
+	}
+	delta := n.expire - w.tick
+	level := wheelLevels - 1
+	for l := 1; l < wheelLevels; l++ {
+		if delta < wheelSpans[l] {
+			level = l - 1
+			break
+		}
+	}
+	idx := w.slot(level, n.expire)
+	head, tail := w.levels[level][idx], w.tails[level][idx]
+	n.next = nil
+	switch {
+	case head == nil:
+		w.levels[level][idx], w.tails[level][idx] = n, n
+	case level > 0 || !n.before(tail):
+		tail.next = n
+		w.tails[level][idx] = n
+	case n.before(head):
+		n.next = head
+		w.levels[level][idx] = n
+	default:
+		prev := head
+		for !n.before(prev.next) {
+			prev = prev.next
+		}
+		n.next = prev.next
+		prev.next = n
+	}
+}
+
+// advance 处理当前 tick：先把轮到的高层槽位下沉，再摘下第 0 层当前槽位并推进 tick。
+// 返回的链表即本 tick 到期的全部节点（按 priority 降序），节点的 next 仍然有效。
+func (w *timingWheel) advance() *wheelNode {
+	t := w.tick
+	for l := wheelLevels - 1; l > 0; l-- {
+		if t%wheelSpans[l] != 0 {
+			continue
+		}
+		idx := w.slot(l, t)
+		var nodes []*wheelNode
+		for p := w.levels[l][idx]; p != nil; p = p.next {
+			nodes = append(nodes, p)
+		}
+		w.levels[l][idx], w.tails[l][idx] = nil, nil
+		// 下沉的节点早于目标槽位中已有的同到期节点入队，且高层槽位大体按入队顺序排列；
+		// 逆序下沉使同 priority 的节点通常直接插到队首，避免逐个遍历
+		for i := len(nodes) - 1; i >= 0; i-- {
+			w.add(nodes[i])
+		}
+	}
+	idx := w.slot(0, t)
+	due := w.levels[0][idx]
+	w.levels[0][idx], w.tails[0][idx] = nil, nil
+	w.tick++
+	return due
+}
+
+// remaining 返回节点距到期的秒数
+func (w *timingWheel) remaining(n *wheelNode) int64 {
+	if d := n.expire - w.tick; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// earliest 返回第 level 层中到期最早的未取消节点：从当前 tick 所在槽位起按时间顺序找到第一个
+// 含未取消节点的槽位，再在槽位内取 expire 最小者。没有节点时返回 nil。
+// 高层中当前 tick 所在的槽位已在轮到时下沉，其中只可能是绕回一整圈的远期节点，
+// 因此第 1 层起从下一个槽位开始，最后才检查该槽位
+func (w *timingWheel) earliest(level int) *wheelNode {
+	base := w.tick / wheelSpans[level]
+	if level > 0 {
+		base++
+	}
+	for k := int64(0); k < wheelSize; k++ {
+		var min *wheelNode
+		for p := w.levels[level][(base+k)%wheelSize]; p != nil; p = p.next {
+			if !p.canceled && (min == nil || p.expire < min.expire) {
+				min = p
+			}
+		}
+		if min != nil {
+			return min
+		}
+	}
+	return nil
+}
+
+// each 遍历所有节点（顺序不保证）
+func (w *timingWheel) each(fn func(n *wheelNode)) {
+	for l := range w.levels {
+		for i := range w.levels[l] {
+			for p := w.levels[l][i]; p != nil; p = p.next {
+				fn(p)
+			}
+		}
+	}
+}
+
+// removeIf 摘除所有使 fn 返回 true 的节点
+func (w *timingWheel) removeIf(fn func(n *wheelNode) bool) {
+	for l := range w.levels {
+		for i := range w.levels[l] {
+			dummy := &wheelNode{next: w.levels[l][i]}
+			prev := dummy
+			for prev.next != nil {
+				if p := prev.next; fn(p) {
+					prev.next = p.next
+					continue
+				}
+				prev = prev.next
+			}
+			w.levels[l][i] = dummy.next
+			if prev == dummy {
+				w.tails[l][i] = nil
+			} else {
+				w.tails[l][i] = prev
+			}
+		}
+	}
+}
+
+// reset 清空所有节点，tick 保持不变
+func (w *timingWheel) reset() {
+	w.levels = [wheelLevels][wheelSize]*wheelNode{}
+	w.tails = [wheelLevels][wheelSize]*wheelNode{}
+}
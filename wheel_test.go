@@ -0,0 +1,92 @@
+package delayq
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// drainWheel 推进时间轮直到取出 want 个节点，校验每个节点恰好在其 expire 对应的 tick 取出
+func drainWheel(t *testing.T, w *timingWheel, want int, maxTicks int64) {
+	t.Helper()
+	got := 0
+	for i := int64(0); i < maxTicks && got < want; i++ {
+		tick := w.tick
+		for p := w.advance(); p != nil; p = p.next {
+			if p.expire != tick {
+				t.Fatalf("node expiring at %d dispatched at tick %d", p.expire, tick)
+			}
+			got++
+		}
+	}
+	if got != want {
+		t.Fatalf("want %d nodes got %d", want, got)
+	}
+}
+
+// TestTimingWheel_CascadeAcrossLevels 跨越第 1、2 层边界的节点经下沉后在准确的 tick 到期
+func TestTimingWheel_CascadeAcrossLevels(t *testing.T) {
+	w := &timingWheel{tick: wheelSpans[2] - 10}
+	deltas := []int64{0, 1, 9, 10, 11, wheelSize - 1, wheelSize, wheelSize + 7, 3*wheelSize + 1, wheelSpans[2] + 5}
+	for _, d := range deltas {
+		w.add(&wheelNode{expire: w.tick + d})
+	}
+	if w.levels[2][w.slot(2, w.tick+wheelSpans[2]+5)] == nil {
+		t.Fatal("delay beyond level 1 range should be placed on level 2")
+	}
+	drainWheel(t, w, len(deltas), wheelSpans[2]+10)
+	w.each(func(*wheelNode) { t.Fatal("wheel should be empty") })
+}
+
+// TestTimingWheel_RandomDelays 随机起点与延迟下所有节点按时到期，remaining 与剩余延迟一致
+func TestTimingWheel_RandomDelays(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	w := &timingWheel{tick: r.Int63n(wheelSpans[2])}
+	const n = 2000
+	for i := 0; i < n; i++ {
+		d := r.Int63n(4 * wheelSize)
+		node := &wheelNode{expire: w.tick + d}
+		w.add(node)
+		if w.remaining(node) != d {
+			t.Fatalf("remaining want %d got %d", d, w.remaining(node))
+		}
+	}
+	drainWheel(t, w, n, 4*wheelSize)
+}
+
+// TestTimingWheel_PriorityAfterCascade 从高层下沉到第 0 层的节点仍按 priority 降序排列
+func TestTimingWheel_PriorityAfterCascade(t *testing.T) {
+	w := &timingWheel{}
+	for _, p := range []int32{1, 5, 3, 10, 2} {
+		w.add(&wheelNode{expire: 2 * wheelSize, priority: p})
+	}
+	for i := 0; i < 2*wheelSize; i++ {
+		if w.advance() != nil {
+			t.Fatalf("nothing should be due at tick %d", i)
+		}
+	}
+	var prio []int32
+	for p := w.advance(); p != nil; p = p.next {
+		prio = append(prio, p.priority)
+	}
+	if len(prio) != 5 || prio[0] != 10 || prio[4] != 1 {
+		t.Fatalf("unexpected order %v", prio)
+	}
+}
+
+// TestTimingWheel_EarliestSkipsWrappedSlot 高层当前槽位中绕回一圈的远期节点不会被当作最早节点
+func TestTimingWheel_EarliestSkipsWrappedSlot(t *testing.T) {
+	w := &timingWheel{tick: 5*wheelSize + 100}
+	far := &wheelNode{expire: w.tick + wheelSpans[2] - 50}
+	w.add(far)
+	if w.slot(1, far.expire) != w.slot(1, w.tick) || w.levels[1][w.slot(1, far.expire)] != far {
+		t.Fatal("delay just under 150 days should wrap into the current level 1 slot")
+	}
+	if got := w.earliest(1); got != far {
+		t.Fatalf("only node should be earliest, got %+v", got)
+	}
+	near := &wheelNode{expire: w.tick + 2*wheelSize}
+	w.add(near)
+	if got := w.earliest(1); got != near {
+		t.Fatalf("want 2h node as earliest, got expire=%d", got.expire)
+	}
+}
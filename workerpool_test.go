@@ -0,0 +1,208 @@
+package delayq
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWorkerPool_BoundedConcurrency 同时执行的 handler 不超过 worker 数，MaxConcurrency 不再生效
+func TestWorkerPool_BoundedConcurrency(t *testing.T) {
+	const workers, total = 3, 30
+	var running, peak int64
+	var wg sync.WaitGroup
+	wg.Add(total)
+	tp := NewMemoryTopicQueue(context.Background(), "pool-bound",
+		WithLogger(NopLogger()), WithWorkerPool(workers), WithMaxConcurrency(100))
+	if err := tp.Start(func(*Item) error {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt64(&running, -1)
+		wg.Done()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	for i := 0; i < total; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("b%d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitGroupTimeout(t, &wg, 5*time.Second)
+	if p := atomic.LoadInt64(&peak); p != workers {
+		t.Fatalf("want peak concurrency %d got %d", workers, p)
+	}
+}
+
+// TestWorkerPool_Drain 派发阻塞在忙碌的 worker 上时 Drain 仍等待所有 item 执行完毕
+func TestWorkerPool_Drain(t *testing.T) {
+	var handled int64
+	tp := NewMemoryTopicQueue(context.Background(), "pool-drain", WithLogger(NopLogger()), WithWorkerPool(2))
+	if err := tp.Start(func(*Item) error {
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt64(&handled, 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	for i := 0; i < 50; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("d%d", i)), DelaySecond: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&handled); n != 50 {
+		t.Fatalf("want 50 handled got %d", n)
+	}
+}
+
+// TestWorkerPool_CloseWaitsHandlers Close 等待执行中的 handler 返回，worker 与派发方全部退出，pendingExec 归零
+func TestWorkerPool_CloseWaitsHandlers(t *testing.T) {
+	before := runtime.NumGoroutine()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var finished int64
+	tp := NewMemoryTopicQueue(context.Background(), "pool-close", WithLogger(NopLogger()), WithWorkerPool(1))
+	if err := tp.Start(func(*Item) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		atomic.AddInt64(&finished, 1)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// 唯一的 worker 阻塞后，其余 item 的派发会阻塞在通道上
+	for i := 0; i < 5; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("c%d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("handler not started")
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- tp.Close() }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while a handler was still running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if n := atomic.LoadInt64(&finished); n < 1 {
+		t.Fatalf("running handler should finish before Close returns, got %d", n)
+	}
+	mq := tp.(*memQueue)
+	if p, f := mq.pendingExec.Get(), mq.InFlight(); p != 0 || f != 0 {
+		t.Fatalf("counters not reset: pendingExec=%d inFlight=%d", p, f)
+	}
+	waitUntil(t, 2000, func() bool { return runtime.NumGoroutine() <= before })
+}
+
+// TestWorkerPool_ManualAck 手动 ack 模式下 worker 派发回调，Ack 成功后 item 被消化
+func TestWorkerPool_ManualAck(t *testing.T) {
+	var acked int64
+	tp := NewMemoryTopicQueue(context.Background(), "pool-manual", WithLogger(NopLogger()), WithWorkerPool(2))
+	if err := tp.StartManualAck(func(_ *Item, ack Acker) {
+		atomic.AddInt64(&acked, 1)
+		ack.Ack()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Close()
+	for i := 0; i < 10; i++ {
+		if err := tp.Push(&Item{Value: []byte(fmt.Sprintf("m%d", i))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&acked); n != 10 {
+		t.Fatalf("want 10 acked got %d", n)
+	}
+}
+
+// TestWorkerPool_RedisSharedHeartbeat WorkerPool 模式下不再为每个 item 启动心跳 goroutine，
+// 由 heartbeatAll 统一续期；doing 集中已不存在的 item 被移出，stop 后注销
+func TestWorkerPool_RedisSharedHeartbeat(t *testing.T) {
+	b := &fakeScriptBuilder{}
+	rq := NewRedisTopicQueue(context.Background(), "pool-hb",
+		WithRedisScriptBuilder(b),
+		WithLogger(NopLogger()),
+		WithWorkerPool(4),
+		WithHeartbeatInterval(time.Second),
+	).(*redisQueue)
+	stubAllScriptsOK(b)
+	var mu sync.Mutex
+	beats := map[string]int{}
+	b.scripts[idxHeartbeat].evalShaFn = func(_ context.Context, _ []string, args ...interface{}) ([]interface{}, error) {
+		v := string(args[0].([]byte))
+		mu.Lock()
+		beats[v]++
+		mu.Unlock()
+		if v == "gone" {
+			return []interface{}{int64(0)}, nil
+		}
+		return []interface{}{int64(1)}, nil
+	}
+	plain := NewRedisTopicQueue(context.Background(), "pool-hb-plain",
+		WithRedisScriptBuilder(&fakeScriptBuilder{}), WithHeartbeatInterval(time.Second)).(*redisQueue)
+	if len(rq.tickers()) != len(plain.tickers())+1 {
+		t.Fatal("heartbeatAll ticker should be registered in worker pool mode")
+	}
+
+	stopA := rq.startHeartbeat(&Item{Value: []byte("a")})
+	stopGone := rq.startHeartbeat(&Item{Value: []byte("gone")})
+	if err := rq.heartbeatAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rq.heartbeatAll(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if beats["a"] != 2 || beats["gone"] != 1 {
+		t.Fatalf("unexpected heartbeats %v", beats)
+	}
+	mu.Unlock()
+	stopGone()
+	stopA()
+	if err := rq.heartbeatAll(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if beats["a"] != 2 || len(rq.hbItems) != 0 {
+		t.Fatalf("stopped items should not be refreshed: beats=%v registered=%d", beats, len(rq.hbItems))
+	}
+}